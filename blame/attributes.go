@@ -0,0 +1,149 @@
+package blame
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// gitAttributes holds the rules of the .gitattributes files in a tree, in
+// increasing order of precedence.
+type gitAttributes struct {
+	rules []attrRule
+}
+
+type attrRule struct {
+	dir     string // directory containing the .gitattributes file ("" at the root)
+	pattern *pathPattern
+
+	// attrs maps attribute names to "true" (set), "false" (unset), a
+	// value, or "" (unspecified).
+	attrs map[string]string
+}
+
+// readGitAttributes reads the .gitattributes files among files, using
+// readFile to get their contents.
+func readGitAttributes(files []string, readFile func(name string) ([]byte, error)) (*gitAttributes, error) {
+	var attrFiles []string
+	for _, f := range files {
+		if path.Base(f) == ".gitattributes" {
+			attrFiles = append(attrFiles, f)
+		}
+	}
+	// Files in subdirectories override those in their parents.
+	sort.SliceStable(attrFiles, func(i, j int) bool {
+		return strings.Count(attrFiles[i], "/") < strings.Count(attrFiles[j], "/")
+	})
+
+	a := new(gitAttributes)
+	for _, f := range attrFiles {
+		data, err := readFile(f)
+		if err != nil {
+			return nil, err
+		}
+		dir := path.Dir(f)
+		if dir == "." {
+			dir = ""
+		}
+		a.rules = append(a.rules, parseGitAttributes(dir, string(data))...)
+	}
+	return a, nil
+}
+
+// parseGitAttributes parses the contents of a .gitattributes file in dir.
+// Lines that it can't parse are skipped, as git does.
+func parseGitAttributes(dir, data string) []attrRule {
+	var rules []attrRule
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[attr]") {
+			continue
+		}
+
+		var pat string
+		if strings.HasPrefix(line, `"`) {
+			end := strings.Index(line[1:], `"`)
+			if end == -1 {
+				continue
+			}
+			pat, line = line[1:end+1], line[end+2:]
+		} else {
+			// The pattern ends at the first space or tab, as in git.
+			pat, line = line, ""
+			if i := strings.IndexAny(pat, " \t"); i != -1 {
+				pat, line = pat[:i], pat[i+1:]
+			}
+		}
+		if strings.HasPrefix(pat, "!") {
+			continue // negative patterns are forbidden
+		}
+		p, err := parsePathPattern(pat, false)
+		if err != nil {
+			continue
+		}
+
+		attrs := make(map[string]string)
+		for _, attr := range strings.Fields(line) {
+			switch {
+			case strings.HasPrefix(attr, "-"):
+				attrs[attr[1:]] = "false"
+			case strings.HasPrefix(attr, "!"):
+				attrs[attr[1:]] = ""
+			case strings.Contains(attr, "="):
+				i := strings.Index(attr, "=")
+				attrs[attr[:i]] = attr[i+1:]
+			default:
+				attrs[attr] = "true"
+			}
+		}
+		rules = append(rules, attrRule{dir: dir, pattern: p, attrs: attrs})
+	}
+	return rules
+}
+
+// get returns the value of the attribute for the file at path p, or "" if
+// it is unspecified.
+func (a *gitAttributes) get(p, attr string) string {
+	var value string
+	for _, r := range a.rules {
+		v, ok := r.attrs[attr]
+		if !ok {
+			continue
+		}
+		rel := p
+		if r.dir != "" {
+			if !strings.HasPrefix(p, r.dir+"/") {
+				continue
+			}
+			rel = p[len(r.dir)+1:]
+		}
+		if r.pattern.match(rel, false) {
+			value = v
+		}
+	}
+	return value
+}
+
+// filterLinguistFiles returns the files that don't have the linguist
+// attributes that opt says to skip. readFile is used to read the
+// .gitattributes files among files.
+func filterLinguistFiles(files []string, opt *BlameOptions, readFile func(name string) ([]byte, error)) ([]string, error) {
+	if opt == nil || (!opt.SkipGenerated && !opt.SkipVendored) {
+		return files, nil
+	}
+	attrs, err := readGitAttributes(files, readFile)
+	if err != nil {
+		return nil, err
+	}
+	var kept []string
+	for _, f := range files {
+		if opt.SkipGenerated && attrs.get(f, "linguist-generated") == "true" {
+			continue
+		}
+		if opt.SkipVendored && attrs.get(f, "linguist-vendored") == "true" {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept, nil
+}
@@ -0,0 +1,250 @@
+package blame
+
+import (
+	"path"
+	"sort"
+)
+
+// A Range selects a portion of a file: lines [Start, End) or, if Chars is
+// true, characters [Start, End). Lines and characters are numbered from 0,
+// as in Hunk.
+type Range struct {
+	Start, End int
+	Chars      bool
+}
+
+// A Share is the amount of code most recently authored by an author or
+// commit, and the percentage of the summarized code that it makes up.
+type Share struct {
+	Lines       int
+	Chars       int
+	LinePercent float64
+	CharPercent float64
+}
+
+type AuthorShare struct {
+	Author Author
+	Share
+}
+
+type CommitShare struct {
+	CommitID string
+	Share
+}
+
+// Authorship summarizes the most-recent authorship of a portion of code.
+// Authors and Commits are sorted by decreasing number of lines.
+type Authorship struct {
+	Lines   int
+	Chars   int
+	Authors []AuthorShare
+	Commits []CommitShare
+}
+
+// FileAuthorship summarizes the authorship of a file's blame hunks, each
+// of which covers lines [LineStart, LineEnd) and characters [CharStart,
+// CharEnd), as NormalizeHunks returns them. If r is non-nil, only the part
+// of the file that r selects is counted.
+//
+// Hunks carry no per-line character offsets, so when a hunk only partly
+// overlaps r, the characters (for a line range) or lines (for a character
+// range) it contributes are estimated in proportion to the overlap.
+func FileAuthorship(hunks []Hunk, commits map[string]Commit, r *Range) *Authorship {
+	var c authorshipCounter
+	c.addFile(hunks, commits, r)
+	return c.authorship()
+}
+
+// RepositoryAuthorship summarizes the authorship of each file in a
+// repository blame, and of each directory, aggregated over the files it
+// contains. The result is keyed by file or directory path; the repository
+// root is ".". Each file's hunks must be normalized, as for
+// FileAuthorship.
+func RepositoryAuthorship(hunks map[string][]Hunk, commits map[string]Commit) map[string]*Authorship {
+	counters := make(map[string]*authorshipCounter)
+	counter := func(p string) *authorshipCounter {
+		c, ok := counters[p]
+		if !ok {
+			c = new(authorshipCounter)
+			counters[p] = c
+		}
+		return c
+	}
+
+	for file, fileHunks := range hunks {
+		fc := counter(file)
+		fc.addFile(fileHunks, commits, nil)
+		for dir := path.Dir(file); ; dir = path.Dir(dir) {
+			counter(dir).merge(fc)
+			if dir == "." || dir == "/" {
+				break
+			}
+		}
+	}
+
+	summaries := make(map[string]*Authorship, len(counters))
+	for p, c := range counters {
+		summaries[p] = c.authorship()
+	}
+	return summaries
+}
+
+// NormalizeHunks returns the hunks of a whole file, as the named backend
+// blamed it (e.g., with BlameFile or BlameRepository), in the form that
+// FileAuthorship expects. The hg backend's hunks are converted (their
+// LineEnd is the index of their last line, and their character offsets
+// are shifted by 1); other backends' hunks are returned as they are.
+func NormalizeHunks(backend string, hunks []Hunk) []Hunk {
+	if backend != "hg" || len(hunks) == 0 {
+		return hunks
+	}
+	normalized := make([]Hunk, len(hunks))
+	for i, h := range hunks {
+		h.LineEnd++
+		if h.CharStart != 0 {
+			h.CharStart--
+		}
+		normalized[i] = h
+	}
+	normalized[len(normalized)-1].CharEnd--
+	return normalized
+}
+
+type shareCount struct{ lines, chars int }
+
+type authorshipCounter struct {
+	total    shareCount
+	byAuthor map[Author]*shareCount
+	byCommit map[string]*shareCount
+}
+
+func (sc *shareCount) add(n shareCount) {
+	sc.lines += n.lines
+	sc.chars += n.chars
+}
+
+func (c *authorshipCounter) addAuthor(author Author, n shareCount) {
+	if c.byAuthor == nil {
+		c.byAuthor = make(map[Author]*shareCount)
+	}
+	if c.byAuthor[author] == nil {
+		c.byAuthor[author] = new(shareCount)
+	}
+	c.byAuthor[author].add(n)
+}
+
+func (c *authorshipCounter) addCommit(commitID string, n shareCount) {
+	if c.byCommit == nil {
+		c.byCommit = make(map[string]*shareCount)
+	}
+	if c.byCommit[commitID] == nil {
+		c.byCommit[commitID] = new(shareCount)
+	}
+	c.byCommit[commitID].add(n)
+}
+
+func (c *authorshipCounter) addFile(hunks []Hunk, commits map[string]Commit, r *Range) {
+	for _, h := range hunks {
+		lines, chars := h.LineEnd-h.LineStart, h.CharEnd-h.CharStart
+		if r != nil {
+			if r.Chars {
+				overlap := overlap(h.CharStart, h.CharEnd, r.Start, r.End)
+				lines, chars = proportion(lines, overlap, chars), overlap
+			} else {
+				overlap := overlap(h.LineStart, h.LineEnd, r.Start, r.End)
+				lines, chars = overlap, proportion(chars, overlap, lines)
+			}
+		}
+		if lines <= 0 && chars <= 0 {
+			continue
+		}
+		n := shareCount{lines, chars}
+		c.addAuthor(commits[h.CommitID].Author, n)
+		c.addCommit(h.CommitID, n)
+		c.total.add(n)
+	}
+}
+
+func (c *authorshipCounter) merge(o *authorshipCounter) {
+	for author, n := range o.byAuthor {
+		c.addAuthor(author, *n)
+	}
+	for commitID, n := range o.byCommit {
+		c.addCommit(commitID, *n)
+	}
+	c.total.add(o.total)
+}
+
+func (c *authorshipCounter) authorship() *Authorship {
+	a := &Authorship{Lines: c.total.lines, Chars: c.total.chars}
+	for author, sc := range c.byAuthor {
+		a.Authors = append(a.Authors, AuthorShare{Author: author, Share: c.share(sc)})
+	}
+	for id, sc := range c.byCommit {
+		a.Commits = append(a.Commits, CommitShare{CommitID: id, Share: c.share(sc)})
+	}
+	sort.Slice(a.Authors, func(i, j int) bool {
+		x, y := a.Authors[i], a.Authors[j]
+		if x.Lines != y.Lines {
+			return x.Lines > y.Lines
+		}
+		if x.Chars != y.Chars {
+			return x.Chars > y.Chars
+		}
+		if x.Author.Name != y.Author.Name {
+			return x.Author.Name < y.Author.Name
+		}
+		return x.Author.Email < y.Author.Email
+	})
+	sort.Slice(a.Commits, func(i, j int) bool {
+		x, y := a.Commits[i], a.Commits[j]
+		if x.Lines != y.Lines {
+			return x.Lines > y.Lines
+		}
+		if x.Chars != y.Chars {
+			return x.Chars > y.Chars
+		}
+		return x.CommitID < y.CommitID
+	})
+	return a
+}
+
+func (c *authorshipCounter) share(sc *shareCount) Share {
+	return Share{
+		Lines:       sc.lines,
+		Chars:       sc.chars,
+		LinePercent: percent(sc.lines, c.total.lines),
+		CharPercent: percent(sc.chars, c.total.chars),
+	}
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
+
+// overlap returns the length of the intersection of [start1, end1) and
+// [start2, end2).
+func overlap(start1, end1, start2, end2 int) int {
+	if start2 > start1 {
+		start1 = start2
+	}
+	if end2 < end1 {
+		end1 = end2
+	}
+	if end1 < start1 {
+		return 0
+	}
+	return end1 - start1
+}
+
+// proportion returns n scaled by part/whole, rounded to the nearest
+// integer.
+func proportion(n, part, whole int) int {
+	if whole <= 0 {
+		return 0
+	}
+	return (n*part*2 + whole) / (whole * 2)
+}
@@ -0,0 +1,121 @@
+package blame
+
+import (
+	"reflect"
+	"testing"
+)
+
+var (
+	authorA = Author{Name: "A", Email: "a@example.com"}
+	authorB = Author{Name: "B", Email: "b@example.com"}
+
+	authorshipCommits = map[string]Commit{
+		"c1": {ID: "c1", Author: authorA},
+		"c2": {ID: "c2", Author: authorB},
+		"c3": {ID: "c3", Author: authorA},
+	}
+	authorshipHunks = []Hunk{
+		{CommitID: "c1", LineStart: 0, LineEnd: 2, CharStart: 0, CharEnd: 20},
+		{CommitID: "c2", LineStart: 2, LineEnd: 4, CharStart: 20, CharEnd: 30},
+		{CommitID: "c3", LineStart: 4, LineEnd: 8, CharStart: 30, CharEnd: 40},
+	}
+)
+
+func TestFileAuthorship(t *testing.T) {
+	tests := map[string]struct {
+		r    *Range
+		want *Authorship
+	}{
+		"whole file": {
+			want: &Authorship{
+				Lines: 8, Chars: 40,
+				Authors: []AuthorShare{
+					{Author: authorA, Share: Share{Lines: 6, Chars: 30, LinePercent: 75, CharPercent: 75}},
+					{Author: authorB, Share: Share{Lines: 2, Chars: 10, LinePercent: 25, CharPercent: 25}},
+				},
+				Commits: []CommitShare{
+					{CommitID: "c3", Share: Share{Lines: 4, Chars: 10, LinePercent: 50, CharPercent: 25}},
+					{CommitID: "c1", Share: Share{Lines: 2, Chars: 20, LinePercent: 25, CharPercent: 50}},
+					{CommitID: "c2", Share: Share{Lines: 2, Chars: 10, LinePercent: 25, CharPercent: 25}},
+				},
+			},
+		},
+		"line range": {
+			r: &Range{Start: 3, End: 5},
+			want: &Authorship{
+				Lines: 2, Chars: 8,
+				Authors: []AuthorShare{
+					{Author: authorB, Share: Share{Lines: 1, Chars: 5, LinePercent: 50, CharPercent: 62.5}},
+					{Author: authorA, Share: Share{Lines: 1, Chars: 3, LinePercent: 50, CharPercent: 37.5}},
+				},
+				Commits: []CommitShare{
+					{CommitID: "c2", Share: Share{Lines: 1, Chars: 5, LinePercent: 50, CharPercent: 62.5}},
+					{CommitID: "c3", Share: Share{Lines: 1, Chars: 3, LinePercent: 50, CharPercent: 37.5}},
+				},
+			},
+		},
+		"char range": {
+			r: &Range{Start: 30, End: 35, Chars: true},
+			want: &Authorship{
+				Lines: 2, Chars: 5,
+				Authors: []AuthorShare{
+					{Author: authorA, Share: Share{Lines: 2, Chars: 5, LinePercent: 100, CharPercent: 100}},
+				},
+				Commits: []CommitShare{
+					{CommitID: "c3", Share: Share{Lines: 2, Chars: 5, LinePercent: 100, CharPercent: 100}},
+				},
+			},
+		},
+	}
+	for label, test := range tests {
+		got := FileAuthorship(authorshipHunks, authorshipCommits, test.r)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", label, got, test.want)
+		}
+	}
+}
+
+func TestRepositoryAuthorship(t *testing.T) {
+	hunks := map[string][]Hunk{
+		"a/b/f1": authorshipHunks[:1],
+		"a/f2":   authorshipHunks[1:2],
+		"f3":     authorshipHunks[2:],
+	}
+	got := RepositoryAuthorship(hunks, authorshipCommits)
+
+	wantLines := map[string]int{"a/b/f1": 2, "a/b": 2, "a/f2": 2, "a": 4, "f3": 4, ".": 8}
+	if len(got) != len(wantLines) {
+		t.Errorf("got %d summaries, want %d", len(got), len(wantLines))
+	}
+	for p, lines := range wantLines {
+		if got[p] == nil || got[p].Lines != lines {
+			t.Errorf("%s: got %+v, want %d lines", p, got[p], lines)
+		}
+	}
+
+	if want := FileAuthorship(authorshipHunks, authorshipCommits, nil); !reflect.DeepEqual(got["."], want) {
+		t.Errorf("got root authorship %+v, want %+v", got["."], want)
+	}
+}
+
+func TestNormalizeHunks(t *testing.T) {
+	want := []Hunk{
+		{CommitID: "d047adf8d7ff", LineStart: 0, LineEnd: 1, CharStart: 0, CharEnd: 11},
+		{CommitID: "52f96eab35cf", LineStart: 1, LineEnd: 3, CharStart: 11, CharEnd: 27},
+		{CommitID: "d14ec9caa006", LineStart: 3, LineEnd: 4, CharStart: 27, CharEnd: 39},
+		{CommitID: "52f96eab35cf", LineStart: 4, LineEnd: 6, CharStart: 39, CharEnd: 48},
+	}
+	hunks := NormalizeHunks("hg", expHunksHg["foo"])
+	if !reflect.DeepEqual(hunks, want) {
+		t.Errorf("got hunks %+v, want %+v", hunks, want)
+	}
+	if hunks := NormalizeHunks("git", authorshipHunks); !reflect.DeepEqual(hunks, authorshipHunks) {
+		t.Errorf("git: got hunks %+v, want them unchanged", hunks)
+	}
+
+	// A 1-line hg hunk counts as a line.
+	a := FileAuthorship(hunks, expCommitsHg, nil)
+	if a.Lines != 6 || a.Chars != 48 || len(a.Commits) != 3 || a.Commits[0].CommitID != "52f96eab35cf" || a.Commits[0].Lines != 4 || a.Commits[0].Chars != 25 {
+		t.Errorf("got authorship %+v, want 6 lines and 48 chars, 4 lines and 25 chars by 52f96eab35cf", a)
+	}
+}
@@ -0,0 +1,155 @@
+package blame
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A Backend computes blame information for one kind of version control
+// repository. The git and hg backends are registered by this package;
+// other packages may register their own with RegisterBackend.
+//
+// Backends should stop work and return ctx.Err() when ctx is done.
+type Backend interface {
+	// Detect returns true if repoPath is a repository that this backend
+	// knows how to blame.
+	Detect(repoPath string) bool
+
+	// ListFiles returns the paths, relative to repoPath, of the files in
+	// the repository at revision v.
+	ListFiles(ctx context.Context, repoPath, v string) ([]string, error)
+
+	// BlameFile blames a single file at revision v. filePath should be
+	// absolute or relative to repoPath. opt may be nil. Backends should
+	// honor as many of its options as they can.
+	BlameFile(ctx context.Context, repoPath, filePath, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error)
+
+	// BlameRepository blames all files in the repository at revision v,
+	// skipping files that match ignorePatterns (see Matcher).
+	BlameRepository(ctx context.Context, repoPath, v string, ignorePatterns []string, opt *BlameOptions) (map[string][]Hunk, map[string]Commit, error)
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Backend)
+
+	// backendNames lists registered backends in registration order, which
+	// is the order in which they are consulted by DetectBackend.
+	backendNames []string
+)
+
+func init() {
+	// hg is consulted first so that hg repositories that also contain a
+	// .git directory (e.g., hg-git) are blamed with hg, as they always
+	// have been.
+	RegisterBackend("hg", hgBackend{})
+	RegisterBackend("git", gitBackend{})
+}
+
+// RegisterBackend makes a backend available by the provided name. If
+// RegisterBackend is called twice with the same name or if b is nil, it
+// panics.
+func RegisterBackend(name string, b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if b == nil {
+		panic("blame: RegisterBackend backend is nil")
+	}
+	if _, dup := backends[name]; dup {
+		panic("blame: RegisterBackend called twice for backend " + name)
+	}
+	backends[name] = b
+	backendNames = append(backendNames, name)
+}
+
+// Backends returns the names of the registered backends, in registration
+// order.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	return append([]string(nil), backendNames...)
+}
+
+// LookupBackend returns the backend registered with the given name.
+func LookupBackend(name string) (Backend, error) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	b, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("blame: unknown backend %q", name)
+	}
+	return b, nil
+}
+
+// DetectBackend returns the first registered backend (and its name) whose
+// Detect method claims repoPath. If none does, the git backend is
+// returned, because git can also locate repositories that have no .git
+// directory at repoPath (e.g., subdirectories of a work tree).
+func DetectBackend(repoPath string) (string, Backend) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	for _, name := range backendNames {
+		if b := backends[name]; b.Detect(repoPath) {
+			return name, b
+		}
+	}
+	return "git", backends["git"]
+}
+
+type gitBackend struct{}
+
+func (gitBackend) Detect(repoPath string) bool {
+	if _, err := os.Stat(filepath.Join(repoPath, ".git")); err == nil {
+		return true
+	}
+	// bare repository
+	return isDir(filepath.Join(repoPath, "objects")) && isDir(filepath.Join(repoPath, "refs"))
+}
+
+func (gitBackend) ListFiles(ctx context.Context, repoPath, v string) ([]string, error) {
+	return listGitRepositoryFiles(ctx, repoPath, v)
+}
+
+func (gitBackend) BlameFile(ctx context.Context, repoPath, filePath, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	return BlameGitFileContext(ctx, repoPath, filePath, v, opt)
+}
+
+func (gitBackend) BlameRepository(ctx context.Context, repoPath, v string, ignorePatterns []string, opt *BlameOptions) (map[string][]Hunk, map[string]Commit, error) {
+	return BlameGitRepositoryContext(ctx, repoPath, v, ignorePatterns, opt)
+}
+
+type hgBackend struct{}
+
+func (hgBackend) Detect(repoPath string) bool {
+	return isDir(filepath.Join(repoPath, ".hg"))
+}
+
+func (hgBackend) ListFiles(ctx context.Context, repoPath, v string) ([]string, error) {
+	return listHgRepositoryFiles(ctx, repoPath, v)
+}
+
+func (hgBackend) BlameFile(ctx context.Context, repoPath, filePath, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	return BlameHgFileContext(ctx, repoPath, filePath, v, opt)
+}
+
+func (hgBackend) BlameRepository(ctx context.Context, repoPath, v string, ignorePatterns []string, opt *BlameOptions) (map[string][]Hunk, map[string]Commit, error) {
+	return BlameHgRepositoryContext(ctx, repoPath, v, ignorePatterns, opt)
+}
+
+// relSlashPath returns the slash-separated path of filePath relative to
+// repoPath, as hg prints it and as git stores it.
+func relSlashPath(repoPath, filePath string) (string, error) {
+	if filepath.IsAbs(filePath) {
+		absRepoPath, err := filepath.Abs(repoPath)
+		if err != nil {
+			return "", err
+		}
+		if filePath, err = filepath.Rel(absRepoPath, filePath); err != nil {
+			return "", err
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(filePath)), nil
+}
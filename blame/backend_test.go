@@ -0,0 +1,76 @@
+package blame
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type testBackend struct{}
+
+func (testBackend) Detect(repoPath string) bool {
+	_, err := os.Stat(filepath.Join(repoPath, ".testvcs"))
+	return err == nil
+}
+
+func (testBackend) ListFiles(ctx context.Context, repoPath, v string) ([]string, error) {
+	return []string{"a"}, nil
+}
+
+func (testBackend) BlameFile(ctx context.Context, repoPath, filePath, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	return []Hunk{{CommitID: v, LineStart: 0, LineEnd: 1, CharStart: 0, CharEnd: 2}}, map[string]Commit{v: {ID: v}}, nil
+}
+
+func (b testBackend) BlameRepository(ctx context.Context, repoPath, v string, ignorePatterns []string, opt *BlameOptions) (map[string][]Hunk, map[string]Commit, error) {
+	files, _ := b.ListFiles(ctx, repoPath, v)
+	return blameFiles(ctx, b.BlameFile, repoPath, files, v, ignorePatterns, opt)
+}
+
+func init() {
+	RegisterBackend("test", testBackend{})
+}
+
+func TestLookupBackend(t *testing.T) {
+	for _, name := range []string{"git", "hg", "test"} {
+		if _, err := LookupBackend(name); err != nil {
+			t.Errorf("LookupBackend(%q): %s", name, err)
+		}
+	}
+	if _, err := LookupBackend("nonexistent"); err == nil {
+		t.Error("LookupBackend(nonexistent): got nil error")
+	}
+}
+
+func TestDetectBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-blame-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if name, _ := DetectBackend(dir); name != "git" {
+		t.Errorf("got backend %q for empty dir, want git", name)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, ".testvcs"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := DetectBackend(dir); name != "test" {
+		t.Errorf("got backend %q, want test", name)
+	}
+
+	hunks, commits, err := BlameRepository(dir, "v", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHunks := map[string][]Hunk{"a": {{CommitID: "v", LineStart: 0, LineEnd: 1, CharStart: 0, CharEnd: 2}}}
+	if !reflect.DeepEqual(hunks, wantHunks) {
+		t.Errorf("got hunks %+v, want %+v", hunks, wantHunks)
+	}
+	if wantCommits := map[string]Commit{"v": {ID: "v"}}; !reflect.DeepEqual(commits, wantCommits) {
+		t.Errorf("got commits %+v, want %+v", commits, wantCommits)
+	}
+}
@@ -1,15 +1,12 @@
 package blame
 
 import (
-	"bufio"
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"io"
-	"io/ioutil"
-	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,17 +19,32 @@ type Hunk struct {
 	LineEnd   int
 	CharStart int
 	CharEnd   int
+
+	// Ignored is true if the hunk was attributed to CommitID by looking
+	// past a commit that BlameOptions said to ignore.
+	Ignored bool `json:",omitempty"`
 }
 
 type Commit struct {
-	ID     string
-	Author Author
+	ID        string
+	Author    Author
+	Committer Author
 
+	// Message is the full commit message, and Summary is its first line.
 	Message string
+	Summary string
 
-	// AuthorDate is the date when this commit was originally made. (It may
-	// differ from the commit date, which is changed during rebases, etc.)
+	// AuthorDate is the date when this commit was originally made, in the
+	// author's time zone. (It may differ from the commit date, which is
+	// changed during rebases, etc.)
 	AuthorDate time.Time
+
+	// CommitterDate is the date when this commit was last changed, in the
+	// committer's time zone.
+	CommitterDate time.Time
+
+	// Parents are the IDs of the commit's parent commits.
+	Parents []string
 }
 
 type Author struct {
@@ -40,26 +52,168 @@ type Author struct {
 	Email string
 }
 
-var Log *log.Logger
+// BlameOptions controls how lines are attributed to commits. The zero
+// value (or a nil *BlameOptions) gives the default behavior. The hg
+// backend only honors HgIgnoreWhitespace; hg always follows whole-file
+// copies and renames, and cannot detect moved or copied lines.
+type BlameOptions struct {
+	// NoIgnoreWhitespace attributes changes that only affect whitespace
+	// to the commits that made them. By default git ignores them (git
+	// blame -w).
+	NoIgnoreWhitespace bool
+
+	// HgIgnoreWhitespace makes hg ignore changes that only affect
+	// whitespace (hg annotate -w). By default hg attributes them to the
+	// commits that made them, as it always has.
+	HgIgnoreWhitespace bool
+
+	// DetectMoves attributes lines that were moved or copied within a
+	// file to the commit that originally added them, instead of the one
+	// that moved them (git blame -M). MoveScore, if nonzero, is the number
+	// of alphanumeric characters that must be moved for git to detect it
+	// (git's default is 20).
+	DetectMoves bool
+	MoveScore   int
+
+	// DetectCopies, if nonzero, also attributes lines that were moved or
+	// copied from other files (git blame -C). At level 1, git looks for
+	// them in files modified in the same commit; at level 2, also in the
+	// files that existed when the file was created; and at level 3, in
+	// all files of all commits. CopyScore is like MoveScore (git's default
+	// is 40).
+	DetectCopies int
+	CopyScore    int
+
+	// IgnoreRevs are commits to look past when attributing lines, such as
+	// commits that only reformatted code (git blame --ignore-rev).
+	// IgnoreRevsFile is the path, relative to the repository, of a file
+	// that lists such commits (git blame --ignore-revs-file). If
+	// ReadIgnoreRevsFile is true, the commits listed in the
+	// .git-blame-ignore-revs file of the blamed revision, if any, are
+	// ignored too, as git blame itself ignores the commits listed in the
+	// files that the repository's blame.ignoreRevsFile setting names.
+	// Hunks that were attributed by looking past an ignored commit have
+	// Ignored set. These options are only supported by git.
+	IgnoreRevs         []string
+	IgnoreRevsFile     string
+	ReadIgnoreRevsFile bool
+
+	// SkipGenerated and SkipVendored skip the files that .gitattributes
+	// files mark as linguist-generated or linguist-vendored, respectively,
+	// when blaming a repository. The .gitattributes files are read from
+	// the blamed revision (in both git and hg repositories).
+	SkipGenerated bool
+	SkipVendored  bool
+
+	// MaxFailedFiles, if nonzero, makes blaming a repository continue
+	// past files that can't be blamed, as long as no more than
+	// MaxFailedFiles fail (or any number, if it's negative). The results
+	// of the other files are returned with a *FileErrors error that lists
+	// the failed ones. By default, blaming stops at the first failed file.
+	// The hg backend, which annotates all files with one command, and
+	// StreamRepository, which passes each failure on, ignore it.
+	MaxFailedFiles int
+
+	// Workers is the maximum number of files that are blamed concurrently
+	// when blaming a repository. If it's zero, runtime.GOMAXPROCS(0) is
+	// used.
+	Workers int
+
+	// Throttle, if nonzero, is the minimum delay between starting to blame
+	// successive files when blaming a repository. It can be used to limit
+	// the load that blaming a large repository puts on the host.
+	Throttle time.Duration
+
+	// revIgnoreRevsFile is the path of a temporary copy of the blamed
+	// revision's .git-blame-ignore-revs file. See prepareGitOptions.
+	revIgnoreRevsFile string
+
+	// configIgnoreRevsFiles lists the files that the repository's
+	// blame.ignoreRevsFile setting names, and gitPrepared is set once
+	// prepareGitOptions has run. See prepareGitOptions.
+	configIgnoreRevsFiles []string
+	gitPrepared           bool
+
+	// gitBlobs and gitLastCommits hold the git ls-tree entries of the
+	// files in a repository blame and the last commits that changed them,
+	// for gitCacheKey. See withGitBlobs.
+	gitBlobs       map[string]string
+	gitLastCommits map[string]string
+}
 
-func logf(s string, v ...interface{}) {
-	if Log != nil {
-		Log.Printf(s, v...)
+// gitArgs returns the git blame flags for opt.
+func (opt *BlameOptions) gitArgs() []string {
+	if opt == nil {
+		opt = &BlameOptions{}
+	}
+	var args []string
+	if !opt.NoIgnoreWhitespace {
+		args = append(args, "-w")
+	}
+	if opt.DetectMoves {
+		args = append(args, "-M"+scoreArg(opt.MoveScore))
+	}
+	for i := 0; i < opt.DetectCopies && i < 3; i++ {
+		args = append(args, "-C"+scoreArg(opt.CopyScore))
+	}
+	for _, rev := range opt.IgnoreRevs {
+		args = append(args, "--ignore-rev", rev)
+	}
+	for _, file := range []string{opt.IgnoreRevsFile, opt.revIgnoreRevsFile} {
+		if file != "" {
+			args = append(args, "--ignore-revs-file", file)
+		}
 	}
+	return args
 }
 
-func BlameRepository(repoPath, v string, ignorePatterns []string) (map[string][]Hunk, map[string]Commit, error) {
-	if isDir(filepath.Join(repoPath, ".hg")) {
-		return BlameHgRepository(repoPath, v, ignorePatterns)
+// ignoresRevs returns true if opt makes git blame ignore any commits.
+func (opt *BlameOptions) ignoresRevs() bool {
+	return opt != nil && (len(opt.IgnoreRevs) > 0 || opt.IgnoreRevsFile != "" || opt.revIgnoreRevsFile != "" || len(opt.configIgnoreRevsFiles) > 0)
+}
+
+// hgArgs returns the hg annotate flags for opt.
+func (opt *BlameOptions) hgArgs() []string {
+	if opt != nil && opt.HgIgnoreWhitespace {
+		return []string{"--ignore-all-space"}
 	}
-	return BlameGitRepository(repoPath, v, ignorePatterns)
+	return nil
 }
 
-func BlameFile(repoPath, filePath, v string) ([]Hunk, map[string]Commit, error) {
-	if isDir(filepath.Join(repoPath, ".hg")) {
-		return BlameHgFile(repoPath, filePath, v)
+func scoreArg(score int) string {
+	if score <= 0 {
+		return ""
 	}
-	return BlameGitFile(repoPath, filePath, v)
+	return strconv.Itoa(score)
+}
+
+// BlameRepository blames all files in the repository at repoPath, using
+// the backend returned by DetectBackend.
+func BlameRepository(repoPath, v string, ignorePatterns []string) (map[string][]Hunk, map[string]Commit, error) {
+	return BlameRepositoryContext(context.Background(), repoPath, v, ignorePatterns, nil)
+}
+
+// BlameRepositoryContext is like BlameRepository, but stops blaming and
+// kills any running git or hg processes when ctx is done. In that case,
+// the returned error is ctx.Err(). If opt is nil, the default options are
+// used.
+func BlameRepositoryContext(ctx context.Context, repoPath, v string, ignorePatterns []string, opt *BlameOptions) (map[string][]Hunk, map[string]Commit, error) {
+	_, b := DetectBackend(repoPath)
+	return b.BlameRepository(ctx, repoPath, v, ignorePatterns, opt)
+}
+
+// BlameFile blames a single file in the repository at repoPath, using the
+// backend returned by DetectBackend.
+func BlameFile(repoPath, filePath, v string) ([]Hunk, map[string]Commit, error) {
+	return BlameFileContext(context.Background(), repoPath, filePath, v, nil)
+}
+
+// BlameFileContext is like BlameFile, but kills the git or hg process when
+// ctx is done. In that case, the returned error is ctx.Err(). If opt is
+// nil, the default options are used.
+func BlameFileContext(ctx context.Context, repoPath, filePath, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	_, b := DetectBackend(repoPath)
+	return b.BlameFile(ctx, repoPath, filePath, v, opt)
 }
 
 // isDir returns true if path is an existing directory, and false otherwise.
@@ -68,262 +222,411 @@ func isDir(path string) bool {
 	return err == nil && fi.IsDir()
 }
 
-func listGitRepositoryFiles(repoPath string, v string) ([]string, error) {
-	cmd := exec.Command("git", "ls-tree", "-z", "-r", v, "--name-only")
-	cmd.Dir = repoPath
-	cmd.Stderr = os.Stderr
+func listGitRepositoryFiles(ctx context.Context, repoPath string, v string) ([]string, error) {
+	files, _, err := listGitRepositoryBlobs(ctx, repoPath, v)
+	return files, err
+}
+
+// listGitRepositoryBlobs is like listGitRepositoryFiles, but also returns
+// the mode, type and object ID that git ls-tree lists for each file.
+func listGitRepositoryBlobs(ctx context.Context, repoPath string, v string) ([]string, map[string]string, error) {
+	cmd := command(ctx, repoPath, "git", "ls-tree", "-z", "-r", v)
 	lines, err := cmd.Output()
-	if err != nil {
-		return nil, err
+	if err = commandErr(ctx, cmd, err); err != nil {
+		return nil, nil, err
 	}
-	paths := strings.Split(string(lines), "\x00")
 
 	// Directories listed here are git submodules (otherwise only files are
 	// listed). Omit these because we can't `git blame` them.
 	var files []string
-	for _, f := range paths {
+	blobs := make(map[string]string)
+	for _, line := range strings.Split(string(lines), "\x00") {
+		i := strings.IndexByte(line, '\t')
+		if i < 0 {
+			continue
+		}
+		f := line[i+1:]
 		if !isDir(filepath.Join(repoPath, f)) {
 			files = append(files, f)
+			blobs[f] = line[:i]
 		}
 	}
 
-	return files, nil
+	return files, blobs, nil
 }
 
 func BlameGitRepository(repoPath string, v string, ignorePatterns []string) (map[string][]Hunk, map[string]Commit, error) {
-	files, err := listGitRepositoryFiles(repoPath, v)
+	return BlameGitRepositoryContext(context.Background(), repoPath, v, ignorePatterns, nil)
+}
+
+func BlameGitRepositoryContext(ctx context.Context, repoPath string, v string, ignorePatterns []string, opt *BlameOptions) (map[string][]Hunk, map[string]Commit, error) {
+	files, opt, cleanup, err := gitRepositoryFiles(ctx, repoPath, v, opt)
 	if err != nil {
 		return nil, nil, err
 	}
-	return blameFiles(repoPath, files, v, ignorePatterns)
+	defer cleanup()
+	hunks, commits, err := blameFiles(ctx, blameGitFile, repoPath, files, v, ignorePatterns, opt)
+	if err != nil && !isPartial(err) {
+		return nil, nil, err
+	}
+	// Fetch commit details once for the whole repository, not per file.
+	if err := addGitCommitDetails(ctx, repoPath, commits); err != nil {
+		return nil, nil, err
+	}
+	return hunks, commits, err
 }
 
-func listHgRepositoryFiles(repoPath string, v string) ([]string, error) {
-	cmd := exec.Command("hg", "locate", "--print0", "-r", v)
-	cmd.Dir = repoPath
-	cmd.Stderr = os.Stderr
-	lines, err := cmd.Output()
+// streamGitRepository implements StreamRepository for git.
+func streamGitRepository(ctx context.Context, repoPath string, v string, ignorePatterns []string, opt *BlameOptions, fn func(FileBlame) error) error {
+	files, opt, cleanup, err := gitRepositoryFiles(ctx, repoPath, v, opt)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	files := strings.Split(string(lines), "\x00")
-	return files, nil
-}
-
-type hgRepoAnnotatOutputFormat struct {
-	Commits map[string]Commit
-	Hunks   map[string][]Hunk
+	defer cleanup()
+	// Commit details are read by one git cat-file process, as each file
+	// brings new commits.
+	c, err := startGitCatFile(ctx, repoPath)
+	if err != nil {
+		return err
+	}
+	if err := streamFiles(ctx, blameGitFile, repoPath, files, v, ignorePatterns, opt, c.readCommits, fn); err != nil {
+		c.cmd.Process.Kill()
+		c.close()
+		return err
+	}
+	return c.close()
 }
 
-func BlameHgRepository(repoPath string, v string, ignorePatterns []string) (map[string][]Hunk, map[string]Commit, error) {
-	// write script to temp file
-	tmpfile, err := ioutil.TempFile("", "hg-repo-annotate.py")
+// gitRepositoryFiles returns the files to blame in a git repository
+// (without those that opt skips) and the prepared options to blame them
+// with. cleanup must be called when blaming is done.
+func gitRepositoryFiles(ctx context.Context, repoPath, v string, opt *BlameOptions) (files []string, _ *BlameOptions, cleanup func(), err error) {
+	files, blobs, err := listGitRepositoryBlobs(ctx, repoPath, v)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	defer os.Remove(tmpfile.Name())
-	_, err = io.WriteString(tmpfile, hgRepoAnnotatePy)
+	files, err = filterLinguistFiles(files, opt, func(name string) ([]byte, error) {
+		return gitFileContents(ctx, repoPath, v, name)
+	})
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+	opt, cleanup, err = prepareGitOptions(ctx, repoPath, v, opt)
+	if err != nil {
+		return nil, nil, nil, err
 	}
+	if BlameCache != nil {
+		if opt, err = withGitBlobs(ctx, repoPath, v, opt, blobs); err != nil {
+			cleanup()
+			return nil, nil, nil, err
+		}
+	}
+	return files, opt, cleanup, nil
+}
 
-	cmd := exec.Command("python", tmpfile.Name(), repoPath, v)
-	cmd.Dir = repoPath
-	cmd.Stderr = os.Stderr
-	stdout, err := cmd.StdoutPipe()
+// gitFileContents returns the contents of a file (relative to repoPath) at
+// revision v.
+func gitFileContents(ctx context.Context, repoPath, v, name string) ([]byte, error) {
+	cmd := command(ctx, repoPath, "git", "cat-file", "blob", v+":./"+name)
+	data, err := cmd.Output()
+	if err = commandErr(ctx, cmd, err); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// selectFiles returns the files to blame in a repository: those that
+// ignorePatterns don't match. See Matcher for the syntax of the patterns.
+func selectFiles(files []string, ignorePatterns []string) ([]string, error) {
+	m, err := NewMatcher(ignorePatterns)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	return filterFiles(files, m), nil
+}
 
-	in := bufio.NewReader(stdout)
-	if err := cmd.Start(); err != nil {
+// blameFileFunc blames a single file. See Backend.BlameFile.
+type blameFileFunc func(ctx context.Context, repoPath, filePath, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error)
+
+// blameFiles blames files (skipping those that match ignorePatterns, and
+// binary ones) using up to opt.Workers concurrent calls to blameFile. The
+// result does not depend on the order in which the files finish: commits
+// are merged in the order of files, and if several files fail, the error
+// of the first one is returned (or, if opt.MaxFailedFiles allows it, a
+// *FileErrors that lists them). If ctx is done, no more files are started
+// and ctx.Err() is returned.
+func blameFiles(ctx context.Context, blameFile blameFileFunc, repoPath string, files []string, v string, ignorePatterns []string, opt *BlameOptions) (map[string][]Hunk, map[string]Commit, error) {
+	blameable, err := selectFiles(files, ignorePatterns)
+	if err != nil {
 		return nil, nil, err
 	}
+	maxFailed := 0
+	if opt != nil {
+		maxFailed = opt.MaxFailedFiles
+	}
 
-	var data hgRepoAnnotatOutputFormat
-	err = json.NewDecoder(in).Decode(&data)
-	if err != nil {
+	// Stop starting files when more than maxFailed have failed; the
+	// errors are collected below.
+	results := make([]fileResult, len(blameable))
+	nFailed := 0
+	forEachFile(ctx, blameFile, repoPath, blameable, v, opt, func(i int, r fileResult) error {
+		results[i] = r
+		if r.err != nil {
+			if nFailed++; maxFailed >= 0 && nFailed > maxFailed {
+				return r.err
+			}
+		}
+		return nil
+	})
+	if err := ctx.Err(); err != nil {
 		return nil, nil, err
 	}
-	return data.Hunks, data.Commits, nil
-}
 
-func blameFiles(repoPath string, files []string, v string, ignorePatterns []string) (map[string][]Hunk, map[string]Commit, error) {
+	// Files are dispatched in order, so every file before the first failed
+	// one has been blamed.
 	hunks := make(map[string][]Hunk)
 	commits := make(map[string]Commit)
-	var m sync.Mutex
-	t0 := time.Now()
-	for i, file := range files {
-		file := string(file)
-		if file == "" {
+	var failed []FileError
+	for i, file := range blameable {
+		r := results[i]
+		if r.err != nil {
+			if maxFailed == 0 {
+				return nil, nil, r.err
+			}
+			failed = append(failed, FileError{Path: file, Err: r.err})
 			continue
 		}
-
-		ignore := false
-		for _, pat := range ignorePatterns {
-			if strings.Contains(file, pat) {
-				ignore = true
-				break
+		if r.binary {
+			continue
+		}
+		hunks[file] = r.hunks
+		for commitID, commit := range r.commits {
+			if _, present := commits[commitID]; !present {
+				commits[commitID] = commit
 			}
 		}
-		if ignore {
-			continue
+	}
+
+	if failed != nil {
+		fileErrs := &FileErrors{Files: failed}
+		if maxFailed >= 0 && len(failed) > maxFailed {
+			fileErrs.Aborted = true
+			return nil, nil, fileErrs
 		}
+		return hunks, commits, fileErrs
+	}
+	return hunks, commits, nil
+}
 
-		tSleep := time.Millisecond * 50
-		time.Sleep(tSleep)
-		logf("[% 4d/%d %.1f%% %s/file] BlameFile %s %s", i, len(files), float64(i)/float64(len(files))*100, time.Since(t0.Add(tSleep))/time.Duration(i+1), repoPath, file)
+// fileResult is the blame of one of the files passed to forEachFile.
+type fileResult struct {
+	hunks   []Hunk
+	commits map[string]Commit
+	err     error
+	binary  bool
+}
 
-		fileHunks, commits2, err := BlameFile(repoPath, file, v)
-		if err != nil {
-			return nil, nil, err
+// forEachFile blames files using up to opt.Workers concurrent calls to
+// blameFile, and calls fn with the index and result of each file as soon
+// as it's done, from one goroutine at a time. Files are started in order.
+// Once fn returns an error, no more files are started, but fn is still
+// called for the files that were already started; forEachFile then
+// returns ctx.Err() if ctx is done, or else the first error that fn
+// returned.
+func forEachFile(ctx context.Context, blameFile blameFileFunc, repoPath string, files []string, v string, opt *BlameOptions, fn func(i int, r fileResult) error) error {
+	workers := runtime.GOMAXPROCS(0)
+	var throttle <-chan time.Time
+	if opt != nil {
+		if opt.Workers > 0 {
+			workers = opt.Workers
+		}
+		if opt.Throttle > 0 {
+			ticker := time.NewTicker(opt.Throttle)
+			defer ticker.Stop()
+			throttle = ticker.C
 		}
+	}
 
-		func() {
-			m.Lock()
-			defer m.Unlock()
-			hunks[file] = fileHunks
-			for commitID, commit := range commits2 {
-				if _, present := commits[commitID]; !present {
-					commits[commitID] = commit
+	type indexedResult struct {
+		i int
+		fileResult
+	}
+	var (
+		jobs    = make(chan int)
+		results = make(chan indexedResult)
+		failed  = make(chan struct{}) // closed when fn fails
+		wg      sync.WaitGroup
+	)
+	t0 := time.Now()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var r fileResult
+				r.hunks, r.commits, r.err = blameFile(ctx, repoPath, files[i], v, opt)
+				if errors.Is(r.err, ErrBinaryFile) {
+					r.err, r.binary = nil, true
 				}
+				results <- indexedResult{i, r}
 			}
 		}()
 	}
-
-	return hunks, commits, nil
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var fnErr error
+	go func() {
+		defer close(jobs)
+		for i := range files {
+			if throttle != nil && i > 0 {
+				select {
+				case <-throttle:
+				case <-failed:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case jobs <- i:
+			case <-failed:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	nDone := 0
+	for r := range results {
+		nDone++
+		logDebug("blamed file", "repo", repoPath, "file", files[r.i], "done", nDone, "total", len(files), "perFile", time.Since(t0)/time.Duration(nDone))
+		if err := fn(r.i, r.fileResult); err != nil && fnErr == nil {
+			fnErr = err
+			close(failed)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fnErr
 }
 
 // Note: filePath should be absolute or relative to repoPath
 func BlameGitFile(repoPath string, filePath string, v string) ([]Hunk, map[string]Commit, error) {
-	cmd := exec.Command("git", "blame", "-w", "--porcelain", v, "--", filePath)
-	cmd.Dir = repoPath
-	cmd.Stderr = os.Stderr
-	out, err := cmd.Output()
+	return BlameGitFileContext(context.Background(), repoPath, filePath, v, nil)
+}
+
+func BlameGitFileContext(ctx context.Context, repoPath string, filePath string, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	opt, cleanup, err := prepareGitOptions(ctx, repoPath, v, opt)
 	if err != nil {
 		return nil, nil, err
 	}
-	if len(out) < 1 {
-		// go 1.8.5 changed the behavior of `git blame` on empty files.
-		// previously, it returned a boundary commit. now, it returns nothing.
-		// TODO(sqs) TODO(beyang): make `git blame` return the boundary commit
-		// on an empty file somehow, or come up with some other workaround.
-		st, err := os.Stat(filepath.Join(repoPath, filePath))
-		if err == nil && st.Size() == 0 {
-			return nil, nil, nil
-		}
-		return nil, nil, fmt.Errorf("Expected git output of length at least 1")
+	defer cleanup()
+	hunks, commits, err := blameGitFile(ctx, repoPath, filePath, v, opt)
+	if err != nil {
+		return nil, nil, err
 	}
+	if err := addGitCommitDetails(ctx, repoPath, commits); err != nil {
+		return nil, nil, err
+	}
+	return hunks, commits, nil
+}
 
-	commits := make(map[string]Commit)
-	hunks := make([]Hunk, 0)
-	remainingLines := strings.Split(string(out[:len(out)-1]), "\n")
-	charOffset := 0
-	for len(remainingLines) > 0 {
-		// Consume hunk
-		hunkHeader := strings.Split(remainingLines[0], " ")
-		if len(hunkHeader) != 4 {
-			fmt.Printf("Remaining lines: %+v, %d, '%s'\n", remainingLines, len(remainingLines), remainingLines[0])
-			return nil, nil, fmt.Errorf("Expected at least 4 parts to hunkHeader, but got: '%s'", hunkHeader)
-		}
-		commitID := hunkHeader[0]
-		lineNoCur, _ := strconv.Atoi(hunkHeader[2])
-		nLines, _ := strconv.Atoi(hunkHeader[3])
-		hunk := Hunk{
-			CommitID:  commitID,
-			LineStart: int(lineNoCur) - 1,
-			LineEnd:   int(lineNoCur + nLines - 1),
-			CharStart: charOffset,
-		}
-
-		if _, in := commits[commitID]; in {
-			// Already seen commit
-			charOffset += len(remainingLines[1])
-			remainingLines = remainingLines[2:]
-		} else {
-			// New commit
-			author := strings.Join(strings.Split(remainingLines[1], " ")[1:], " ")
-			email := strings.Join(strings.Split(remainingLines[2], " ")[1:], " ")
-			if len(email) >= 2 && email[0] == '<' && email[len(email)-1] == '>' {
-				email = email[1 : len(email)-1]
-			}
-			authorTime, err := strconv.ParseInt(strings.Join(strings.Split(remainingLines[3], " ")[1:], " "), 10, 64)
-			if err != nil {
-				return nil, nil, fmt.Errorf("Failed to parse author-time %q", remainingLines[3])
-			}
-			summary := strings.Join(strings.Split(remainingLines[9], " ")[1:], " ")
-			commit := Commit{
-				ID:      commitID,
-				Message: summary,
-				Author: Author{
-					Name:  author,
-					Email: email,
-				},
-				AuthorDate: time.Unix(authorTime, 0),
-			}
-
-			if len(remainingLines) >= 13 && strings.HasPrefix(remainingLines[10], "previous ") {
-				charOffset += len(remainingLines[12])
-				remainingLines = remainingLines[13:]
-			} else if len(remainingLines) >= 13 && remainingLines[10] == "boundary" {
-				charOffset += len(remainingLines[12])
-				remainingLines = remainingLines[13:]
-			} else if len(remainingLines) >= 12 {
-				charOffset += len(remainingLines[11])
-				remainingLines = remainingLines[12:]
-			} else if len(remainingLines) == 11 {
-				// Empty file
-				remainingLines = remainingLines[11:]
-			} else {
-				return nil, nil, fmt.Errorf("Unexpected number of remaining lines (%d):\n%s", len(remainingLines), "  "+strings.Join(remainingLines, "\n  "))
-			}
+// blameGitFile blames a file using git blame. opt must have been prepared
+// with prepareGitOptions. Only the IDs of the returned commits should be
+// used; addGitCommitDetails reads the commits themselves.
+func blameGitFile(ctx context.Context, repoPath string, filePath string, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	return cachedBlameGitFile(ctx, repoPath, filePath, v, opt)
+}
 
-			commits[commitID] = commit
+// blameGitFileRange is like blameGitFile, but if r is non-nil, it only
+// blames the lines that r selects.
+func blameGitFileRange(ctx context.Context, repoPath string, filePath string, v string, r *Range, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	// git blame -L numbers the hunks' lines in the whole file, but their
+	// characters from the start of the range.
+	var charOffset int
+	if r != nil {
+		var err error
+		charOffset, err = gitLineOffset(ctx, repoPath, filePath, v, r.Start)
+		if err == errPastEnd {
+			// git blame -L fails if the range starts past the end, but
+			// there is simply nothing to blame.
+			return nil, nil, nil
 		}
-
-		// Consume remaining lines in hunk
-		for i := 1; i < nLines; i++ {
-			charOffset += len(remainingLines[1])
-			remainingLines = remainingLines[2:]
+		if err != nil {
+			return nil, nil, err
 		}
-
-		hunk.CharEnd = charOffset
-		hunks = append(hunks, hunk)
 	}
 
-	return hunks, commits, nil
-}
-
-// Note: filePath should be absolute or relative to repoPath
-func BlameHgFile(repoPath string, filePath string, v string) ([]Hunk, map[string]Commit, error) {
-	// write script to temp file
-	tmpfile, err := ioutil.TempFile("", "hg-repo-annotate.py")
-	if err != nil {
-		return nil, nil, err
+	var (
+		hunks   []Hunk
+		commits map[string]Commit
+		binary  bool
+		err     error
+	)
+	if opt.ignoresRevs() {
+		hunks, commits, binary, err = blameGitFileIgnoringRevs(ctx, repoPath, filePath, v, r, charOffset, opt)
+	} else {
+		hunks, commits, binary, err = blameGitFilePorcelain(ctx, repoPath, filePath, v, r, charOffset, opt)
 	}
-	defer os.Remove(tmpfile.Name())
-	_, err = io.WriteString(tmpfile, hgRepoAnnotatePy)
 	if err != nil {
+		if r != nil && errors.Is(err, errPastEnd) {
+			// An empty file has no line 0, which gitLineOffset doesn't
+			// check.
+			return nil, nil, nil
+		}
 		return nil, nil, err
 	}
+	if binary {
+		return nil, nil, fileError(ErrBinaryFile, filePath, v)
+	}
 
-	cmd := exec.Command("python", tmpfile.Name(), repoPath, v, filePath)
-	cmd.Dir = repoPath
-	cmd.Stderr = os.Stderr
+	if len(hunks) == 0 {
+		// go 1.8.5 changed the behavior of `git blame` on empty files.
+		// previously, it returned a boundary commit. now, it returns nothing.
+		// TODO(sqs) TODO(beyang): make `git blame` return the boundary commit
+		// on an empty file somehow, or come up with some other workaround.
+		return nil, nil, nil
+	}
+
+	return hunks, commits, nil
+}
+
+// blameGitFilePorcelain runs git blame --porcelain for blameGitFileRange.
+// binary is true if the file is binary.
+func blameGitFilePorcelain(ctx context.Context, repoPath string, filePath string, v string, r *Range, charOffset int, opt *BlameOptions) (hunks []Hunk, commits map[string]Commit, binary bool, err error) {
+	args := append([]string{"blame", "--porcelain"}, opt.gitArgs()...)
+	args = append(args, r.gitArgs()...)
+	args = append(args, v, "--", filePath)
+	cmd := command(ctx, repoPath, "git", args...)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, false, err
 	}
-
-	in := bufio.NewReader(stdout)
 	if err := cmd.Start(); err != nil {
-		return nil, nil, err
+		return nil, nil, false, commandErr(ctx, cmd, err)
 	}
 
-	var data hgRepoAnnotatOutputFormat
-	err = json.NewDecoder(in).Decode(&data)
-	if err != nil {
-		return nil, nil, err
+	hunks = make([]Hunk, 0)
+	p := newPorcelainParser(stdout)
+	p.charOffset = charOffset
+	for {
+		hunk, err := p.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil, nil, false, contextErr(ctx, err)
+		}
+		hunks = append(hunks, hunk)
+	}
+	if err := commandErr(ctx, cmd, cmd.Wait()); err != nil {
+		return nil, nil, false, err
 	}
-	return data.Hunks[filePath], data.Commits, nil
+	return hunks, p.commits, p.binary, nil
 }
@@ -24,16 +24,24 @@ var expHunksHg = map[string][]Hunk{
 
 var expCommitsHg = map[string]Commit{
 	"b73a873eeb8a": {
-		ID:         "b73a873eeb8a",
-		Message:    "add qux",
-		Author:     Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
-		AuthorDate: mustParseTime("Mon Dec 03 01:40:43 2013 -0800"),
+		ID:            "b73a873eeb8a",
+		Message:       "add qux",
+		Summary:       "add qux",
+		Author:        Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
+		Committer:     Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
+		AuthorDate:    mustParseTime("Mon Dec 03 01:40:43 2013 -0800"),
+		CommitterDate: mustParseTime("Mon Dec 03 01:40:43 2013 -0800"),
+		Parents:       []string{"d14ec9caa006"},
 	},
 	"c84bb8d093f2": {
-		ID:         "c84bb8d093f2",
-		Message:    "add empty file",
-		Author:     Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
-		AuthorDate: mustParseTime("Mon Dec 02 03:31:13 2013 -0800"),
+		ID:            "c84bb8d093f2",
+		Message:       "add empty file",
+		Summary:       "add empty file",
+		Author:        Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
+		Committer:     Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
+		AuthorDate:    mustParseTime("Mon Dec 02 03:31:13 2013 -0800"),
+		CommitterDate: mustParseTime("Mon Dec 02 03:31:13 2013 -0800"),
+		Parents:       []string{"d047adf8d7ff"},
 	},
 	// "bcc18e469216": {
 	// 	ID:         "bcc18e469216",
@@ -48,22 +56,33 @@ var expCommitsHg = map[string]Commit{
 	// 	AuthorDate: mustParseTime("Sat Jun 01 19:40:15 2013 -0700"),
 	// },
 	"d047adf8d7ff": {
-		ID:         "d047adf8d7ff",
-		Message:    "foo",
-		Author:     Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
-		AuthorDate: mustParseTime("Sat Jun 01 19:39:51 2013 -0700"),
+		ID:            "d047adf8d7ff",
+		Message:       "foo",
+		Summary:       "foo",
+		Author:        Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
+		Committer:     Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
+		AuthorDate:    mustParseTime("Sat Jun 01 19:39:51 2013 -0700"),
+		CommitterDate: mustParseTime("Sat Jun 01 19:39:51 2013 -0700"),
 	},
 	"52f96eab35cf": {
-		ID:         "52f96eab35cf",
-		Message:    "append",
-		Author:     Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
-		AuthorDate: mustParseTime("Mon Dec 02 05:14:51 2013 -0800"),
+		ID:            "52f96eab35cf",
+		Message:       "append",
+		Summary:       "append",
+		Author:        Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
+		Committer:     Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
+		AuthorDate:    mustParseTime("Mon Dec 02 05:14:51 2013 -0800"),
+		CommitterDate: mustParseTime("Mon Dec 02 05:14:51 2013 -0800"),
+		Parents:       []string{"c84bb8d093f2"},
 	},
 	"d14ec9caa006": {
-		ID:         "d14ec9caa006",
-		Message:    "interleave",
-		Author:     Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
-		AuthorDate: mustParseTime("Mon Dec 02 05:16:51 2013 -0800"),
+		ID:            "d14ec9caa006",
+		Message:       "interleave",
+		Summary:       "interleave",
+		Author:        Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
+		Committer:     Author{Name: "Quinn Slack", Email: "qslack@qslack.com"},
+		AuthorDate:    mustParseTime("Mon Dec 02 05:16:51 2013 -0800"),
+		CommitterDate: mustParseTime("Mon Dec 02 05:16:51 2013 -0800"),
+		Parents:       []string{"52f96eab35cf"},
 	},
 }
 
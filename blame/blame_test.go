@@ -1,6 +1,9 @@
 package blame
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -25,40 +28,63 @@ var expHunks = map[string][]Hunk{
 
 var expCommits = map[string]Commit{
 	"26e6e00a6bfd5430a5a8840a543465dc8cac801e": {
-		ID:         "26e6e00a6bfd5430a5a8840a543465dc8cac801e",
-		Message:    "initial commit",
-		Author:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
-		AuthorDate: mustParseTime("Mon Oct 7 18:13:58 2013 -0700"),
+		ID:            "26e6e00a6bfd5430a5a8840a543465dc8cac801e",
+		Message:       "initial commit",
+		Summary:       "initial commit",
+		Author:        Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+		Committer:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+		AuthorDate:    mustParseTime("Mon Oct 7 18:13:58 2013 -0700"),
+		CommitterDate: mustParseTime("Mon Oct 7 18:13:58 2013 -0700"),
 	},
 	"c497236203ba6400272034a9db7be00859c9863d": {
-		ID:         "c497236203ba6400272034a9db7be00859c9863d",
-		Message:    "revision",
-		Author:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
-		AuthorDate: mustParseTime("Mon Oct 7 18:14:46 2013 -0700"),
+		ID:            "c497236203ba6400272034a9db7be00859c9863d",
+		Message:       "revision",
+		Summary:       "revision",
+		Author:        Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+		Committer:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+		AuthorDate:    mustParseTime("Mon Oct 7 18:14:46 2013 -0700"),
+		CommitterDate: mustParseTime("Mon Oct 7 18:14:46 2013 -0700"),
+		Parents:       []string{"26e6e00a6bfd5430a5a8840a543465dc8cac801e"},
 	},
 	"7653ddfbc69a584272a18fe5e675b95025e84bb9": {
-		ID:         "7653ddfbc69a584272a18fe5e675b95025e84bb9",
-		Message:    "modify imports",
-		Author:     Author{Name: "Ricky Bobby", Email: "ricky@bobby.com"},
-		AuthorDate: mustParseTime("Mon Oct 7 19:00:15 2013 -0700"),
+		ID:            "7653ddfbc69a584272a18fe5e675b95025e84bb9",
+		Message:       "modify imports",
+		Summary:       "modify imports",
+		Author:        Author{Name: "Ricky Bobby", Email: "ricky@bobby.com"},
+		Committer:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+		AuthorDate:    mustParseTime("Mon Oct 7 19:00:15 2013 -0700"),
+		CommitterDate: mustParseTime("Mon Oct 7 19:00:15 2013 -0700"),
+		Parents:       []string{"c497236203ba6400272034a9db7be00859c9863d"},
 	},
 	"d858245d0690b83df437ad830ab1e971d389d68d": {
-		ID:         "d858245d0690b83df437ad830ab1e971d389d68d",
-		Message:    "add import",
-		Author:     Author{Name: "Sam Hamilton", Email: "sam@salinas.com"},
-		AuthorDate: mustParseTime("Tue Oct 8 09:29:12 2013 -0700"),
+		ID:            "d858245d0690b83df437ad830ab1e971d389d68d",
+		Message:       "add import",
+		Summary:       "add import",
+		Author:        Author{Name: "Sam Hamilton", Email: "sam@salinas.com"},
+		Committer:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+		AuthorDate:    mustParseTime("Tue Oct 8 09:29:12 2013 -0700"),
+		CommitterDate: mustParseTime("Tue Oct 8 09:29:12 2013 -0700"),
+		Parents:       []string{"7653ddfbc69a584272a18fe5e675b95025e84bb9"},
 	},
 	"496529633d7c1e8359db63aa3d297359479479ff": {
-		ID:         "496529633d7c1e8359db63aa3d297359479479ff",
-		Message:    "trailing newline",
-		Author:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
-		AuthorDate: mustParseTime("Thu Oct 10 13:59:56 2013 -0700"),
+		ID:            "496529633d7c1e8359db63aa3d297359479479ff",
+		Message:       "trailing newline",
+		Summary:       "trailing newline",
+		Author:        Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+		Committer:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+		AuthorDate:    mustParseTime("Thu Oct 10 13:59:56 2013 -0700"),
+		CommitterDate: mustParseTime("Thu Oct 10 13:59:56 2013 -0700"),
+		Parents:       []string{"d858245d0690b83df437ad830ab1e971d389d68d"},
 	},
 	"ba4f3f4147a2843eb88712b450ea28ec221f3490": {
-		ID:         "ba4f3f4147a2843eb88712b450ea28ec221f3490",
-		Message:    "empty file",
-		Author:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
-		AuthorDate: mustParseTime("Fri Oct 11 18:28:10 2013 -0700"),
+		ID:            "ba4f3f4147a2843eb88712b450ea28ec221f3490",
+		Message:       "empty file",
+		Summary:       "empty file",
+		Author:        Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+		Committer:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+		AuthorDate:    mustParseTime("Fri Oct 11 18:28:10 2013 -0700"),
+		CommitterDate: mustParseTime("Fri Oct 11 18:28:10 2013 -0700"),
+		Parents:       []string{"496529633d7c1e8359db63aa3d297359479479ff"},
 	},
 }
 
@@ -110,10 +136,14 @@ func TestBlameEmptyFile(t *testing.T) {
 	expHunks := []Hunk{{CommitID: "ba4f3f4147a2843eb88712b450ea28ec221f3490", LineStart: 0, LineEnd: 0, CharStart: 0, CharEnd: 0}}
 	expCommits := map[string]Commit{
 		"ba4f3f4147a2843eb88712b450ea28ec221f3490": {
-			ID:         "ba4f3f4147a2843eb88712b450ea28ec221f3490",
-			Message:    "empty file",
-			Author:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
-			AuthorDate: mustParseTime("Fri Oct 11 18:28:10 2013 -0700"),
+			ID:            "ba4f3f4147a2843eb88712b450ea28ec221f3490",
+			Message:       "empty file",
+			Summary:       "empty file",
+			Author:        Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+			Committer:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+			AuthorDate:    mustParseTime("Fri Oct 11 18:28:10 2013 -0700"),
+			CommitterDate: mustParseTime("Fri Oct 11 18:28:10 2013 -0700"),
+			Parents:       []string{"496529633d7c1e8359db63aa3d297359479479ff"},
 		},
 	}
 	if !reflect.DeepEqual(expHunks, hunks) {
@@ -124,6 +154,45 @@ func TestBlameEmptyFile(t *testing.T) {
 	}
 }
 
+func TestBlameGitFile_committer(t *testing.T) {
+	r := newTestGitRepo(t)
+	c1 := r.commit(testCommit{author: "A <a@example.com>", date: "Mon Jan 6 10:00:00 2014 -0800", message: "add f\n\nDetails.", files: map[string]string{"f": "a\n"}})
+	c2 := r.commit(testCommit{
+		author: "B <b@example.com>", date: "Tue Jan 7 11:00:00 2014 +0100",
+		committer: "C <c@example.com>", commitDate: "Wed Jan 8 12:30:00 2014 +0530",
+		message: "change f", files: map[string]string{"f": "a\nb\n"},
+	})
+
+	_, commits, err := BlameGitFile(r.dir, "f", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Commit{
+		c1: {
+			ID:            c1,
+			Message:       "add f\n\nDetails.",
+			Summary:       "add f",
+			Author:        Author{Name: "A", Email: "a@example.com"},
+			Committer:     Author{Name: "A", Email: "a@example.com"},
+			AuthorDate:    mustParseTime("Mon Jan 6 10:00:00 2014 -0800"),
+			CommitterDate: mustParseTime("Mon Jan 6 10:00:00 2014 -0800"),
+		},
+		c2: {
+			ID:            c2,
+			Message:       "change f",
+			Summary:       "change f",
+			Author:        Author{Name: "B", Email: "b@example.com"},
+			Committer:     Author{Name: "C", Email: "c@example.com"},
+			AuthorDate:    mustParseTime("Tue Jan 7 11:00:00 2014 +0100"),
+			CommitterDate: mustParseTime("Wed Jan 8 12:30:00 2014 +0530"),
+			Parents:       []string{c1},
+		},
+	}
+	if !reflect.DeepEqual(commits, want) {
+		t.Errorf("got commits %+v, want %+v", commits, want)
+	}
+}
+
 func mustParseTime(s string) time.Time {
 	gitDateFormat := "Mon Jan 2 15:04:05 2006 -0700"
 	t, err := time.Parse(gitDateFormat, s)
@@ -132,3 +201,150 @@ func mustParseTime(s string) time.Time {
 	}
 	return t
 }
+
+// seqBackend blames every file as a single hunk from a commit named after
+// the file, failing for files listed in fail.
+type seqBackend struct {
+	testBackend
+	fail map[string]bool
+}
+
+func (b seqBackend) BlameFile(ctx context.Context, repoPath, filePath, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	if b.fail[filePath] {
+		return nil, nil, errors.New("failed " + filePath)
+	}
+	id := "c-" + filePath
+	return []Hunk{{CommitID: id, LineStart: 0, LineEnd: 1}}, map[string]Commit{id: {ID: id}, "shared": {ID: "shared"}}, nil
+}
+
+func TestBlameFiles(t *testing.T) {
+	var files []string
+	for i := 0; i < 50; i++ {
+		files = append(files, fmt.Sprintf("f%d", i), "vendor/"+fmt.Sprintf("f%d", i))
+	}
+
+	hunks, commits, err := blameFiles(context.Background(), seqBackend{}.BlameFile, "", files, "v", []string{"vendor/"}, &BlameOptions{Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hunks) != 50 || len(commits) != 51 {
+		t.Errorf("got %d files and %d commits, want 50 and 51", len(hunks), len(commits))
+	}
+	for file, fileHunks := range hunks {
+		if strings.HasPrefix(file, "vendor/") {
+			t.Errorf("ignored file %s was blamed", file)
+		}
+		if len(fileHunks) != 1 || fileHunks[0].CommitID != "c-"+file {
+			t.Errorf("got hunks %+v for %s", fileHunks, file)
+		}
+	}
+
+	failing := seqBackend{fail: map[string]bool{"f7": true, "f30": true}}
+	_, _, err = blameFiles(context.Background(), failing.BlameFile, "", files, "v", nil, nil)
+	if err == nil || err.Error() != "failed f7" {
+		t.Errorf("got error %v, want failed f7", err)
+	}
+
+	// With a failure budget, the other files are blamed.
+	for _, max := range []int{2, -1} {
+		hunks, _, err = blameFiles(context.Background(), failing.BlameFile, "", files, "v", []string{"vendor/"}, &BlameOptions{MaxFailedFiles: max})
+		var fileErrs *FileErrors
+		if !errors.As(err, &fileErrs) || fileErrs.Aborted || len(fileErrs.Files) != 2 || fileErrs.Files[0].Path != "f7" || fileErrs.Files[1].Path != "f30" {
+			t.Errorf("MaxFailedFiles %d: got error %v, want f7 and f30 to fail", max, err)
+		}
+		if _, ok := hunks["f7"]; len(hunks) != 48 || ok {
+			t.Errorf("MaxFailedFiles %d: got %d files, want the 48 that didn't fail", max, len(hunks))
+		}
+	}
+	hunks, commits, err = blameFiles(context.Background(), failing.BlameFile, "", files, "v", nil, &BlameOptions{MaxFailedFiles: 1})
+	var fileErrs *FileErrors
+	if !errors.As(err, &fileErrs) || !fileErrs.Aborted || hunks != nil || commits != nil {
+		t.Errorf("MaxFailedFiles 1: got %d files and error %v, want blaming to be aborted", len(hunks), err)
+	}
+}
+
+// blockingBackend blocks in BlameFile until ctx is done.
+type blockingBackend struct {
+	testBackend
+	started chan struct{}
+}
+
+func (b blockingBackend) BlameFile(ctx context.Context, repoPath, filePath, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	b.started <- struct{}{}
+	<-ctx.Done()
+	return nil, nil, ctx.Err()
+}
+
+func TestBlameFiles_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := blockingBackend{started: make(chan struct{}, 3)}
+	go func() {
+		<-b.started
+		cancel()
+	}()
+	_, _, err := blameFiles(ctx, b.BlameFile, "", []string{"a", "b", "c"}, "v", nil, nil)
+	if err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestBlameFiles_Throttle(t *testing.T) {
+	// The first file is started right away; the next ones wait.
+	ctx, cancel := context.WithCancel(context.Background())
+	b := blockingBackend{started: make(chan struct{}, 3)}
+	go func() {
+		<-b.started
+		cancel()
+	}()
+	_, _, err := blameFiles(ctx, b.BlameFile, "", []string{"a", "b", "c"}, "v", nil, &BlameOptions{Throttle: time.Hour})
+	if err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if n := len(b.started); n != 0 {
+		t.Errorf("got %d more files started, want 0", n)
+	}
+}
+
+func TestBlameGitFileContext_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := BlameGitFileContext(ctx, testRepoDir, "goblametest.txt", "HEAD", nil)
+	if err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestBlameOptions_gitArgs(t *testing.T) {
+	tests := []struct {
+		opt  *BlameOptions
+		want []string
+	}{
+		{nil, []string{"-w"}},
+		{&BlameOptions{NoIgnoreWhitespace: true}, nil},
+		{&BlameOptions{DetectMoves: true, MoveScore: 30}, []string{"-w", "-M30"}},
+		{&BlameOptions{DetectCopies: 2}, []string{"-w", "-C", "-C"}},
+		{&BlameOptions{DetectMoves: true, DetectCopies: 5, CopyScore: 50}, []string{"-w", "-M", "-C50", "-C50", "-C50"}},
+	}
+	for _, test := range tests {
+		if got := test.opt.gitArgs(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got %q, want %q", test.opt, got, test.want)
+		}
+	}
+}
+
+func TestBlameOptions_hgArgs(t *testing.T) {
+	tests := []struct {
+		opt  *BlameOptions
+		want []string
+	}{
+		{nil, nil},
+		{&BlameOptions{}, nil},
+		{&BlameOptions{NoIgnoreWhitespace: true}, nil},
+		{&BlameOptions{HgIgnoreWhitespace: true}, []string{"--ignore-all-space"}},
+	}
+	for _, test := range tests {
+		if got := test.opt.hgArgs(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got %q, want %q", test.opt, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+package blame
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Cache stores the results of blaming files, so that they don't have to
+// be blamed again. It must be safe for concurrent use.
+type Cache interface {
+	// Get returns the data stored for key, if any.
+	Get(key string) ([]byte, bool)
+
+	// Set stores data for key. It may evict other entries to make room,
+	// or not store data at all.
+	Set(key string, data []byte)
+}
+
+// BlameCache, if non-nil, is consulted before blaming a whole file with
+// git (by BlameGitFile, BlameGitRepository and the git backend), and
+// stores the results of blaming files that aren't in it yet. The hg and
+// puregit backends don't use it.
+//
+// A file's blame is cached by the last commit (reachable from the blamed
+// revision) that changed it, its path and contents, and the blame
+// options, so it is reused when blaming later revisions in which the file
+// is unchanged. Files aren't cached if opt.IgnoreRevs names commits by
+// anything other than their full IDs.
+var BlameCache Cache
+
+// NewMemoryCache returns a Cache that keeps up to maxBytes of data (and
+// keys) in memory, evicting the least recently used entries first.
+func NewMemoryCache(maxBytes int64) Cache {
+	return &memoryCache{maxBytes: maxBytes, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+type memoryCache struct {
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *memoryCacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	key  string
+	data []byte
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*memoryCacheEntry).data, true
+}
+
+func (c *memoryCache) Set(key string, data []byte) {
+	size := int64(len(key) + len(data))
+	if size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	c.entries[key] = c.lru.PushFront(&memoryCacheEntry{key, data})
+	c.size += size
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *memoryCache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*memoryCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.key) + len(entry.data))
+}
+
+// NewDiskCache returns a Cache that stores up to maxBytes of data in
+// files in dir, which is created if it doesn't exist. When it's full, the
+// least recently used files are removed first; their modification times
+// record when they were last used, so the order survives restarts. Several
+// processes may share dir, but each only counts the files that were there
+// when it started and the ones it added itself toward maxBytes.
+func NewDiskCache(dir string, maxBytes int64) (Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(fis, func(i, j int) bool { return fis[i].ModTime().After(fis[j].ModTime()) })
+
+	c := &diskCache{dir: dir, maxBytes: maxBytes, lru: list.New(), entries: make(map[string]*list.Element)}
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		c.entries[fi.Name()] = c.lru.PushBack(&diskCacheEntry{fi.Name(), fi.Size()})
+		c.size += fi.Size()
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+type diskCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *diskCacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type diskCacheEntry struct {
+	name string
+	size int64
+}
+
+// fileName returns the name of the file that stores key's data. Keys are
+// hashed, so that any string can be used as a key.
+func (c *diskCache) fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *diskCache) Get(key string) ([]byte, bool) {
+	name := c.fileName(key)
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(filepath.Join(c.dir, name), now, now)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[name]; ok {
+		c.lru.MoveToFront(e)
+	} else {
+		// Another process added it.
+		c.entries[name] = c.lru.PushFront(&diskCacheEntry{name, int64(len(data))})
+		c.size += int64(len(data))
+		c.evict()
+	}
+	return data, true
+}
+
+func (c *diskCache) Set(key string, data []byte) {
+	if int64(len(data)) > c.maxBytes {
+		return
+	}
+	name := c.fileName(key)
+
+	// Write to a temporary file and rename it, so that readers never see
+	// part of the data.
+	tmpfile, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		logWarn("blame cache failed", "err", err)
+		return
+	}
+	_, err = tmpfile.Write(data)
+	if closeErr := tmpfile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpfile.Name(), filepath.Join(c.dir, name))
+	}
+	if err != nil {
+		os.Remove(tmpfile.Name())
+		logWarn("blame cache failed", "err", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[name]; ok {
+		entry := c.lru.Remove(e).(*diskCacheEntry)
+		c.size -= entry.size
+	}
+	c.entries[name] = c.lru.PushFront(&diskCacheEntry{name, int64(len(data))})
+	c.size += int64(len(data))
+	c.evict()
+}
+
+// evict removes the least recently used files until the cache's size is
+// at most maxBytes. c.mu must be held.
+func (c *diskCache) evict() {
+	for c.size > c.maxBytes {
+		entry := c.lru.Remove(c.lru.Back()).(*diskCacheEntry)
+		delete(c.entries, entry.name)
+		c.size -= entry.size
+		if err := os.Remove(filepath.Join(c.dir, entry.name)); err != nil && !os.IsNotExist(err) {
+			logWarn("blame cache failed", "err", err)
+		}
+	}
+}
+
+// cachedBlameGitFile is like blameGitFileRange with a nil range, but
+// consults BlameCache first, and stores the result in it.
+func cachedBlameGitFile(ctx context.Context, repoPath, filePath, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	cache := BlameCache
+	if cache == nil {
+		return blameGitFileRange(ctx, repoPath, filePath, v, nil, opt)
+	}
+	key, err := gitCacheKey(ctx, repoPath, filePath, v, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if key != "" {
+		if data, ok := cache.Get(key); ok {
+			var hunks []Hunk
+			err := json.Unmarshal(data, &hunks)
+			if err == nil {
+				if len(hunks) == 0 {
+					// As blameGitFileRange returns for an empty file.
+					return nil, nil, nil
+				}
+				commits := make(map[string]Commit)
+				for _, h := range hunks {
+					commits[h.CommitID] = Commit{ID: h.CommitID}
+				}
+				return hunks, commits, nil
+			}
+			logWarn("bad blame cache entry", "repo", repoPath, "file", filePath, "err", err)
+		}
+	}
+
+	hunks, commits, err := blameGitFileRange(ctx, repoPath, filePath, v, nil, opt)
+	if err == nil && key != "" {
+		data, err := json.Marshal(hunks)
+		if err != nil {
+			return nil, nil, err
+		}
+		cache.Set(key, data)
+	}
+	return hunks, commits, err
+}
+
+// gitCacheKey returns the key under which BlameCache stores the blame of a
+// file at revision v, or "" if it can't be cached.
+//
+// git blame passes all of a file's lines to a parent in which it is
+// unchanged (the first such parent of a merge), as git rev-list's history
+// simplification does, so blaming a file at v gives the same result as
+// blaming it at the last commit that git rev-list -1 v -- file lists.
+// When blaming a repository, withGitBlobs finds those commits for all
+// files at once.
+func gitCacheKey(ctx context.Context, repoPath, filePath, v string, opt *BlameOptions) (string, error) {
+	uncached := func(err error) (string, error) {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		logWarn("blame cache key failed", "repo", repoPath, "file", filePath, "rev", v, "err", err)
+		return "", nil
+	}
+
+	h := sha256.New()
+	h.Write([]byte("go-blame git 3\x00"))
+
+	// The blob and full path (relative to the top of the work tree).
+	entry, ok := "", false
+	if opt != nil {
+		entry, ok = opt.gitBlobs[filePath]
+	}
+	if !ok {
+		cmd := command(ctx, repoPath, "git", "ls-tree", "-z", "--full-name", v, "--", filePath)
+		out, err := cmd.Output()
+		if err = commandErr(ctx, cmd, err); err != nil {
+			return uncached(err)
+		}
+		entry = strings.TrimSuffix(string(out), "\x00")
+	}
+	if entry == "" {
+		// The file doesn't exist, which blaming it reports.
+		return "", ctx.Err()
+	}
+	h.Write([]byte(entry + "\x00"))
+
+	commit, ok := "", false
+	if opt != nil {
+		commit, ok = opt.gitLastCommits[filePath]
+	}
+	if !ok {
+		cmd := command(ctx, repoPath, "git", "rev-list", "-1", v, "--", filePath)
+		out, err := cmd.Output()
+		if err = commandErr(ctx, cmd, err); err != nil {
+			return uncached(err)
+		}
+		commit = strings.TrimSuffix(string(out), "\n")
+	}
+	if commit == "" {
+		return uncached(fmt.Errorf("no commit changed %s", filePath))
+	}
+	h.Write([]byte(commit + "\n"))
+
+	if opt != nil {
+		for _, rev := range opt.IgnoreRevs {
+			if len(rev) != 40 || !isHex(rev) {
+				// The key can't depend on what a revision name resolves
+				// to.
+				return "", nil
+			}
+		}
+		// The ignore-revs files are hashed by their contents, not their
+		// names.
+		files := append([]string{opt.IgnoreRevsFile, opt.revIgnoreRevsFile}, opt.configIgnoreRevsFiles...)
+		for _, file := range files {
+			if file == "" {
+				continue
+			}
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(repoPath, file)
+			}
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return uncached(err)
+			}
+			sum := sha256.Sum256(data)
+			h.Write([]byte("ignore-revs-file\x00"))
+			h.Write(sum[:])
+		}
+		copied := *opt
+		copied.IgnoreRevsFile, copied.revIgnoreRevsFile, copied.gitBlobs = "", "", nil
+		copied.configIgnoreRevsFiles, copied.gitLastCommits = nil, nil
+		opt = &copied
+	}
+	for _, arg := range opt.gitArgs() {
+		h.Write([]byte(arg + "\x00"))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// withGitBlobs returns a copy of opt that gives gitCacheKey the ls-tree
+// entries of a repository's files at revision v, as
+// listGitRepositoryBlobs returns them, and the last commits that changed
+// them (see gitLastCommits), so that it doesn't have to run git for each
+// file.
+func withGitBlobs(ctx context.Context, repoPath, v string, opt *BlameOptions, blobs map[string]string) (*BlameOptions, error) {
+	// ls-tree lists paths relative to repoPath, but the key has them
+	// relative to the top of the work tree, as ls-tree --full-name does.
+	cmd := command(ctx, repoPath, "git", "rev-parse", "--show-prefix")
+	out, err := cmd.Output()
+	if err = commandErr(ctx, cmd, err); err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(string(out), "\n")
+
+	var copied BlameOptions
+	if opt != nil {
+		copied = *opt
+	}
+	copied.gitBlobs = make(map[string]string, len(blobs))
+	for name, blob := range blobs {
+		copied.gitBlobs[name] = blob + "\t" + prefix + name
+	}
+	if copied.gitLastCommits, err = gitLastCommits(ctx, repoPath, v, prefix, blobs); err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
+// gitLastCommits returns the commits that git rev-list -1 v -- file lists
+// for the files of blobs (relative to repoPath, whose path relative to the
+// top of the work tree is prefix), by walking the history once. It
+// simulates rev-list's history simplification for each file: a commit in
+// which the file is unchanged is skipped, and from a merge in which it's
+// unchanged, only the first parent that has the same file is followed.
+// Files for which the walk doesn't find the commit are left out.
+func gitLastCommits(ctx context.Context, repoPath, v, prefix string, blobs map[string]string) (map[string]string, error) {
+	// -m lists a merge once for each parent (in order) that it differs
+	// from, or once if it's the same as all of them. The files are listed
+	// as -z --name-status pairs, after a header that is followed by a
+	// newline if there are any.
+	cmd := command(ctx, repoPath, "git", "log", "-m", "-z", "--format=%H %P", "--name-status", "--no-renames", "--no-show-signature", "--topo-order", v, "--")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, commandErr(ctx, cmd, err)
+	}
+
+	last := make(map[string]string, len(blobs))
+	waiting := make(map[string][]string) // files by the commit to check next
+	var (
+		commit  string
+		parents []string
+		changed []map[string]bool // the files changed from each parent
+	)
+	// visit moves the files waiting for commit to the parent they are
+	// unchanged in, or records commit as their last one.
+	visit := func() error {
+		files := waiting[commit]
+		delete(waiting, commit)
+		if len(files) == 0 {
+			return nil
+		}
+		if len(parents) > 1 && len(changed) != len(parents) {
+			// The merge is the same as some of its parents, which -m
+			// leaves out, so diff it against each of them.
+			changed = changed[:0]
+			for _, parent := range parents {
+				cmd := command(ctx, repoPath, "git", "diff-tree", "-r", "-z", "--name-only", "--no-renames", parent, commit, "--")
+				out, err := cmd.Output()
+				if err = commandErr(ctx, cmd, err); err != nil {
+					return err
+				}
+				m := make(map[string]bool)
+				for _, name := range strings.Split(string(out), "\x00") {
+					m[name] = true
+				}
+				changed = append(changed, m)
+			}
+		}
+	files:
+		for _, name := range files {
+			for i, parent := range parents {
+				if i >= len(changed) || !changed[i][prefix+name] {
+					waiting[parent] = append(waiting[parent], name)
+					continue files
+				}
+			}
+			last[name] = commit
+		}
+		return nil
+	}
+
+	br := bufio.NewReader(stdout)
+	for done := false; !done && len(last) < len(blobs); {
+		token, err := br.ReadString(0)
+		if err == io.EOF {
+			done = true
+		} else if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil, contextErr(ctx, err)
+		}
+		token = strings.TrimSuffix(token, "\x00")
+
+		switch {
+		case strings.HasPrefix(token, "\n") || len(token) == 1:
+			// A status, followed by a path.
+			name, err := br.ReadString(0)
+			if err != nil {
+				cmd.Process.Kill()
+				cmd.Wait()
+				return nil, contextErr(ctx, fmt.Errorf("unexpected git log output after %q: %v", token, err))
+			}
+			changed[len(changed)-1][strings.TrimSuffix(name, "\x00")] = true
+		case done || !strings.HasPrefix(token, commit+" "):
+			if commit != "" {
+				if err := visit(); err != nil {
+					cmd.Process.Kill()
+					cmd.Wait()
+					return nil, err
+				}
+			}
+			if done {
+				break
+			}
+			fields := strings.Split(strings.TrimSuffix(token, " "), " ")
+			if len(fields[0]) != 40 || !isHex(fields[0]) {
+				cmd.Process.Kill()
+				cmd.Wait()
+				return nil, fmt.Errorf("unexpected git log output: %q", token)
+			}
+			if commit == "" {
+				// The first commit is v's.
+				for name := range blobs {
+					waiting[fields[0]] = append(waiting[fields[0]], name)
+				}
+			}
+			commit, parents, changed = fields[0], fields[1:], changed[:0]
+			changed = append(changed, make(map[string]bool))
+		default:
+			// Another parent of the same merge.
+			changed = append(changed, make(map[string]bool))
+		}
+	}
+	if len(last) == len(blobs) {
+		// The rest of the history isn't needed.
+		cmd.Process.Kill()
+		cmd.Wait()
+		return last, nil
+	}
+	if err := commandErr(ctx, cmd, cmd.Wait()); err != nil {
+		return nil, err
+	}
+	return last, nil
+}
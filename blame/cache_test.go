@@ -0,0 +1,289 @@
+package blame
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	c := NewMemoryCache(30)
+	c.Set("a", []byte("123456789"))     // 10 bytes
+	c.Set("b", []byte("123456789"))     // 20
+	c.Set("c", []byte("123456789"))     // 30
+	c.Get("a")                          // b is now the least recently used
+	c.Set("d", []byte("123456789"))     // evicts b
+	c.Set("e", []byte("1234567890123")) // too big to store with the rest
+	c.Set("f", make([]byte, 30))        // too big to store at all
+
+	for key, want := range map[string]bool{"a": false, "b": false, "c": false, "d": true, "e": true, "f": false} {
+		if _, ok := c.Get(key); ok != want {
+			t.Errorf("%s: got present %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	c, err := NewDiskCache(dir, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("a", []byte("12345"))
+	c.Set("b", []byte("12345"))
+	c.Set("c", []byte("12345"))
+	c.Set("b", []byte("1234567890")) // replaces b
+	if data, ok := c.Get("b"); !ok || string(data) != "1234567890" {
+		t.Errorf("b: got %q, %v", data, ok)
+	}
+	c.Set("d", []byte("12345")) // evicts a
+	if _, ok := c.Get("a"); ok {
+		t.Error("a: got present, want evicted")
+	}
+
+	// Make b the least recently used file, and reopen the cache with a
+	// smaller size.
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, c.(*diskCache).fileName("b")), old, old)
+	c, err = NewDiskCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{"a": false, "b": false, "c": true, "d": true} {
+		if _, ok := c.Get(key); ok != want {
+			t.Errorf("%s: got present %v after reopening, want %v", key, ok, want)
+		}
+	}
+}
+
+// countingCache is a Cache that counts hits and misses.
+type countingCache struct {
+	Cache
+	mu           sync.Mutex
+	hits, misses int
+}
+
+func (c *countingCache) Get(key string) ([]byte, bool) {
+	data, ok := c.Cache.Get(key)
+	c.mu.Lock()
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	c.mu.Unlock()
+	return data, ok
+}
+
+func TestBlameCache(t *testing.T) {
+	r := newTestGitRepo(t)
+	a := "A <a@example.com>"
+	rev1 := r.commit(testCommit{author: a, date: "2014-01-01T00:00:00Z", message: "add", files: map[string]string{
+		"f": "a\nb\n",
+		"g": "a\n",
+	}})
+	rev2 := r.commit(testCommit{author: a, date: "2014-01-02T00:00:00Z", message: "change g", files: map[string]string{
+		"g": "a\nb\n",
+	}})
+
+	cache := &countingCache{Cache: NewMemoryCache(1 << 20)}
+	defer func(c Cache) { BlameCache = c }(BlameCache)
+
+	for i, test := range []struct {
+		file, v      string
+		hits, misses int
+	}{
+		{"f", rev1, 0, 1},
+		{"f", rev1, 1, 1},
+		{"f", rev2, 2, 1}, // f is unchanged in rev2
+		{"g", rev1, 2, 2},
+		{"g", rev2, 2, 3},
+		{"g", rev2, 3, 3},
+	} {
+		label := fmt.Sprintf("#%d %s at %s", i, test.file, test.v)
+		BlameCache = nil
+		wantHunks, wantCommits, err := BlameGitFile(r.dir, test.file, test.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		BlameCache = cache
+		hunks, commits, err := BlameGitFile(r.dir, test.file, test.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(hunks, wantHunks) || !reflect.DeepEqual(commits, wantCommits) {
+			t.Errorf("%s: got %+v, %+v, want %+v, %+v", label, hunks, commits, wantHunks, wantCommits)
+		}
+		if cache.hits != test.hits || cache.misses != test.misses {
+			t.Errorf("%s: got %d hits and %d misses, want %d and %d", label, cache.hits, cache.misses, test.hits, test.misses)
+		}
+	}
+
+	// Different options are cached separately.
+	BlameGitFileContext(context.Background(), r.dir, "f", rev1, &BlameOptions{NoIgnoreWhitespace: true})
+	if cache.misses != 4 {
+		t.Errorf("got %d misses with different options, want 4", cache.misses)
+	}
+}
+
+func TestBlameCache_repository(t *testing.T) {
+	r := newTestGitRepo(t)
+	rev := r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add", files: map[string]string{
+		"top":       "a\n",
+		"sub/f":     "a\nb\n",
+		"sub/empty": "",
+	}})
+	dir := filepath.Join(r.dir, "sub")
+
+	cache := &countingCache{Cache: NewMemoryCache(1 << 20)}
+	defer func(c Cache) { BlameCache = c }(BlameCache)
+
+	BlameCache = nil
+	wantHunks, wantCommits, err := BlameGitRepository(dir, rev, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	BlameCache = cache
+	for i := 0; i < 2; i++ {
+		hunks, commits, err := BlameGitRepository(dir, rev, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(hunks, wantHunks) || !reflect.DeepEqual(commits, wantCommits) {
+			t.Errorf("#%d: got %+v, %+v, want %+v, %+v", i, hunks, commits, wantHunks, wantCommits)
+		}
+	}
+	if cache.hits != 2 || cache.misses != 2 {
+		t.Errorf("got %d hits and %d misses, want 2 and 2", cache.hits, cache.misses)
+	}
+
+	// Files blamed one at a time have the same keys.
+	for _, file := range []string{"f", "empty"} {
+		BlameCache = nil
+		wantHunks, wantCommits, err := BlameGitFile(dir, file, rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		BlameCache = cache
+		hunks, commits, err := BlameGitFile(dir, file, rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(hunks, wantHunks) || !reflect.DeepEqual(commits, wantCommits) {
+			t.Errorf("%s: got %+v, %+v, want %+v, %+v", file, hunks, commits, wantHunks, wantCommits)
+		}
+	}
+	if cache.hits != 4 || cache.misses != 2 {
+		t.Errorf("got %d hits and %d misses after blaming single files, want 4 and 2", cache.hits, cache.misses)
+	}
+}
+
+func TestWithGitBlobs(t *testing.T) {
+	r := newTestGitRepo(t)
+	rev := r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add", files: map[string]string{
+		"sub/f": "a\n",
+	}})
+	dir := filepath.Join(r.dir, "sub")
+
+	defer func(c Cache) { BlameCache = c }(BlameCache)
+	BlameCache = NewMemoryCache(1 << 20)
+	files, opt, cleanup, err := gitRepositoryFiles(context.Background(), dir, rev, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if want := []string{"f"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("got files %q, want %q", files, want)
+	}
+	// The entries are what git ls-tree --full-name lists for each file.
+	out := r.git(nil, "ls-tree", "--full-name", rev, "--", "sub/f")
+	if want := map[string]string{"f": out}; !reflect.DeepEqual(opt.gitBlobs, want) {
+		t.Errorf("got blobs %q, want %q", opt.gitBlobs, want)
+	}
+}
+
+// TestGitLastCommits checks that gitLastCommits finds the commits that git
+// rev-list -1 finds for each file.
+func TestGitLastCommits(t *testing.T) {
+	r := newTestGitRepo(t)
+	a := "A <a@example.com>"
+	env := []string{"GIT_AUTHOR_NAME=A", "GIT_AUTHOR_EMAIL=a@example.com", "GIT_AUTHOR_DATE=2014-01-09T00:00:00Z",
+		"GIT_COMMITTER_NAME=A", "GIT_COMMITTER_EMAIL=a@example.com", "GIT_COMMITTER_DATE=2014-01-09T00:00:00Z"}
+	r.commit(testCommit{author: a, date: "2014-01-01T00:00:00Z", message: "add", files: map[string]string{
+		"top": "a\n", "sub/a": "a\n", "sub/b": "b\n", "sub/c": "c\n",
+	}})
+	r.git(nil, "checkout", "-q", "-b", "side")
+	r.commit(testCommit{author: a, date: "2014-01-02T00:00:00Z", message: "side", files: map[string]string{"sub/a": "a2\n"}})
+	r.git(nil, "checkout", "-q", "-")
+	r.commit(testCommit{author: a, date: "2014-01-03T00:00:00Z", message: "main", files: map[string]string{"sub/b": "b2\n"}})
+	r.git(env, "merge", "-q", "--no-edit", "side")
+	// c is changed, and then changed back.
+	r.commit(testCommit{author: a, date: "2014-01-04T00:00:00Z", message: "change c", files: map[string]string{"sub/c": "c2\n"}})
+	r.commit(testCommit{author: a, date: "2014-01-05T00:00:00Z", message: "revert c", files: map[string]string{"sub/c": "c\n"}})
+	// A merge that is the same as its first parent, which git log -m
+	// leaves out.
+	r.git(nil, "checkout", "-q", "-b", "ours", "HEAD~2")
+	r.commit(testCommit{author: a, date: "2014-01-06T00:00:00Z", message: "ours", files: map[string]string{"sub/b": "b3\n", "top": "a2\n"}})
+	r.git(nil, "checkout", "-q", "-")
+	r.git(env, "merge", "-q", "--no-edit", "-s", "ours", "ours")
+	r.commit(testCommit{author: a, date: "2014-01-07T00:00:00Z", message: "change top", files: map[string]string{"top": "a3\n"}})
+	revs := strings.Fields(r.git(nil, "rev-list", "HEAD"))
+
+	for _, dir := range []string{r.dir, filepath.Join(r.dir, "sub")} {
+		prefix := r.git(nil, "-C", dir, "rev-parse", "--show-prefix")
+		for _, v := range revs {
+			blobs := make(map[string]string)
+			for _, name := range strings.Split(r.git(nil, "-C", dir, "ls-tree", "-r", "--name-only", v), "\n") {
+				blobs[name] = ""
+			}
+			last, err := gitLastCommits(context.Background(), dir, v, prefix, blobs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name := range blobs {
+				want := r.git(nil, "-C", dir, "rev-list", "-1", v, "--", name)
+				if got, ok := last[name]; !ok || got != want {
+					t.Errorf("%s at %s in %s: got %q (%v), want %q", name, v, dir, got, ok, want)
+				}
+			}
+		}
+	}
+
+	// A merge that is the same as all of its parents, which git log -m
+	// lists once.
+	r.git(nil, "checkout", "-q", "-b", "empty")
+	r.git(env, "commit", "-q", "--allow-empty", "-m", "empty")
+	r.git(nil, "checkout", "-q", "-")
+	r.git(env, "merge", "-q", "--no-ff", "--no-edit", "empty")
+	last, err := gitLastCommits(context.Background(), r.dir, "HEAD", "", map[string]string{"top": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := r.git(nil, "rev-list", "-1", "HEAD", "--", "top"); last["top"] != want {
+		t.Errorf("after an empty merge: got %q, want %q", last["top"], want)
+	}
+}
+
+func TestGitCacheKey_error(t *testing.T) {
+	r := newTestGitRepo(t)
+	rev := r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add", files: map[string]string{"f": "a\n"}})
+	l := &recordingLogger{}
+	defer func(old Logger) { Log = old }(Log)
+	Log = l
+
+	// A file that can't be hashed makes the blame uncacheable, which is
+	// logged.
+	key, err := gitCacheKey(context.Background(), r.dir, "f", rev, &BlameOptions{IgnoreRevsFile: "missing"})
+	if key != "" || err != nil {
+		t.Errorf("got key %q and error %v, want no key", key, err)
+	}
+	if len(l.msgs) != 1 || l.msgs[0].level != LevelWarn || l.msgs[0].msg != "blame cache key failed" {
+		t.Errorf("got log messages %+v, want a warning", l.msgs)
+	}
+}
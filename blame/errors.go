@@ -0,0 +1,212 @@
+package blame
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// These errors are returned (wrapped, so use errors.Is to check for them)
+// when blaming fails for the corresponding reason, by all backends.
+var (
+	// ErrNotRepository means that the repository path is not (or not in)
+	// a repository, or doesn't exist.
+	ErrNotRepository = errors.New("blame: not a repository")
+
+	// ErrRevisionNotFound means that the revision to blame doesn't exist.
+	ErrRevisionNotFound = errors.New("blame: revision not found")
+
+	// ErrFileNotFound means that the file to blame doesn't exist at the
+	// revision.
+	ErrFileNotFound = errors.New("blame: file not found")
+
+	// ErrBinaryFile means that the file to blame is binary (its first
+	// 8000 bytes contain a NUL byte, as git and hg decide), so it has no
+	// lines. Repositories are blamed without their binary files.
+	ErrBinaryFile = errors.New("blame: binary file")
+
+	// ErrToolMissing means that git or hg isn't installed.
+	ErrToolMissing = errors.New("blame: tool not installed")
+)
+
+// A CommandError is returned when a git or hg command fails. errors.Is
+// reports whether it's one of the errors above, which is decided by the
+// command's stderr output.
+type CommandError struct {
+	Dir    string   // the directory that the command ran in
+	Args   []string // the command line, starting with the program name
+	Stderr []byte   // the start of the command's stderr output
+	Err    error    // why the command failed, such as an *exec.ExitError
+
+	kind error // one of the errors above, or nil
+}
+
+func newCommandError(dir string, args []string, stderr []byte, err error) *CommandError {
+	e := &CommandError{Dir: dir, Args: args, Stderr: stderr, Err: err}
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		e.kind = ErrToolMissing
+	case dir != "" && !isDir(dir):
+		// exec fails with a confusing error ("fork/exec /usr/bin/git: no
+		// such file or directory") when dir doesn't exist.
+		e.kind = ErrNotRepository
+	default:
+		msg := string(stderr)
+		for _, m := range commandErrorMessages {
+			if strings.Contains(msg, m.text) {
+				e.kind = m.kind
+				break
+			}
+		}
+	}
+	return e
+}
+
+// commandErrorMessages are the parts of git's and hg's error messages that
+// say why a command failed. They are checked in order.
+var commandErrorMessages = []struct {
+	text string
+	kind error
+}{
+	// git
+	{"not a git repository", ErrNotRepository},
+	{"fatal: no such path ", ErrFileNotFound},
+	{"' does not exist in '", ErrFileNotFound},
+	{"' exists on disk, but not in '", ErrFileNotFound},
+	{"fatal: bad revision ", ErrRevisionNotFound},
+	{"fatal: bad object ", ErrRevisionNotFound},
+	{"fatal: invalid object name ", ErrRevisionNotFound},
+	{"fatal: Not a valid object name ", ErrRevisionNotFound},
+	{"unknown revision or path not in the working tree", ErrRevisionNotFound},
+	{" has only 0 lines", errPastEnd}, // git blame -L 1,n of an empty file
+
+	// hg
+	{"abort: no repository found", ErrNotRepository},
+	{"abort: There is no Mercurial repository here", ErrNotRepository},
+	{"abort: unknown revision ", ErrRevisionNotFound},
+	{"abort: filtered revision ", ErrRevisionNotFound},
+	{"abort: ambiguous identifier", ErrRevisionNotFound},
+	{": no such file in rev ", ErrFileNotFound},
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("%s (in %s): %s", strings.Join(e.Args, " "), e.Dir, e.Err)
+	if stderr := bytes.TrimSpace(e.Stderr); len(stderr) > 0 {
+		msg += ": " + string(stderr)
+	} else if e.kind != nil {
+		msg = e.kind.Error() + ": " + msg
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() error { return e.Err }
+
+// Is reports whether target is the kind of error (e.g., ErrFileNotFound)
+// that e is.
+func (e *CommandError) Is(target error) bool {
+	return e.kind != nil && target == e.kind
+}
+
+// maxStderr is the number of bytes of a command's stderr output that is
+// kept for CommandError.
+const maxStderr = 64 << 10
+
+// stderrBuffer keeps the first maxStderr bytes written to it. It is safe
+// for concurrent use, because the output of a command may be read while
+// it's being written.
+type stderrBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *stderrBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := maxStderr - len(b.buf); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		b.buf = append(b.buf, p[:n]...)
+	}
+	return len(p), nil
+}
+
+func (b *stderrBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf...)
+}
+
+// isBinary returns true if data is the contents of a binary file.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// fileError returns an error that wraps kind (e.g., ErrFileNotFound) and
+// says which file and revision it's about.
+func fileError(kind error, filePath, v string) error {
+	return fmt.Errorf("%w: %s at %s", kind, filePath, v)
+}
+
+// A FileError is the failure to blame one file of a repository.
+type FileError struct {
+	Path string // relative to the repository
+	Err  error
+}
+
+func (e FileError) Error() string { return e.Path + ": " + e.Err.Error() }
+
+func (e FileError) Unwrap() error { return e.Err }
+
+// A FileErrors error is returned when blaming a repository with
+// BlameOptions.MaxFailedFiles set, if any files couldn't be blamed. Unless
+// it's Aborted, the results of the other files are returned with it.
+// errors.Is reports whether any of the files failed with the target
+// error.
+type FileErrors struct {
+	Files []FileError // in the order of the repository's files
+
+	// Aborted is true if more than MaxFailedFiles files failed, so
+	// blaming stopped and no results were returned. Files then only lists
+	// the files that failed before blaming stopped.
+	Aborted bool
+}
+
+func (e *FileErrors) Error() string {
+	msg := fmt.Sprintf("blame: %d files failed", len(e.Files))
+	if len(e.Files) == 1 {
+		msg = "blame: 1 file failed"
+	}
+	if e.Aborted {
+		msg += " (too many, stopped)"
+	}
+	if len(e.Files) > 0 {
+		msg += ": " + e.Files[0].Error()
+		if len(e.Files) > 1 {
+			msg += fmt.Sprintf(" (and %d more)", len(e.Files)-1)
+		}
+	}
+	return msg
+}
+
+func (e *FileErrors) Unwrap() []error {
+	errs := make([]error, len(e.Files))
+	for i, f := range e.Files {
+		errs[i] = f
+	}
+	return errs
+}
+
+// isPartial returns true if err, which was returned with the result of
+// blaming a repository, only reports files that failed, so the result is
+// usable.
+func isPartial(err error) bool {
+	var fileErrs *FileErrors
+	return errors.As(err, &fileErrs) && !fileErrs.Aborted
+}
@@ -0,0 +1,116 @@
+package blame
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	r := newTestGitRepo(t)
+	rev := r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add", files: map[string]string{
+		"f":   "a\n",
+		"bin": "a\nb\x00\n",
+	}})
+	ctx := context.Background()
+
+	for _, name := range []string{"git", "puregit"} {
+		b, err := LookupBackend(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			label string
+			err   error
+			want  error
+		}{
+			{"nonexistent file", blameFileErr(b.BlameFile(ctx, r.dir, "nonexistent", rev, nil)), ErrFileNotFound},
+			{"nonexistent revision", blameFileErr(b.BlameFile(ctx, r.dir, "f", "nonexistent", nil)), ErrRevisionNotFound},
+			{"nonexistent commit", blameFileErr(b.BlameFile(ctx, r.dir, "f", "0123456789abcdef0123456789abcdef01234567", nil)), ErrRevisionNotFound},
+			{"binary file", blameFileErr(b.BlameFile(ctx, r.dir, "bin", rev, nil)), ErrBinaryFile},
+			{"binary file range", blameFileErr(b.(RangeBackend).BlameFileRange(ctx, r.dir, "bin", rev, 1, 2, nil)), ErrBinaryFile},
+			{"nonexistent directory", blameFileErr(b.BlameFile(ctx, filepath.Join(r.dir, "nonexistent"), "f", rev, nil)), ErrNotRepository},
+			{"not a repository", blameFileErr(b.BlameFile(ctx, t.TempDir(), "f", rev, nil)), ErrNotRepository},
+		}
+		for _, test := range tests {
+			if !errors.Is(test.err, test.want) {
+				t.Errorf("%s: %s: got error %v, want %v", name, test.label, test.err, test.want)
+			}
+		}
+
+		// Binary files are skipped when blaming a repository.
+		hunks, _, err := b.BlameRepository(ctx, r.dir, rev, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := hunks["bin"]; ok || len(hunks) != 1 {
+			t.Errorf("%s: got hunks for %v, want only f", name, hunks)
+		}
+	}
+
+	// git's errors say what it was running, and what it said.
+	_, _, err := BlameGitFile(r.dir, "nonexistent", rev)
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("got error %v, want a *CommandError", err)
+	}
+	if cmdErr.Dir != r.dir || cmdErr.Args[0] != "git" || len(cmdErr.Stderr) == 0 {
+		t.Errorf("got %+v, want git's command line and stderr", cmdErr)
+	}
+
+	t.Setenv("PATH", "")
+	if _, _, err := BlameGitFile(r.dir, "f", rev); !errors.Is(err, ErrToolMissing) {
+		t.Errorf("got error %v without git, want ErrToolMissing", err)
+	}
+}
+
+func blameFileErr(hunks []Hunk, commits map[string]Commit, err error) error {
+	return err
+}
+
+func TestFileErrors(t *testing.T) {
+	r := newTestGitRepo(t)
+	r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add", files: map[string]string{
+		"a": "a\n", "b": "b\n", "c": "c\n",
+	}})
+	// Make b unreadable by deleting its blob.
+	blob := r.git(nil, "rev-parse", "HEAD:b")
+	if err := os.Remove(filepath.Join(r.dir, ".git", "objects", blob[:2], blob[2:])); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, name := range []string{"git", "puregit"} {
+		b, err := LookupBackend(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := b.BlameRepository(ctx, r.dir, "HEAD", nil, nil); err == nil || isPartial(err) {
+			t.Errorf("%s: got error %v, want b's error", name, err)
+		}
+
+		hunks, commits, err := b.BlameRepository(ctx, r.dir, "HEAD", nil, &BlameOptions{MaxFailedFiles: 1})
+		var fileErrs *FileErrors
+		if !errors.As(err, &fileErrs) || fileErrs.Aborted || len(fileErrs.Files) != 1 || fileErrs.Files[0].Path != "b" {
+			t.Errorf("%s: got error %v, want b to fail", name, err)
+		}
+		if len(hunks) != 2 || hunks["a"] == nil || hunks["c"] == nil || len(commits) != 1 {
+			t.Errorf("%s: got %d files and %d commits, want a and c and their commit", name, len(hunks), len(commits))
+		}
+		for _, c := range commits {
+			if c.Message != "add" {
+				t.Errorf("%s: got commit %+v, want its details", name, c)
+			}
+		}
+	}
+
+	err := &FileErrors{Files: []FileError{{"a", fileError(ErrBinaryFile, "a", "v")}, {"b", errors.New("x")}}}
+	if !errors.Is(err, ErrBinaryFile) || errors.Is(err, ErrFileNotFound) {
+		t.Errorf("errors.Is: got the wrong answers for %v", err)
+	}
+	if want := "blame: 2 files failed: a: blame: binary file: a at v (and 1 more)"; err.Error() != want {
+		t.Errorf("got message %q, want %q", err.Error(), want)
+	}
+}
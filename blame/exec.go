@@ -0,0 +1,55 @@
+package blame
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// command returns a command that runs name in dir. When ctx is done, the
+// command and any processes it started are killed. Its stderr output is
+// kept for the error that commandErr returns.
+func command(ctx context.Context, dir, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderrBuffer{}
+	killProcessTreeOnCancel(cmd)
+	return cmd
+}
+
+// commandErr returns the error to report when cmd (returned by command)
+// exited with err: ctx.Err() if ctx is done, and a *CommandError
+// otherwise. If err is nil, it logs cmd's stderr output, if any, and
+// returns nil.
+func commandErr(ctx context.Context, cmd *exec.Cmd, err error) error {
+	var stderr []byte
+	if b, ok := cmd.Stderr.(*stderrBuffer); ok {
+		stderr = b.Bytes()
+	}
+	if err == nil {
+		logStderr(cmd.Dir, cmd.Args, stderr)
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return newCommandError(cmd.Dir, cmd.Args, stderr, err)
+}
+
+// logStderr logs the stderr output of a command that succeeded, if any.
+func logStderr(dir string, args []string, stderr []byte) {
+	if stderr = bytes.TrimSpace(stderr); len(stderr) > 0 {
+		logWarn("command wrote to stderr", "dir", dir, "args", strings.Join(args, " "), "stderr", string(stderr))
+	}
+}
+
+// contextErr returns ctx.Err() if ctx is done, and err otherwise. It is
+// used to report cancellation instead of the error that results from the
+// child process being killed.
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
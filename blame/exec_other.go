@@ -0,0 +1,9 @@
+//go:build !unix
+
+package blame
+
+import "os/exec"
+
+// killProcessTreeOnCancel is a no-op on systems without process groups;
+// only cmd's own process is killed on cancellation.
+func killProcessTreeOnCancel(cmd *exec.Cmd) {}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package blame
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessTreeOnCancel starts cmd in its own process group and makes
+// cancellation kill the whole group instead of only cmd's process.
+func killProcessTreeOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,263 @@
+package blame
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitCatFile is a git cat-file --batch process, which reads objects from a
+// repository without starting a new process for each one.
+type gitCatFile struct {
+	ctx      context.Context
+	repoPath string
+	cmd      *exec.Cmd
+	in       io.WriteCloser
+	out      *bufio.Reader
+}
+
+func startGitCatFile(ctx context.Context, repoPath string) (*gitCatFile, error) {
+	cmd := command(ctx, repoPath, "git", "cat-file", "--batch")
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, commandErr(ctx, cmd, err)
+	}
+	return &gitCatFile{ctx: ctx, repoPath: repoPath, cmd: cmd, in: in, out: bufio.NewReader(out)}, nil
+}
+
+// objects reads the objects with the given IDs, calling fn with each
+// one's type and contents, in order. The IDs are written to git while the
+// objects are read, so that git never waits for the next request.
+func (c *gitCatFile) objects(ids []string, fn func(id, typ string, data []byte) error) error {
+	writeErr := make(chan error, 1)
+	go func() {
+		w := bufio.NewWriter(c.in)
+		for _, id := range ids {
+			if _, err := fmt.Fprintln(w, id); err != nil {
+				writeErr <- err
+				return
+			}
+		}
+		writeErr <- w.Flush()
+	}()
+
+	for _, id := range ids {
+		typ, data, err := c.read()
+		if err != nil {
+			return contextErr(c.ctx, err)
+		}
+		if typ == "missing" {
+			return fmt.Errorf("%w: git object %s", ErrRevisionNotFound, id)
+		}
+		if err := fn(id, typ, data); err != nil {
+			return err
+		}
+	}
+	return contextErr(c.ctx, <-writeErr)
+}
+
+// read reads the next object of the output, which is "<id> <type>
+// <size>\n<contents>\n", or "<id> missing\n" if the object doesn't exist.
+func (c *gitCatFile) read() (typ string, data []byte, err error) {
+	header, err := c.out.ReadString('\n')
+	if err != nil {
+		return "", nil, err
+	}
+	fields := strings.Fields(header)
+	if len(fields) == 2 && fields[1] == "missing" {
+		return "missing", nil, nil
+	}
+	if len(fields) != 3 {
+		return "", nil, fmt.Errorf("unexpected git cat-file header line: %q", header)
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", nil, fmt.Errorf("bad size in git cat-file header line %q", header)
+	}
+	data = make([]byte, size+1) // including the trailing newline
+	if _, err := io.ReadFull(c.out, data); err != nil {
+		return "", nil, err
+	}
+	return fields[1], data[:size], nil
+}
+
+// close stops git and waits for it to exit.
+func (c *gitCatFile) close() error {
+	c.in.Close()
+	return commandErr(c.ctx, c.cmd, c.cmd.Wait())
+}
+
+// addGitCommitDetails fills in the details of each commit in commits,
+// which may only have an ID, from the repository. The commits are read by
+// a single git cat-file process.
+func addGitCommitDetails(ctx context.Context, repoPath string, commits map[string]Commit) error {
+	if len(commits) == 0 {
+		return nil
+	}
+	c, err := startGitCatFile(ctx, repoPath)
+	if err != nil {
+		return err
+	}
+	if err := c.readCommits(commits); err != nil {
+		c.cmd.Process.Kill()
+		c.close()
+		return err
+	}
+	return c.close()
+}
+
+// readCommits fills in the details of each commit in commits from the
+// repository. Commits that came from git blame keep their author,
+// committer and summary, which git blame has mapped through .mailmap;
+// only their message and parents are read. Commits that only have an ID
+// are read in full, and their authors and committers are then mapped
+// through .mailmap by git log.
+func (c *gitCatFile) readCommits(commits map[string]Commit) error {
+	if len(commits) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(commits))
+	for id := range commits {
+		ids = append(ids, id)
+	}
+	var unmapped []string
+	err := c.objects(ids, func(id, typ string, data []byte) error {
+		if typ != "commit" {
+			return fmt.Errorf("%w: git object %s is a %s, not a commit", ErrRevisionNotFound, id, typ)
+		}
+		commit, err := parseGitCommit(id, data)
+		if err != nil {
+			return err
+		}
+		if blamed := commits[id]; !blamed.AuthorDate.IsZero() {
+			commit.Author, commit.Committer, commit.Summary = blamed.Author, blamed.Committer, blamed.Summary
+		} else {
+			unmapped = append(unmapped, id)
+		}
+		commits[id] = commit
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return applyGitMailmap(c.ctx, c.repoPath, unmapped, commits)
+}
+
+// applyGitMailmap replaces the authors and committers of the commits in
+// commits with the given IDs by the ones that .mailmap maps them to,
+// using a single git command.
+func applyGitMailmap(ctx context.Context, repoPath string, ids []string, commits map[string]Commit) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var in bytes.Buffer
+	for _, id := range ids {
+		fmt.Fprintln(&in, id)
+	}
+	cmd := command(ctx, repoPath, "git", "log", "--no-walk", "--stdin", "-z", "--format=%H%x00%aN%x00%aE%x00%cN%x00%cE")
+	cmd.Stdin = &in
+	out, err := cmd.Output()
+	if err = commandErr(ctx, cmd, err); err != nil {
+		return err
+	}
+	// Each commit is output as 5 NUL-separated fields, and commits are
+	// separated by NULs.
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i+4 < len(fields); i += 5 {
+		c, present := commits[fields[i]]
+		if !present {
+			continue
+		}
+		c.Author = Author{Name: fields[i+1], Email: fields[i+2]}
+		c.Committer = Author{Name: fields[i+3], Email: fields[i+4]}
+		commits[c.ID] = c
+	}
+	return nil
+}
+
+// parseGitCommit parses the contents of a commit object: header lines
+// (such as "parent <ID>" and "author <name> <<email>> <time> <zone>"),
+// a blank line, and the commit message.
+func parseGitCommit(id string, data []byte) (Commit, error) {
+	c := Commit{ID: id}
+	for len(data) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(data, '\n'); i != -1 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			line, data = data, nil
+		}
+		if len(line) == 0 {
+			break // end of headers
+		}
+		key, value := string(line), ""
+		if i := bytes.IndexByte(line, ' '); i != -1 {
+			key, value = string(line[:i]), string(line[i+1:])
+		}
+		var err error
+		switch key {
+		case "parent":
+			c.Parents = append(c.Parents, value)
+		case "author":
+			c.Author, c.AuthorDate, err = parseGitSignature(value)
+		case "committer":
+			c.Committer, c.CommitterDate, err = parseGitSignature(value)
+		}
+		// Other headers, and continuation lines of multi-line headers
+		// (e.g., gpgsig), which start with a space, are ignored.
+		if err != nil {
+			return Commit{}, fmt.Errorf("bad git commit %s: %s", id, err)
+		}
+	}
+	c.Message = strings.TrimRight(string(data), "\n")
+	c.Summary = gitSummary(c.Message)
+	return c, nil
+}
+
+// gitSummary returns the summary of a commit message as git blame reports
+// it: the first non-blank line. (git log's %s is the whole first
+// paragraph, but the summary must not depend on whether a commit's details
+// came from git blame or from the commit object.)
+func gitSummary(message string) string {
+	message = strings.TrimLeft(message, "\n")
+	if i := strings.Index(message, "\n"); i != -1 {
+		message = message[:i]
+	}
+	return message
+}
+
+// parseGitSignature parses the value of an author or committer header,
+// "<name> <<email>> <Unix time> <time zone>".
+func parseGitSignature(sig string) (Author, time.Time, error) {
+	i := strings.LastIndex(sig, ">")
+	j := strings.LastIndex(sig[:i+1], "<")
+	if i == -1 || j == -1 {
+		return Author{}, time.Time{}, fmt.Errorf("bad signature %q", sig)
+	}
+	author := Author{
+		Name:  strings.TrimSpace(sig[:j]),
+		Email: sig[j+1 : i],
+	}
+	fields := strings.Fields(sig[i+1:])
+	if len(fields) != 2 {
+		return Author{}, time.Time{}, fmt.Errorf("bad signature %q", sig)
+	}
+	t, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Author{}, time.Time{}, fmt.Errorf("bad time in signature %q", sig)
+	}
+	return author, time.Unix(t, 0).In(gitTimeZone(fields[1])), nil
+}
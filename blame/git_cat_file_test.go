@@ -0,0 +1,88 @@
+package blame
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testGitCommitObject = `tree 3b18e512dba79e4c8300dd08aeb37f8e728b8dad
+parent 1111111111111111111111111111111111111111
+parent 2222222222222222222222222222222222222222
+author Jane Doe <jane@example.com> 1381541290 -0700
+committer J. Committer <committer@example.com> 1381600000 +0530
+gpgsig -----BEGIN PGP SIGNATURE-----
+ 
+ iQEcBAABAgAGBQJSWHRhAAoJEP
+ -----END PGP SIGNATURE-----
+
+Merge branch 'x'
+
+Details: <a@b> 1 +0000
+`
+
+func TestParseGitCommit(t *testing.T) {
+	c, err := parseGitCommit("abc", []byte(testGitCommitObject))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Commit{
+		ID:            "abc",
+		Author:        Author{Name: "Jane Doe", Email: "jane@example.com"},
+		Committer:     Author{Name: "J. Committer", Email: "committer@example.com"},
+		Message:       "Merge branch 'x'\n\nDetails: <a@b> 1 +0000",
+		Summary:       "Merge branch 'x'",
+		AuthorDate:    mustParseTime("Fri Oct 11 18:28:10 2013 -0700"),
+		CommitterDate: mustParseTime("Sat Oct 12 23:16:40 2013 +0530"),
+		Parents:       []string{"1111111111111111111111111111111111111111", "2222222222222222222222222222222222222222"},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got commit %+v, want %+v", c, want)
+	}
+
+	if _, err := parseGitCommit("abc", []byte("author Jane Doe jane@example.com 1381541290 -0700\n\nx\n")); err == nil {
+		t.Error("got nil error for bad author")
+	}
+}
+
+func TestGitCommitDetails_mailmap(t *testing.T) {
+	r := newTestGitRepo(t)
+	id := r.commit(testCommit{author: "Jane <jane@old.example.com>", date: "2014-01-01T00:00:00Z", message: "Add a\nand .mailmap\n\nDetails.", files: map[string]string{
+		"a": "a\n", ".mailmap": "Jane Doe <jane@example.com> <jane@old.example.com>\n",
+	}})
+	want := Author{Name: "Jane Doe", Email: "jane@example.com"}
+
+	check := func(label string) {
+		_, commits, err := BlameGitRepository(r.dir, "HEAD", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := commits[id]
+		if c.Author != want || c.Committer != want {
+			t.Errorf("%s: got author %+v and committer %+v, want %+v", label, c.Author, c.Committer, want)
+		}
+		if c.Summary != "Add a" || c.Message != "Add a\nand .mailmap\n\nDetails." || c.AuthorDate.IsZero() {
+			t.Errorf("%s: got commit %+v", label, c)
+		}
+	}
+	check("blamed")
+
+	// Cached blames only have commit IDs, so their commits are read in
+	// full.
+	defer func(c Cache) { BlameCache = c }(BlameCache)
+	BlameCache = NewMemoryCache(1 << 20)
+	check("cache miss")
+	check("cache hit")
+
+	c, err := startGitCatFile(context.Background(), r.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	err = c.readCommits(map[string]Commit{strings.Repeat("1", 40): {}})
+	if !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("missing commit: got error %v, want %v", err, ErrRevisionNotFound)
+	}
+}
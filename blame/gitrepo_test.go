@@ -0,0 +1,90 @@
+package blame
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testGitRepo is a git repository in a temporary directory, for tests
+// that need repository contents that the goblametest repository lacks.
+type testGitRepo struct {
+	t   *testing.T
+	dir string
+}
+
+func newTestGitRepo(t *testing.T) *testGitRepo {
+	r := &testGitRepo{t: t, dir: t.TempDir()}
+	r.git(nil, "init", "-q")
+	return r
+}
+
+// testCommit describes a commit to create with testGitRepo.commit.
+type testCommit struct {
+	author  string // "Name <email>"
+	date    string // in any format that git accepts
+	message string
+	files   map[string]string // contents of files to write
+	remove  []string          // files to delete
+
+	// committer and commitDate are like author and date, which they
+	// default to.
+	committer  string
+	commitDate string
+}
+
+// commit makes a commit and returns its ID.
+func (r *testGitRepo) commit(c testCommit) string {
+	for name, data := range c.files {
+		path := filepath.Join(r.dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	for _, name := range c.remove {
+		if err := os.Remove(filepath.Join(r.dir, name)); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+
+	if c.committer == "" {
+		c.committer = c.author
+	}
+	if c.commitDate == "" {
+		c.commitDate = c.date
+	}
+	name, email := splitTestAuthor(c.author)
+	cName, cEmail := splitTestAuthor(c.committer)
+	env := []string{
+		"GIT_AUTHOR_NAME=" + name, "GIT_AUTHOR_EMAIL=" + email, "GIT_AUTHOR_DATE=" + c.date,
+		"GIT_COMMITTER_NAME=" + cName, "GIT_COMMITTER_EMAIL=" + cEmail, "GIT_COMMITTER_DATE=" + c.commitDate,
+	}
+	r.git(nil, "add", "-A")
+	r.git(env, "commit", "-q", "--allow-empty", "-m", c.message)
+	return r.git(nil, "rev-parse", "HEAD")
+}
+
+// splitTestAuthor splits "Name <email>" into its parts.
+func splitTestAuthor(s string) (name, email string) {
+	if i := strings.Index(s, " <"); i != -1 {
+		return s[:i], strings.Trim(s[i+2:], ">")
+	}
+	return s, ""
+}
+
+func (r *testGitRepo) git(env []string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
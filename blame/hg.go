@@ -0,0 +1,406 @@
+package blame
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+func listHgRepositoryFiles(ctx context.Context, repoPath string, v string) ([]string, error) {
+	lines, err := hgOutput(ctx, repoPath, "locate", "--print0", "-r", v)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range strings.Split(string(lines), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// hgFileContents returns the contents of a file (relative to repoPath) at
+// revision v.
+func hgFileContents(ctx context.Context, repoPath, v, name string) ([]byte, error) {
+	return hgOutput(ctx, repoPath, "cat", "-r", v, "--", name)
+}
+
+func BlameHgRepository(repoPath string, v string, ignorePatterns []string) (map[string][]Hunk, map[string]Commit, error) {
+	return BlameHgRepositoryContext(context.Background(), repoPath, v, ignorePatterns, nil)
+}
+
+func BlameHgRepositoryContext(ctx context.Context, repoPath string, v string, ignorePatterns []string, opt *BlameOptions) (map[string][]Hunk, map[string]Commit, error) {
+	files, err := hgRepositoryFiles(ctx, repoPath, v, ignorePatterns, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return blameHgFiles(ctx, repoPath, v, nil, opt, files)
+}
+
+// streamHgRepository implements StreamRepository for hg. Files are passed
+// to fn in batches of hgStreamBatch, once hg has annotated them. hg
+// annotates a batch of files at once, so an error isn't specific to a
+// file: it is returned, not passed to fn.
+func streamHgRepository(ctx context.Context, repoPath string, v string, ignorePatterns []string, opt *BlameOptions, fn func(FileBlame) error) error {
+	files, err := hgRepositoryFiles(ctx, repoPath, v, ignorePatterns, opt)
+	if err != nil {
+		return err
+	}
+	sent := make(map[string]bool)
+	_, err = forEachHgFile(ctx, repoPath, v, nil, opt, files, hgStreamBatch, func(name string, hunks []Hunk, commits map[string]Commit) error {
+		return fn(FileBlame{Path: name, Hunks: hunks, Commits: newCommits(hunks, commits, sent)})
+	})
+	return err
+}
+
+// hgRepositoryFiles returns the files to blame in an hg repository:
+// those that neither ignorePatterns nor opt skip. As for git, the
+// .gitattributes files are read before ignorePatterns are applied, so
+// they count even if they are ignored.
+func hgRepositoryFiles(ctx context.Context, repoPath, v string, ignorePatterns []string, opt *BlameOptions) ([]string, error) {
+	files, err := listHgRepositoryFiles(ctx, repoPath, v)
+	if err != nil {
+		return nil, err
+	}
+	files, err = filterLinguistFiles(files, opt, func(name string) ([]byte, error) {
+		return hgFileContents(ctx, repoPath, v, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return selectFiles(files, ignorePatterns)
+}
+
+// Note: filePath should be absolute or relative to repoPath
+func BlameHgFile(repoPath string, filePath string, v string) ([]Hunk, map[string]Commit, error) {
+	return BlameHgFileContext(context.Background(), repoPath, filePath, v, nil)
+}
+
+func BlameHgFileContext(ctx context.Context, repoPath string, filePath string, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	return blameHgFileRange(ctx, repoPath, filePath, v, nil, opt)
+}
+
+func blameHgFileRange(ctx context.Context, repoPath string, filePath string, v string, r *Range, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	name, err := relSlashPath(repoPath, filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	hunks, commits, err := blameHgFiles(ctx, repoPath, v, r, opt, []string{name})
+	if err != nil {
+		return nil, nil, err
+	}
+	if hunks[name] == nil {
+		// hg annotate skips binary files (and those that don't exist)
+		// without failing, and outputs no lines for empty ones.
+		data, err := hgFileContents(ctx, repoPath, v, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if isBinary(data) {
+			return nil, nil, fileError(ErrBinaryFile, filePath, v)
+		}
+	}
+	return hunks[name], commits, nil
+}
+
+// blameHgFiles blames files (relative to repoPath) at revision v, running
+// hg log once to get the commits that touched them, and hg annotate once
+// to annotate all of them. If r is non-nil, only the lines that it selects
+// are blamed.
+func blameHgFiles(ctx context.Context, repoPath string, v string, r *Range, opt *BlameOptions, files []string) (map[string][]Hunk, map[string]Commit, error) {
+	hunks := make(map[string][]Hunk)
+	commits, err := forEachHgFile(ctx, repoPath, v, r, opt, files, len(files), func(name string, fileHunks []Hunk, _ map[string]Commit) error {
+		hunks[name] = fileHunks
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return hunks, commits, nil
+}
+
+// hgStreamBatch is the number of files that streamHgRepository annotates
+// with each hg command.
+var hgStreamBatch = 100
+
+// forEachHgFile blames files like blameHgFiles, and calls fn with the
+// hunks of each file, along with the commits of all files (which are read
+// first). Files without lines are skipped. It returns the commits.
+//
+// The files are annotated batch at a time, and fn is called with the
+// files of a batch after hg is done with it, so that fn may run hg in the
+// same repository.
+func forEachHgFile(ctx context.Context, repoPath string, v string, r *Range, opt *BlameOptions, files []string, batch int, fn func(name string, hunks []Hunk, commits map[string]Commit) error) (map[string]Commit, error) {
+	commits := make(map[string]Commit)
+	if len(files) == 0 {
+		return commits, nil
+	}
+
+	// Pass the files in a file, not as arguments, so that there may be any
+	// number of them.
+	listFile, err := writeHgListFile(files)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(listFile)
+	if err := hgLog(ctx, repoPath, v, "listfile0:"+listFile, commits); err != nil {
+		return nil, err
+	}
+
+	t0 := time.Now()
+	nDone := 0
+	for start := 0; start < len(files); start += batch {
+		end := start + batch
+		if end > len(files) {
+			end = len(files)
+		}
+		batchListFile := listFile
+		if end-start < len(files) {
+			if batchListFile, err = writeHgListFile(files[start:end]); err != nil {
+				return nil, err
+			}
+		}
+		annotated, err := hgAnnotate(ctx, repoPath, v, r, opt, "listfile0:"+batchListFile)
+		if batchListFile != listFile {
+			os.Remove(batchListFile)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range annotated {
+			nDone++
+			logDebug("blamed file", "repo", repoPath, "file", file.Abspath, "done", nDone, "total", len(files), "perFile", time.Since(t0)/time.Duration(nDone))
+			if fileHunks := file.hunks(r); fileHunks != nil {
+				if err := fn(file.Abspath, fileHunks, commits); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return commits, nil
+}
+
+// hgAnnotate runs hg annotate on the files that pattern selects at
+// revision v.
+func hgAnnotate(ctx context.Context, repoPath, v string, r *Range, opt *BlameOptions, pattern string) ([]hgAnnotatedFile, error) {
+	args := append([]string{"annotate", "-T", "json", "--changeset"}, opt.hgArgs()...)
+	args = append(args, "-r", v, "--", pattern)
+	var files []hgAnnotatedFile
+	err := hgStream(ctx, repoPath, func(out io.Reader) error {
+		return decodeJSONArray(out, func(dec *json.Decoder) error {
+			var file hgAnnotatedFile
+			if err := dec.Decode(&file); err != nil {
+				return err
+			}
+			files = append(files, file)
+			return nil
+		})
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// writeHgListFile writes files to a temporary file for use with hg's
+// listfile0: pattern, and returns its name.
+func writeHgListFile(files []string) (string, error) {
+	tmpfile, err := ioutil.TempFile("", "hg-files")
+	if err != nil {
+		return "", err
+	}
+	w := bufio.NewWriter(tmpfile)
+	for _, f := range files {
+		// "path:" makes hg treat names as paths relative to the
+		// repository root, not patterns.
+		fmt.Fprintf(w, "path:%s\x00", f)
+	}
+	err = w.Flush()
+	if closeErr := tmpfile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpfile.Name())
+		return "", err
+	}
+	return tmpfile.Name(), nil
+}
+
+// decodeJSONArray calls decodeElem to decode each element of the JSON
+// array that r contains.
+func decodeJSONArray(r io.Reader, decodeElem func(*json.Decoder) error) error {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('[') {
+		return fmt.Errorf("expected JSON array, got %v", tok)
+	}
+	for dec.More() {
+		if err := decodeElem(dec); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token() // ']'
+	return err
+}
+
+// hgAnnotatedFile is a file in the output of hg annotate -T json.
+type hgAnnotatedFile struct {
+	Abspath string // relative to the repository root
+	Lines   []struct {
+		Line string // including the newline
+		Node string
+	}
+}
+
+// hunks returns the hunks of the file's lines (or, if r is non-nil, of
+// the lines that r selects), or nil if it has no lines.
+//
+// Unlike git hunks, a hg hunk's LineEnd is the index of its last line, not
+// the line after it. Hunks after the first one start 1 character after the
+// end of the previous one, and the last one ends 1 character after the end
+// of the file. (These quirks are kept for compatibility with the results
+// of earlier versions of this package.) NormalizeHunks undoes them.
+func (f *hgAnnotatedFile) hunks(r *Range) []Hunk {
+	var (
+		hunks      []Hunk
+		hunk       *Hunk
+		charOffset int
+		lineEnd    = -1
+	)
+	if r != nil {
+		lineEnd = r.End
+	}
+	for lineno, line := range f.Lines {
+		n := len(strings.TrimSuffix(line.Line, "\n")) + 1 // +1 for newline
+		if r != nil && (lineno < r.Start || lineno >= r.End) {
+			// Outside of the requested lines, but still counted so
+			// that the hunks' offsets are relative to the start of the
+			// file.
+			charOffset += n
+			continue
+		}
+
+		commitID := hgShortID(line.Node)
+		if hunk != nil && hunk.CommitID == commitID {
+			charOffset += n
+			hunk.LineEnd++
+			hunk.CharEnd = charOffset
+			continue
+		}
+		if hunk != nil {
+			hunks = append(hunks, *hunk)
+		}
+		hunk = &Hunk{
+			CommitID:  commitID,
+			LineStart: lineno,
+			LineEnd:   lineno,
+			CharStart: charOffset,
+			CharEnd:   charOffset + n,
+		}
+		if hunk.CharStart != 0 {
+			hunk.CharStart++
+		}
+		charOffset += n
+	}
+	if hunk != nil {
+		if lineEnd == -1 || len(f.Lines) <= lineEnd {
+			// The last hunk of the file.
+			hunk.CharEnd = charOffset + 1
+		}
+		hunks = append(hunks, *hunk)
+	}
+	return hunks
+}
+
+// hgNullID is the short ID of hg's null revision, which is the parent of
+// root commits.
+const hgNullID = "000000000000"
+
+// hgShortID returns the 12-character short form of a hg node ID.
+func hgShortID(node string) string {
+	if len(node) > 12 {
+		return node[:12]
+	}
+	return node
+}
+
+// hgLogEntry is a commit in the output of hg log -T json.
+type hgLogEntry struct {
+	Node    string
+	User    string
+	Date    [2]float64 // Unix time and offset in seconds west of UTC
+	Desc    string
+	Parents []string
+}
+
+// hgLog adds the commits up to revision v that touched the files that
+// pattern selects to commits.
+func hgLog(ctx context.Context, repoPath, v, pattern string, commits map[string]Commit) error {
+	return hgStream(ctx, repoPath, func(out io.Reader) error {
+		return decodeJSONArray(out, func(dec *json.Decoder) error {
+			var e hgLogEntry
+			if err := dec.Decode(&e); err != nil {
+				return err
+			}
+			c := e.toCommit()
+			commits[c.ID] = c
+			return nil
+		})
+	}, "log", "-T", "json", "-r", v+":0", "--", pattern)
+}
+
+func (e *hgLogEntry) toCommit() Commit {
+	author := parseHgUser(e.User)
+	date := time.Unix(int64(e.Date[0]), 0).In(time.FixedZone("", -int(e.Date[1])))
+	var parents []string
+	for _, p := range e.Parents {
+		if p := hgShortID(p); p != hgNullID {
+			parents = append(parents, p)
+		}
+	}
+	summary := e.Desc
+	if i := strings.Index(summary, "\n"); i != -1 {
+		summary = summary[:i]
+	}
+	return Commit{
+		ID:      hgShortID(e.Node),
+		Message: e.Desc,
+		Summary: summary,
+		Author:  author,
+		// hg doesn't distinguish between authors and committers.
+		Committer:     author,
+		AuthorDate:    date,
+		CommitterDate: date,
+		Parents:       parents,
+	}
+}
+
+// parseHgUser parses a hg user name such as "Jane Doe <jane@example.com>".
+// hg doesn't validate user names, so it accepts malformed ones (e.g., with
+// a missing ">").
+func parseHgUser(user string) Author {
+	user = strings.TrimSpace(user)
+	i := strings.Index(user, "<")
+	if i == -1 {
+		if strings.Contains(user, "@") {
+			return Author{Email: user}
+		}
+		return Author{Name: user}
+	}
+	email := user[i+1:]
+	if j := strings.Index(email, ">"); j != -1 {
+		email = email[:j]
+	}
+	return Author{
+		Name:  strings.Trim(strings.TrimSpace(user[:i]), `"`),
+		Email: strings.TrimSpace(email),
+	}
+}
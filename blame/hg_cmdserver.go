@@ -0,0 +1,390 @@
+package blame
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HgServerIdleTimeout is how long the hg command server of a repository
+// is kept running after it last ran a command.
+var HgServerIdleTimeout = 5 * time.Minute
+
+// hg commands are run by a command server (hg serve --cmdserver pipe), one
+// per repository, which is started when it's first needed. This avoids
+// the cost of starting hg (and Python) for every command. See
+// https://www.mercurial-scm.org/wiki/CommandServer for the protocol.
+var hgServers = struct {
+	sync.Mutex
+	m map[string]*hgServer // by absolute repository path
+}{m: make(map[string]*hgServer)}
+
+// CloseHgServers shuts down the hg command servers that are running. New
+// ones are started as needed, so it is safe to blame hg repositories
+// afterwards.
+func CloseHgServers() {
+	hgServers.Lock()
+	servers := hgServers.m
+	hgServers.m = make(map[string]*hgServer)
+	hgServers.Unlock()
+	for _, s := range servers {
+		s.close()
+	}
+}
+
+// errHgServerBroken is returned when a command server's process has exited
+// or its output can't be parsed.
+var errHgServerBroken = errors.New("hg command server is broken")
+
+// runHg runs hg with args in the repository at repoPath, writing its
+// output to stdout. If the command server crashes before the command
+// outputs anything, the command is retried once with a new server.
+func runHg(ctx context.Context, repoPath string, stdout io.Writer, args ...string) error {
+	for attempt := 0; ; attempt++ {
+		s, err := hgServerFor(repoPath)
+		if err != nil {
+			return err
+		}
+		w := &countingWriter{w: stdout}
+		err = s.runCommand(ctx, w, args...)
+		if err == nil || ctx.Err() != nil || !s.isBroken() || w.n > 0 || attempt > 0 {
+			return contextErr(ctx, err)
+		}
+		logWarn("restarting hg command server", "repo", repoPath, "err", err)
+	}
+}
+
+// hgOutput runs hg like runHg, and returns its output.
+func hgOutput(ctx context.Context, repoPath string, args ...string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := runHg(ctx, repoPath, &buf, args...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hgStream runs hg like runHg, and calls read with a reader of its output
+// as it is produced. The repository's command server is busy until read
+// returns, so read must not run hg in the same repository.
+func hgStream(ctx context.Context, repoPath string, read func(io.Reader) error, args ...string) error {
+	pr, pw := io.Pipe()
+	runErr := make(chan error, 1)
+	go func() {
+		err := runHg(ctx, repoPath, pw, args...)
+		pw.CloseWithError(err)
+		runErr <- err
+	}()
+
+	err := read(pr)
+	if err == nil {
+		_, err = io.Copy(ioutil.Discard, pr)
+	}
+	// If read failed, further writes fail with io.ErrClosedPipe, and
+	// the rest of the output is discarded.
+	pr.Close()
+	if rerr := <-runErr; rerr != nil && rerr != io.ErrClosedPipe {
+		return rerr
+	}
+	return contextErr(ctx, err)
+}
+
+// hgServerFor returns the running command server for a repository,
+// starting one if necessary.
+func hgServerFor(repoPath string) (*hgServer, error) {
+	absRepoPath, err := filepath.Abs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	hgServers.Lock()
+	defer hgServers.Unlock()
+	if s := hgServers.m[absRepoPath]; s != nil && !s.isBroken() {
+		return s, nil
+	}
+	s, err := startHgServer(absRepoPath)
+	if err != nil {
+		return nil, err
+	}
+	hgServers.m[absRepoPath] = s
+	s.idle = time.AfterFunc(HgServerIdleTimeout, func() {
+		hgServers.Lock()
+		if hgServers.m[absRepoPath] == s {
+			delete(hgServers.m, absRepoPath)
+		}
+		hgServers.Unlock()
+		s.close()
+	})
+	return s, nil
+}
+
+// An hgServer is a connection to a hg command server. It runs one command
+// at a time.
+type hgServer struct {
+	sem    chan struct{} // holds a value while running a command
+	in     io.WriteCloser
+	out    *bufio.Reader
+	broken int32 // set atomically to 1 when the server can't be used
+
+	dir    string        // the repository path
+	cmd    *exec.Cmd     // nil in tests
+	exited chan struct{} // closed when cmd has exited
+	idle   *time.Timer   // shuts the server down when it's idle
+}
+
+func startHgServer(repoPath string) (*hgServer, error) {
+	// The server outlives the contexts of the commands it runs, so it
+	// isn't started with command.
+	cmd := exec.Command("hg", "serve", "--cmdserver", "pipe", "--config", "ui.interactive=False")
+	cmd.Dir = repoPath
+	// HGPLAIN disables user settings that change hg's output.
+	cmd.Env = append(os.Environ(), "HGPLAIN=1", "HGENCODING=UTF-8")
+	stderr := &stderrBuffer{}
+	cmd.Stderr = stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, newCommandError(repoPath, cmd.Args, nil, err)
+	}
+
+	s := &hgServer{dir: repoPath, sem: make(chan struct{}, 1), in: in, out: bufio.NewReader(out), cmd: cmd, exited: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(s.exited)
+	}()
+	if err := s.readHello(); err != nil {
+		// hg exits when the repository can't be opened, after saying why
+		// on stderr.
+		s.kill()
+		<-s.exited
+		return nil, newCommandError(repoPath, cmd.Args, stderr.Bytes(), fmt.Errorf("starting command server: %s", err))
+	}
+	return s, nil
+}
+
+// readHello reads the message that the server sends when it starts, and
+// checks that it supports the runcommand command.
+func (s *hgServer) readHello() error {
+	ch, n, err := s.readHeader()
+	if err != nil {
+		return err
+	}
+	hello := make([]byte, n)
+	if _, err := io.ReadFull(s.out, hello); err != nil {
+		return err
+	}
+	if ch != 'o' {
+		return fmt.Errorf("unexpected hello message on channel %q", ch)
+	}
+	for _, line := range strings.Split(string(hello), "\n") {
+		if strings.HasPrefix(line, "capabilities:") && strings.Contains(line+" ", " runcommand ") {
+			return nil
+		}
+	}
+	return fmt.Errorf("server doesn't support runcommand: %q", hello)
+}
+
+// runCommand runs hg with args, writing its output to stdout. It waits
+// for the command that is running (if any) to finish first, unless ctx is
+// done. If ctx is done before the command finishes, the server is killed.
+func (s *hgServer) runCommand(ctx context.Context, stdout io.Writer, args ...string) error {
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.sem }()
+	if s.isBroken() {
+		return errHgServerBroken
+	}
+	if s.idle != nil {
+		s.idle.Stop()
+		defer s.idle.Reset(HgServerIdleTimeout)
+	}
+
+	// The server is only killed while the exchange is running: once the
+	// command has finished, the server is healthy even if ctx is done.
+	var (
+		mu      sync.Mutex
+		running = true
+		killed  bool
+	)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			mu.Lock()
+			if running {
+				s.setBroken()
+				s.kill()
+				killed = true
+			}
+			mu.Unlock()
+		case <-done:
+		}
+	}()
+
+	code, stderr, writeErr, err := s.exchange(stdout, args)
+	mu.Lock()
+	running = false
+	mu.Unlock()
+	if killed {
+		return contextErr(ctx, errHgServerBroken)
+	}
+	if err != nil {
+		s.setBroken()
+		s.kill()
+		return contextErr(ctx, err)
+	}
+	if code != 0 {
+		return newCommandError(s.dir, append([]string{"hg"}, args...), stderr, fmt.Errorf("exit status %d", code))
+	}
+	logStderr(s.dir, append([]string{"hg"}, args...), stderr)
+	return writeErr
+}
+
+// exchange sends a runcommand request and reads the response. writeErr is
+// the first error that writing to stdout returned (the rest of the output
+// is discarded after that); err is a protocol error, after which the
+// server can't be used.
+func (s *hgServer) exchange(stdout io.Writer, args []string) (code int32, stderr []byte, writeErr, err error) {
+	data := strings.Join(args, "\x00")
+	req := make([]byte, len("runcommand\n")+4+len(data))
+	n := copy(req, "runcommand\n")
+	binary.BigEndian.PutUint32(req[n:], uint32(len(data)))
+	copy(req[n+4:], data)
+	if _, err := s.in.Write(req); err != nil {
+		return 0, nil, nil, err
+	}
+
+	var errBuf bytes.Buffer
+	var buf []byte
+	for {
+		ch, n, err := s.readHeader()
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		switch ch {
+		case 'o', 'e':
+			if cap(buf) < int(n) {
+				buf = make([]byte, n)
+			}
+			buf = buf[:n]
+			if _, err := io.ReadFull(s.out, buf); err != nil {
+				return 0, nil, nil, err
+			}
+			if ch == 'e' {
+				errBuf.Write(buf)
+			} else if writeErr == nil {
+				_, writeErr = stdout.Write(buf)
+			}
+		case 'r':
+			if err := binary.Read(s.out, binary.BigEndian, &code); err != nil {
+				return 0, nil, nil, err
+			}
+			return code, errBuf.Bytes(), writeErr, nil
+		case 'I', 'L':
+			// hg wants input; send an empty response to signal EOF.
+			if _, err := s.in.Write([]byte{0, 0, 0, 0}); err != nil {
+				return 0, nil, nil, err
+			}
+		default:
+			if ch >= 'A' && ch <= 'Z' {
+				// Unknown required channels can't be ignored.
+				return 0, nil, nil, fmt.Errorf("%w: unexpected required channel %q", errHgServerBroken, ch)
+			}
+			if _, err := io.CopyN(ioutil.Discard, s.out, int64(n)); err != nil {
+				return 0, nil, nil, err
+			}
+		}
+	}
+}
+
+// readHeader reads the channel identifier and length that precede each
+// message from the server.
+func (s *hgServer) readHeader() (ch byte, n uint32, err error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(s.out, hdr[:]); err != nil {
+		return 0, 0, err
+	}
+	return hdr[0], binary.BigEndian.Uint32(hdr[1:]), nil
+}
+
+// isBroken returns true if the server can't be used, because it has
+// exited or failed.
+func (s *hgServer) isBroken() bool {
+	if atomic.LoadInt32(&s.broken) != 0 {
+		return true
+	}
+	select {
+	case <-s.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *hgServer) setBroken() {
+	atomic.StoreInt32(&s.broken, 1)
+}
+
+// kill kills the server process. It may be called while a command is
+// running.
+func (s *hgServer) kill() {
+	if s.cmd != nil && s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+	s.in.Close()
+}
+
+// close shuts the server down, waiting for the running command (if any)
+// to finish. The server exits when its stdin is closed; if it doesn't do
+// so promptly, it is killed.
+func (s *hgServer) close() {
+	s.sem <- struct{}{}
+	defer func() { <-s.sem }()
+	s.setBroken()
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+	s.in.Close()
+	if s.cmd == nil {
+		return
+	}
+	select {
+	case <-s.exited:
+	case <-time.After(5 * time.Second):
+		s.cmd.Process.Kill()
+		<-s.exited
+	}
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
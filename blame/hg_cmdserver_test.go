@@ -0,0 +1,205 @@
+package blame
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeHgServer speaks the command server protocol over pipes. It responds
+// to each command with the messages that respond returns for its
+// arguments.
+func fakeHgServer(t *testing.T, respond func(args []string) [][]byte) *hgServer {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	go func() {
+		defer serverOut.Close()
+		serverOut.Write(hgMessage('o', "capabilities: getencoding runcommand\nencoding: UTF-8"))
+		in := bufio.NewReader(serverIn)
+		for {
+			line, err := in.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if line != "runcommand\n" {
+				t.Errorf("got command %q", line)
+				return
+			}
+			var n uint32
+			if err := binary.Read(in, binary.BigEndian, &n); err != nil {
+				return
+			}
+			data := make([]byte, n)
+			if _, err := io.ReadFull(in, data); err != nil {
+				return
+			}
+			for _, msg := range respond(strings.Split(string(data), "\x00")) {
+				if _, err := serverOut.Write(msg); err != nil {
+					return
+				}
+				if msg[0] == 'L' {
+					// Read the client's (empty) input.
+					if err := binary.Read(in, binary.BigEndian, &n); err != nil || n != 0 {
+						t.Errorf("got input of length %d (error %v), want 0", n, err)
+						return
+					}
+				}
+			}
+		}
+	}()
+	s := &hgServer{sem: make(chan struct{}, 1), in: clientOut, out: bufio.NewReader(clientIn)}
+	if err := s.readHello(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// useHgServer makes s the command server of the repository at dir, until
+// the test ends.
+func useHgServer(t *testing.T, dir string, s *hgServer) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hgServers.Lock()
+	hgServers.m[absDir] = s
+	hgServers.Unlock()
+	t.Cleanup(func() {
+		hgServers.Lock()
+		delete(hgServers.m, absDir)
+		hgServers.Unlock()
+	})
+}
+
+func hgMessage(ch byte, data string) []byte {
+	msg := []byte{ch, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(msg[1:], uint32(len(data)))
+	return append(msg, data...)
+}
+
+func hgResult(code int32) []byte {
+	var data [4]byte
+	binary.BigEndian.PutUint32(data[:], uint32(code))
+	return hgMessage('r', string(data[:]))
+}
+
+func TestHgServer_runCommand(t *testing.T) {
+	s := fakeHgServer(t, func(args []string) [][]byte {
+		switch args[0] {
+		case "cat":
+			return [][]byte{hgMessage('o', "a\n"), hgMessage('d', "debug"), hgMessage('L', ""), hgMessage('o', "b\n"), hgResult(0)}
+		case "fail":
+			return [][]byte{hgMessage('e', "abort: f: no such file in rev 0123456789ab\n"), hgResult(255)}
+		default:
+			return [][]byte{hgMessage('X', ""), hgResult(0)}
+		}
+	})
+
+	var out bytes.Buffer
+	if err := s.runCommand(context.Background(), &out, "cat", "-r", "tip", "a b"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "a\nb\n" {
+		t.Errorf("got output %q", out.String())
+	}
+
+	err := s.runCommand(context.Background(), &out, "fail")
+	if err == nil || !strings.Contains(err.Error(), "abort: f: no such file") {
+		t.Errorf("got error %v, want hg's error message", err)
+	}
+	if !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("got error %v, want ErrFileNotFound", err)
+	}
+	if s.isBroken() {
+		t.Fatal("server is broken after failed command")
+	}
+
+	// The server can still be used after a failed command.
+	out.Reset()
+	if err := s.runCommand(context.Background(), &out, "cat"); err != nil || out.String() != "a\nb\n" {
+		t.Errorf("got output %q and error %v", out.String(), err)
+	}
+
+	if err := s.runCommand(context.Background(), &out, "unknown"); err == nil {
+		t.Error("got nil error for unknown required channel")
+	}
+	if !s.isBroken() {
+		t.Error("server isn't broken after protocol error")
+	}
+}
+
+func TestHgServer_runCommandQueued(t *testing.T) {
+	release := make(chan struct{})
+	s := fakeHgServer(t, func(args []string) [][]byte {
+		if args[0] == "slow" {
+			<-release
+		}
+		return [][]byte{hgResult(0)}
+	})
+
+	slowDone := make(chan error, 1)
+	go func() { slowDone <- s.runCommand(context.Background(), ioutil.Discard, "slow") }()
+	for len(s.sem) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A command waiting for the slow one gives up when its context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.runCommand(ctx, ioutil.Discard, "fast"); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	if err := <-slowDone; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.runCommand(context.Background(), ioutil.Discard, "fast"); err != nil {
+		t.Errorf("after the slow command: got error %v", err)
+	}
+}
+
+// cancelingWriter calls cancel when it's written to.
+type cancelingWriter struct{ cancel context.CancelFunc }
+
+func (w cancelingWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return len(p), nil
+}
+
+func TestHgServer_runCommandCanceled(t *testing.T) {
+	// The context is canceled just before the command finishes, so that
+	// the server is killed either while the command is running (and it
+	// fails) or not at all.
+	for i := 0; i < 100; i++ {
+		s := fakeHgServer(t, func(args []string) [][]byte {
+			return [][]byte{hgMessage('o', "a\n"), hgResult(0)}
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		err := s.runCommand(ctx, cancelingWriter{cancel}, "cat")
+		if err != nil {
+			if err != context.Canceled {
+				t.Fatalf("got error %v, want %v", err, context.Canceled)
+			}
+			if !s.isBroken() {
+				t.Fatal("server isn't broken after it was killed")
+			}
+			continue
+		}
+		time.Sleep(time.Millisecond)
+		if s.isBroken() {
+			t.Fatal("server is broken after the command succeeded")
+		}
+		if err := s.runCommand(context.Background(), ioutil.Discard, "cat"); err != nil {
+			t.Fatalf("after the command succeeded: got error %v", err)
+		}
+	}
+}
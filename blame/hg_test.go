@@ -0,0 +1,83 @@
+package blame
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testHgAnnotateJSON is hg annotate -T json --changeset output for a file
+// with the same line lengths and changesets as "foo" in the
+// go-vcs-hgtest repository.
+const testHgAnnotateJSON = `[
+ {
+  "abspath": "foo",
+  "lines": [{"line": "0123456789\n", "node": "d047adf8d7ff1a1e0c4f1ea5bce3b6ea0b39a5f1"}, {"line": "1234567\n", "node": "52f96eab35cf2b1ad3e2bd1ab4eb0e33b0e1c8a2"}, {"line": "1234567\n", "node": "52f96eab35cf2b1ad3e2bd1ab4eb0e33b0e1c8a2"}, {"line": "12345678901\n", "node": "d14ec9caa006a1b6f8f1d1b0c4c6f2a3e1e0d9b3"}, {"line": "abc\n", "node": "52f96eab35cf2b1ad3e2bd1ab4eb0e33b0e1c8a2"}, {"line": "abcd\n", "node": "52f96eab35cf2b1ad3e2bd1ab4eb0e33b0e1c8a2"}],
+  "path": "foo"
+ }
+]`
+
+func TestHgAnnotatedFile_hunks(t *testing.T) {
+	var files []hgAnnotatedFile
+	err := decodeJSONArray(strings.NewReader(testHgAnnotateJSON), func(dec *json.Decoder) error {
+		var f hgAnnotatedFile
+		err := dec.Decode(&f)
+		files = append(files, f)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Abspath != "foo" {
+		t.Fatalf("got files %+v", files)
+	}
+
+	if hunks := files[0].hunks(nil); !reflect.DeepEqual(hunks, expHunksHg["foo"]) {
+		t.Errorf("got hunks %+v, want %+v", hunks, expHunksHg["foo"])
+	}
+
+	want := []Hunk{
+		{CommitID: "52f96eab35cf", LineStart: 2, LineEnd: 2, CharStart: 20, CharEnd: 27},
+		{CommitID: "d14ec9caa006", LineStart: 3, LineEnd: 3, CharStart: 28, CharEnd: 39},
+	}
+	if hunks := files[0].hunks(&Range{Start: 2, End: 4}); !reflect.DeepEqual(hunks, want) {
+		t.Errorf("got hunks %+v for lines [2, 4), want %+v", hunks, want)
+	}
+	if hunks := files[0].hunks(&Range{Start: 3, End: 10}); !reflect.DeepEqual(hunks, expHunksHg["foo"][2:]) {
+		t.Errorf("got hunks %+v for lines [3, 10), want %+v", hunks, expHunksHg["foo"][2:])
+	}
+}
+
+func TestHgLogEntry_toCommit(t *testing.T) {
+	var entries []hgLogEntry
+	err := json.Unmarshal([]byte(`[
+ {"node": "d14ec9caa006a1b6f8f1d1b0c4c6f2a3e1e0d9b3", "user": "Quinn Slack <qslack@qslack.com>", "date": [1385990211.0, 28800], "desc": "interleave", "parents": ["52f96eab35cf2b1ad3e2bd1ab4eb0e33b0e1c8a2"]},
+ {"node": "d047adf8d7ff1a1e0c4f1ea5bce3b6ea0b39a5f1", "user": "Quinn Slack <qslack@qslack.com", "date": [1370140791.0, 25200], "desc": "foo", "parents": ["0000000000000000000000000000000000000000"]}
+]`), &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		c := e.toCommit()
+		if want := expCommitsHg[c.ID]; !reflect.DeepEqual(c, want) {
+			t.Errorf("got commit %+v, want %+v", c, want)
+		}
+	}
+}
+
+func TestParseHgUser(t *testing.T) {
+	tests := map[string]Author{
+		"Jane Doe <jane@example.com>":    {Name: "Jane Doe", Email: "jane@example.com"},
+		`"Doe, Jane" <jane@example.com>`: {Name: "Doe, Jane", Email: "jane@example.com"},
+		"Jane Doe <jane@example.com":     {Name: "Jane Doe", Email: "jane@example.com"},
+		"<jane@example.com>":             {Email: "jane@example.com"},
+		"jane@example.com":               {Email: "jane@example.com"},
+		"jane":                           {Name: "jane"},
+	}
+	for user, want := range tests {
+		if got := parseHgUser(user); got != want {
+			t.Errorf("%q: got %+v, want %+v", user, got, want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package blame
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// A Matcher selects files to skip when blaming a repository. It is built
+// from a list of patterns, which are matched against slash-separated
+// paths relative to the repository root, as in a .gitignore file:
+//
+//   - A pattern without a slash (other than a trailing one) matches a file
+//     or directory with that name at any depth: "vendor" matches
+//     "vendor/a.go" and "src/vendor/b.go", but not "src/vendorlib.go".
+//   - Other patterns are anchored to the repository root: "/build" and
+//     "docs/*.md" only match at the top level.
+//   - A trailing slash only matches directories.
+//   - "*" matches anything except a slash, "?" matches any one character
+//     except a slash, and "[...]" matches a character class.
+//   - "**/" matches any number of leading directories, "/**" matches
+//     everything inside a directory, and "/**/" matches zero or more
+//     directories.
+//   - A pattern prefixed with "!" re-includes files that an earlier
+//     pattern excluded. As in git, files in an excluded directory can't be
+//     re-included.
+//   - A pattern prefixed with "re:" (or "!re:") is a regular expression,
+//     which is matched anywhere in a file's path.
+//
+// Empty patterns and patterns that begin with "#" are ignored.
+type Matcher struct {
+	patterns []*pathPattern
+}
+
+// NewMatcher returns a Matcher for patterns.
+func NewMatcher(patterns []string) (*Matcher, error) {
+	m := new(Matcher)
+	for _, s := range patterns {
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		p, err := parsePathPattern(s, true)
+		if err != nil {
+			return nil, err
+		}
+		m.patterns = append(m.patterns, p)
+	}
+	return m, nil
+}
+
+// Match returns true if the file at path p should be skipped.
+func (m *Matcher) Match(p string) bool {
+	if m == nil || len(m.patterns) == 0 {
+		return false
+	}
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && m.match(p[:i], true) {
+			return true
+		}
+	}
+	return m.match(p, false)
+}
+
+// match returns true if the last pattern that matches p excludes it.
+func (m *Matcher) match(p string, isDir bool) bool {
+	excluded := false
+	for _, pat := range m.patterns {
+		if pat.match(p, isDir) {
+			excluded = !pat.negate
+		}
+	}
+	return excluded
+}
+
+// A pathPattern is a gitignore-style glob or a regular expression. It is
+// used for both ignore patterns and .gitattributes patterns.
+type pathPattern struct {
+	re       *regexp.Regexp
+	isRegexp bool // re is a user-supplied regular expression, not a glob
+	negate   bool
+	dirOnly  bool
+	anchored bool // matched against the whole path, not just the last element
+}
+
+// parsePathPattern parses a pattern. Negations and regular expressions
+// are only recognized if allowNegate is true (they aren't allowed in
+// .gitattributes files).
+func parsePathPattern(s string, allowNegate bool) (*pathPattern, error) {
+	orig := s
+	p := new(pathPattern)
+	if allowNegate {
+		if strings.HasPrefix(s, "!") {
+			p.negate = true
+			s = s[1:]
+		}
+		if strings.HasPrefix(s, "re:") {
+			re, err := regexp.Compile(s[len("re:"):])
+			if err != nil {
+				return nil, fmt.Errorf("blame: bad ignore pattern %q: %s", orig, err)
+			}
+			p.re, p.isRegexp = re, true
+			return p, nil
+		}
+	}
+
+	if strings.HasPrefix(s, `\!`) || strings.HasPrefix(s, `\#`) {
+		s = s[1:]
+	}
+	if strings.HasSuffix(s, "/") {
+		p.dirOnly = true
+		s = strings.TrimSuffix(s, "/")
+	}
+	if strings.Contains(s, "/") {
+		p.anchored = true
+		s = strings.TrimPrefix(s, "/")
+	}
+	if s == "" {
+		return nil, fmt.Errorf("blame: bad pattern %q", orig)
+	}
+	re, err := regexp.Compile("^" + globRegexp(s) + "$")
+	if err != nil {
+		return nil, fmt.Errorf("blame: bad pattern %q: %s", orig, err)
+	}
+	p.re = re
+	return p, nil
+}
+
+// match returns true if the pattern matches the file or directory at path
+// p, ignoring negation.
+func (p *pathPattern) match(pth string, isDir bool) bool {
+	if p.isRegexp {
+		return !isDir && p.re.MatchString(pth)
+	}
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if !p.anchored {
+		pth = path.Base(pth)
+	}
+	return p.re.MatchString(pth)
+}
+
+// globRegexp returns the regular expression (without anchors) for a glob.
+func globRegexp(glob string) string {
+	var re strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") && (i == 0 || glob[i-1] == '/') {
+				rest := glob[i+2:]
+				switch {
+				case rest == "":
+					// Trailing "/**" (or the whole pattern): everything.
+					re.WriteString(".*")
+					i++
+					continue
+				case rest[0] == '/':
+					// Leading "**/" or inner "/**/": zero or more
+					// directories.
+					re.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				}
+			}
+			for i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+			}
+			re.WriteString("[^/]*")
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end == -1 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if end == 0 && i+2 < len(glob) {
+				// "[]...]" contains a literal "]".
+				if next := strings.IndexByte(glob[i+2:], ']'); next != -1 {
+					class = glob[i+1 : i+2+next]
+				}
+			}
+			i += len(class) + 1
+			re.WriteByte('[')
+			if strings.HasPrefix(class, "!") || strings.HasPrefix(class, "^") {
+				re.WriteByte('^')
+				class = class[1:]
+			}
+			re.WriteString(strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(class))
+			re.WriteByte(']')
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				re.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			} else {
+				re.WriteString(`\\`)
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return re.String()
+}
+
+// filterFiles returns the files that m doesn't match, omitting empty
+// paths.
+func filterFiles(files []string, m *Matcher) []string {
+	var kept []string
+	for _, file := range files {
+		if file != "" && !m.Match(file) {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
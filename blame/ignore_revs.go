@@ -0,0 +1,267 @@
+package blame
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// gitIgnoreRevsFile is the conventional name of the file that lists
+// commits for git blame to ignore.
+const gitIgnoreRevsFile = ".git-blame-ignore-revs"
+
+// prepareGitOptions returns a copy of opt that is ready to be used for
+// blaming files at revision v. It notes the files that the repository's
+// blame.ignoreRevsFile setting names, which git blame reads by itself. If
+// opt.ReadIgnoreRevsFile is set, it copies the revision's
+// .git-blame-ignore-revs file to a temporary file, which cleanup removes.
+func prepareGitOptions(ctx context.Context, repoPath, v string, opt *BlameOptions) (prepared *BlameOptions, cleanup func(), err error) {
+	cleanup = func() {}
+	if opt != nil && opt.gitPrepared {
+		return opt, cleanup, nil
+	}
+	var optCopy BlameOptions
+	if opt != nil {
+		optCopy = *opt
+	}
+	optCopy.gitPrepared = true
+	if optCopy.configIgnoreRevsFiles, err = gitConfigIgnoreRevsFiles(ctx, repoPath); err != nil {
+		return nil, nil, err
+	}
+	if !optCopy.ReadIgnoreRevsFile {
+		return &optCopy, cleanup, nil
+	}
+
+	// rev-parse prints nothing (and exits nonzero) if the file doesn't
+	// exist at v.
+	out, _ := command(ctx, repoPath, "git", "rev-parse", "--verify", "--quiet", v+":"+gitIgnoreRevsFile).Output()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	blobID := strings.TrimSpace(string(out))
+	if blobID == "" {
+		return &optCopy, cleanup, nil
+	}
+	cmd := command(ctx, repoPath, "git", "cat-file", "blob", blobID)
+	data, err := cmd.Output()
+	if err = commandErr(ctx, cmd, err); err != nil {
+		return nil, nil, err
+	}
+
+	tmpfile, err := ioutil.TempFile("", "git-blame-ignore-revs")
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = tmpfile.Write(data)
+	tmpfile.Close()
+	if err != nil {
+		os.Remove(tmpfile.Name())
+		return nil, nil, err
+	}
+
+	optCopy.revIgnoreRevsFile = tmpfile.Name()
+	return &optCopy, func() { os.Remove(tmpfile.Name()) }, nil
+}
+
+// gitConfigIgnoreRevsFiles returns the absolute paths of the files that
+// the blame.ignoreRevsFile setting of the repository at repoPath lists.
+// As in git, an empty value clears the list, and relative paths are
+// relative to the top of the work tree.
+func gitConfigIgnoreRevsFiles(ctx context.Context, repoPath string) ([]string, error) {
+	// git config exits with status 1 if the setting isn't set.
+	out, _ := command(ctx, repoPath, "git", "config", "--get-all", "--path", "blame.ignoreRevsFile").Output()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	var files []string
+	for _, file := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+		if file == "" {
+			files = nil
+			continue
+		}
+		files = append(files, file)
+	}
+	var top string
+	for i, file := range files {
+		if filepath.IsAbs(file) {
+			continue
+		}
+		if top == "" {
+			// A bare repository has no work tree, and git blame, which
+			// runs in repoPath, resolves the paths relative to it.
+			out, _ := command(ctx, repoPath, "git", "rev-parse", "--show-toplevel").Output()
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if top = strings.TrimSuffix(string(out), "\n"); top == "" {
+				top = repoPath
+			}
+		}
+		files[i] = filepath.Join(top, file)
+	}
+	return files, nil
+}
+
+// gitBlameIgnoredLineRE matches the part of a line of git blame -s -f -n
+// output between the commit ID and the line's content: the file name
+// (padded), the original line number and the final line number.
+var gitBlameIgnoredLineRE = regexp.MustCompile(`^ (.*?) +(\d+) +(\d+)\) `)
+
+// blameGitFileIgnoringRevs blames a file like blameGitFileRange does, for
+// options that make git ignore commits. git's porcelain output doesn't say
+// which lines were blamed by looking past an ignored commit, so this
+// parses its default output format instead, in which
+// blame.markIgnoredLines prefixes the commit IDs of those lines with "?".
+// Lines are grouped into hunks as in the porcelain output, which never
+// mixes ignored and other lines. Only the IDs of the returned commits are
+// set; binary is true if the file is binary, as for porcelainParser.
+func blameGitFileIgnoringRevs(ctx context.Context, repoPath, filePath, v string, r *Range, charOffset int, opt *BlameOptions) (hunks []Hunk, commits map[string]Commit, binary bool, err error) {
+	// --root keeps git from marking root commits as boundaries (with a
+	// "^", which, like the other marks, takes the place of a character of
+	// the commit ID).
+	args := []string{
+		"-c", "blame.markIgnoredLines=true", "-c", "blame.markUnblamableLines=false",
+		"-c", "blame.blankBoundary=false", "-c", "blame.coloring=none",
+		"blame", "-s", "-l", "-f", "-n", "--root",
+	}
+	args = append(args, opt.gitArgs()...)
+	args = append(args, r.gitArgs()...)
+	args = append(args, v, "--", filePath)
+	cmd := command(ctx, repoPath, "git", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, false, commandErr(ctx, cmd, err)
+	}
+
+	var (
+		br       = bufio.NewReader(stdout)
+		lineno   = 1
+		hunk     *Hunk
+		prevName string
+		prevOrig int
+	)
+	if r != nil {
+		lineno = r.Start + 1
+	}
+	for ; ; lineno++ {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil && err != io.EOF {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil, nil, false, contextErr(ctx, err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		marks := len(line) - len(strings.TrimLeft(line, "^*?"))
+		var m []string
+		if len(line) >= 40 {
+			m = gitBlameIgnoredLineRE.FindStringSubmatch(line[40:])
+		}
+		if m == nil || m[3] != strconv.Itoa(lineno) {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil, nil, false, fmt.Errorf("unexpected git blame output line: %q", line)
+		}
+		id, ignored := line[marks:40], strings.Contains(line[:marks], "?")
+		name := m[1]
+		orig, _ := strconv.Atoi(m[2])
+		content := line[40+len(m[0]):]
+
+		if hunk == nil || hunk.CommitID != id || hunk.Ignored != ignored || name != prevName || orig != prevOrig+1 {
+			if hunk != nil {
+				hunks = append(hunks, *hunk)
+			}
+			hunk = &Hunk{CommitID: id, LineStart: lineno - 1, LineEnd: lineno - 1, CharStart: charOffset, CharEnd: charOffset, Ignored: ignored}
+		}
+		if n := 8000 - charOffset; n > 0 {
+			if len(content) < n {
+				n = len(content)
+			}
+			binary = binary || isBinary([]byte(content[:n]))
+		}
+		charOffset += len(content) + 1 // +1 for the newline
+		hunk.LineEnd++
+		hunk.CharEnd = charOffset
+		prevName, prevOrig = name, orig
+	}
+	if hunk != nil {
+		hunks = append(hunks, *hunk)
+	}
+	if err := commandErr(ctx, cmd, cmd.Wait()); err != nil {
+		return nil, nil, false, err
+	}
+
+	if err := resolveGitCommitIDs(ctx, repoPath, hunks); err != nil {
+		return nil, nil, false, err
+	}
+	commits = make(map[string]Commit)
+	for _, h := range hunks {
+		commits[h.CommitID] = Commit{ID: h.CommitID}
+	}
+	return hunks, commits, binary, nil
+}
+
+// resolveGitCommitIDs replaces the commit IDs of hunks that git blame
+// shortened to make room for its marks by the full IDs.
+func resolveGitCommitIDs(ctx context.Context, repoPath string, hunks []Hunk) error {
+	full := make(map[string]string)
+	var short []string
+	for _, h := range hunks {
+		if len(h.CommitID) == 40 {
+			full[h.CommitID] = h.CommitID
+		}
+	}
+	for _, h := range hunks {
+		if _, ok := full[h.CommitID]; ok {
+			continue
+		}
+		for id := range full {
+			if strings.HasPrefix(id, h.CommitID) {
+				full[h.CommitID] = id
+				break
+			}
+		}
+		if _, ok := full[h.CommitID]; !ok {
+			full[h.CommitID] = ""
+			short = append(short, h.CommitID)
+		}
+	}
+	if len(short) > 0 {
+		args := []string{"rev-parse"}
+		for _, id := range short {
+			args = append(args, id+"^{commit}")
+		}
+		cmd := command(ctx, repoPath, "git", args...)
+		out, err := cmd.Output()
+		if err = commandErr(ctx, cmd, err); err != nil {
+			return err
+		}
+		ids := strings.Fields(string(out))
+		if len(ids) != len(short) {
+			return fmt.Errorf("git rev-parse resolved %d of %d commit IDs", len(ids), len(short))
+		}
+		for i, id := range short {
+			full[id] = ids[i]
+		}
+	}
+	for i, h := range hunks {
+		hunks[i].CommitID = full[h.CommitID]
+	}
+	return nil
+}
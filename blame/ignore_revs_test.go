@@ -0,0 +1,126 @@
+package blame
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBlameGitFile_IgnoreRevs(t *testing.T) {
+	r := newTestGitRepo(t)
+	add := r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add f", files: map[string]string{"f": "a(b)\nc(d)\ne\n"}})
+	reformat := r.commit(testCommit{author: "B <b@example.com>", date: "2014-01-02T00:00:00Z", message: "reformat", files: map[string]string{"f": "a( b )\nc( d )\ne\nnew\n"}})
+
+	wantHunks := []Hunk{
+		{CommitID: add, LineStart: 0, LineEnd: 2, CharStart: 0, CharEnd: 14, Ignored: true},
+		{CommitID: add, LineStart: 2, LineEnd: 3, CharStart: 14, CharEnd: 16},
+		{CommitID: reformat, LineStart: 3, LineEnd: 4, CharStart: 16, CharEnd: 20},
+	}
+	hunks, _, err := BlameGitFileContext(context.Background(), r.dir, "f", "HEAD", &BlameOptions{NoIgnoreWhitespace: true, IgnoreRevs: []string{reformat}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hunks, wantHunks) {
+		t.Errorf("got hunks %+v, want %+v", hunks, wantHunks)
+	}
+
+	// The .git-blame-ignore-revs file only applies to revisions that
+	// contain it.
+	r.commit(testCommit{author: "B <b@example.com>", date: "2014-01-03T00:00:00Z", message: "ignore reformat", files: map[string]string{gitIgnoreRevsFile: "# reformat\n" + reformat + "\n"}})
+	opt := &BlameOptions{NoIgnoreWhitespace: true, ReadIgnoreRevsFile: true}
+	hunks, _, err = BlameGitFileContext(context.Background(), r.dir, "f", "HEAD", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hunks, wantHunks) {
+		t.Errorf("got hunks %+v, want %+v", hunks, wantHunks)
+	}
+
+	hunks, _, err = BlameGitFileContext(context.Background(), r.dir, "f", reformat, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range hunks {
+		if h.Ignored {
+			t.Errorf("got ignored hunk %+v at a revision without %s", h, gitIgnoreRevsFile)
+		}
+	}
+}
+
+func TestBlameGitFile_IgnoreRevs_split(t *testing.T) {
+	r := newTestGitRepo(t)
+	add := r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add f", files: map[string]string{"f": "a(b)\nc(d)\ne\n"}})
+	reformat := r.commit(testCommit{author: "B <b@example.com>", date: "2014-01-02T00:00:00Z", message: "reformat", files: map[string]string{"f": "a( b )\nc(d)\ne\nnew\n"}})
+	opt := &BlameOptions{NoIgnoreWhitespace: true, IgnoreRevs: []string{reformat}}
+
+	// Only the first line of the first hunk was blamed past the ignored
+	// commit.
+	wantHunks := []Hunk{
+		{CommitID: add, LineStart: 0, LineEnd: 1, CharStart: 0, CharEnd: 7, Ignored: true},
+		{CommitID: add, LineStart: 1, LineEnd: 3, CharStart: 7, CharEnd: 14},
+		{CommitID: reformat, LineStart: 3, LineEnd: 4, CharStart: 14, CharEnd: 18},
+	}
+	hunks, commits, err := BlameGitFileContext(context.Background(), r.dir, "f", "HEAD", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hunks, wantHunks) {
+		t.Errorf("got hunks %+v, want %+v", hunks, wantHunks)
+	}
+	if c := commits[add]; c.Author.Name != "A" || c.Summary != "add f" {
+		t.Errorf("got commit %+v, want the details of %s", c, add)
+	}
+
+	hunks, _, err = BlameGitFileRangeContext(context.Background(), r.dir, "f", "HEAD", 1, 3, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := wantHunks[1:2]; !reflect.DeepEqual(hunks, want) {
+		t.Errorf("got range hunks %+v, want %+v", hunks, want)
+	}
+}
+
+func TestBlameGitFile_IgnoreRevs_unrelated(t *testing.T) {
+	r := newTestGitRepo(t)
+	r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add f", files: map[string]string{"f": "a\nb\r\nc\n"}})
+	r.commit(testCommit{author: "B <b@example.com>", date: "2014-01-02T00:00:00Z", message: "change f", files: map[string]string{"f": "a\nB\r\nc\nd"}})
+	unrelated := r.commit(testCommit{author: "B <b@example.com>", date: "2014-01-03T00:00:00Z", message: "add g", files: map[string]string{"g": "g\n"}})
+
+	// Ignoring a commit that didn't change the file must give the same
+	// result as not ignoring any.
+	wantHunks, wantCommits, err := BlameGitFileContext(context.Background(), r.dir, "f", "HEAD", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hunks, commits, err := BlameGitFileContext(context.Background(), r.dir, "f", "HEAD", &BlameOptions{IgnoreRevs: []string{unrelated}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hunks, wantHunks) {
+		t.Errorf("got hunks %+v, want %+v", hunks, wantHunks)
+	}
+	if !reflect.DeepEqual(commits, wantCommits) {
+		t.Errorf("got commits %+v, want %+v", commits, wantCommits)
+	}
+}
+
+func TestBlameGitFile_IgnoreRevsConfig(t *testing.T) {
+	r := newTestGitRepo(t)
+	add := r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add f", files: map[string]string{"f": "a(b)\n"}})
+	reformat := r.commit(testCommit{author: "B <b@example.com>", date: "2014-01-02T00:00:00Z", message: "reformat", files: map[string]string{"f": "a( b )\n"}})
+	if err := ioutil.WriteFile(filepath.Join(r.dir, "ignored"), []byte(reformat+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r.git(nil, "config", "blame.ignoreRevsFile", "ignored")
+
+	hunks, _, err := BlameGitFileContext(context.Background(), r.dir, "f", "HEAD", &BlameOptions{NoIgnoreWhitespace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHunks := []Hunk{{CommitID: add, LineStart: 0, LineEnd: 1, CharStart: 0, CharEnd: 7, Ignored: true}}
+	if !reflect.DeepEqual(hunks, wantHunks) {
+		t.Errorf("got hunks %+v, want %+v", hunks, wantHunks)
+	}
+}
@@ -0,0 +1,165 @@
+package blame
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		match    []string
+		noMatch  []string
+	}{
+		{
+			patterns: []string{"vendor"},
+			match:    []string{"vendor", "vendor/a.go", "src/vendor/b/c.go"},
+			noMatch:  []string{"src/vendorlib.go", "myvendor/a.go"},
+		},
+		{
+			patterns: []string{"vendor/"},
+			match:    []string{"vendor/a.go", "src/vendor/b.go"},
+			noMatch:  []string{"vendor", "src/vendor"},
+		},
+		{
+			patterns: []string{"/build", "docs/*.md"},
+			match:    []string{"build/x", "docs/a.md"},
+			noMatch:  []string{"src/build/x", "docs/sub/a.md", "src/docs/a.md"},
+		},
+		{
+			patterns: []string{"*.pb.go"},
+			match:    []string{"a.pb.go", "x/y/b.pb.go"},
+			noMatch:  []string{"a.go", "pb.go/a.go.txt"},
+		},
+		{
+			patterns: []string{"**/testdata/**", "a/**/z.txt"},
+			match:    []string{"testdata/x", "p/q/testdata/r/s", "a/z.txt", "a/b/c/z.txt"},
+			noMatch:  []string{"testdata", "b/z.txt"},
+		},
+		{
+			patterns: []string{"f?[0-9].go", "[!x]*.c"},
+			match:    []string{"fa1.go", "a.c"},
+			noMatch:  []string{"f/1.go", "fab.go", "x.c"},
+		},
+		{
+			patterns: []string{"*.go", "!main.go", "internal/", "!internal/keep.go"},
+			match:    []string{"a.go", "cmd/b.go", "internal/keep.go"},
+			noMatch:  []string{"main.go", "cmd/main.go", "README"},
+		},
+		{
+			patterns: []string{`re:_test\.go$`, `!re:^keep/`},
+			match:    []string{"a_test.go", "b/c_test.go"},
+			noMatch:  []string{"keep/a_test.go", "a.go"},
+		},
+		{
+			patterns: []string{"", "# comment", `\#x`, `\!y`},
+			match:    []string{"#x", "d/!y"},
+			noMatch:  []string{"# comment", "x"},
+		},
+	}
+	for _, test := range tests {
+		m, err := NewMatcher(test.patterns)
+		if err != nil {
+			t.Errorf("%q: %s", test.patterns, err)
+			continue
+		}
+		for _, p := range test.match {
+			if !m.Match(p) {
+				t.Errorf("%q: %s didn't match", test.patterns, p)
+			}
+		}
+		for _, p := range test.noMatch {
+			if m.Match(p) {
+				t.Errorf("%q: %s matched", test.patterns, p)
+			}
+		}
+	}
+
+	if _, err := NewMatcher([]string{"re:("}); err == nil {
+		t.Error("got nil error for bad regexp")
+	}
+}
+
+func TestFilterLinguistFiles(t *testing.T) {
+	gitattributes := map[string]string{
+		".gitattributes": "*.pb.go linguist-generated\n" +
+			"third_party/**\tlinguist-vendored\n" + // separated by a tab
+			"# comment\n" +
+			"third_party/ours/**\t -linguist-vendored\n",
+		"gen/.gitattributes": "*.go linguist-generated=true\n" +
+			"\"keep me.go\" -linguist-generated\n",
+	}
+	files := []string{
+		".gitattributes", "a.go", "a.pb.go", "x/b.pb.go",
+		"third_party/c.go", "third_party/ours/d.go",
+		"gen/.gitattributes", "gen/e.go", "gen/keep me.go",
+	}
+	readFile := func(name string) ([]byte, error) {
+		return []byte(gitattributes[name]), nil
+	}
+
+	tests := []struct {
+		opt  *BlameOptions
+		want []string
+	}{
+		{nil, files},
+		{&BlameOptions{SkipGenerated: true}, []string{".gitattributes", "a.go", "third_party/c.go", "third_party/ours/d.go", "gen/.gitattributes", "gen/keep me.go"}},
+		{&BlameOptions{SkipVendored: true}, []string{".gitattributes", "a.go", "a.pb.go", "x/b.pb.go", "third_party/ours/d.go", "gen/.gitattributes", "gen/e.go", "gen/keep me.go"}},
+	}
+	for _, test := range tests {
+		got, err := filterLinguistFiles(files, test.opt, readFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got %q, want %q", test.opt, got, test.want)
+		}
+	}
+}
+
+func TestRepositoryFiles_ignoredGitattributes(t *testing.T) {
+	// A .gitattributes file counts even if an ignore pattern skips it, with
+	// both backends.
+	attrs := "vendor/** linguist-vendored\n"
+	ignore := []string{".gitattributes"}
+	opt := &BlameOptions{SkipVendored: true}
+
+	r := newTestGitRepo(t)
+	r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add", files: map[string]string{
+		".gitattributes": attrs, "a": "a\n", "vendor/v": "v\n",
+	}})
+	hunks, _, err := BlameGitRepositoryContext(context.Background(), r.dir, "HEAD", ignore, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hunks) != 1 || hunks["a"] == nil {
+		t.Errorf("git: got files %v, want [a]", hunks)
+	}
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".hg"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	useHgServer(t, dir, fakeHgServer(t, func(args []string) [][]byte {
+		switch args[0] {
+		case "locate":
+			return [][]byte{hgMessage('o', ".gitattributes\x00a\x00vendor/v\x00"), hgResult(0)}
+		case "cat":
+			if args[len(args)-1] == ".gitattributes" {
+				return [][]byte{hgMessage('o', attrs), hgResult(0)}
+			}
+		}
+		t.Errorf("unexpected hg command %q", args)
+		return [][]byte{hgResult(255)}
+	}))
+	files, err := hgRepositoryFiles(context.Background(), dir, "tip", ignore, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{"a"}) {
+		t.Errorf("hg: got files %q, want [a]", files)
+	}
+}
@@ -0,0 +1,139 @@
+package blame
+
+import (
+	"bytes"
+	"context"
+)
+
+// UpdateGitRepositoryBlame blames all files in the git repository at
+// repoPath at revision v, given the result of blaming revision prevRev
+// (prevHunks and prevCommits, as returned by BlameGitRepository). Only the
+// files that differ between the two revisions, or that were changed by a
+// commit in between, are blamed again; the hunks of the others are
+// carried over. Files that no longer exist are dropped. The result is the
+// same as BlameGitRepository's for v, unless prevRev isn't an ancestor of
+// v and a file's history differs between them even though its contents
+// don't.
+//
+// The previous result must have been made with the same ignorePatterns
+// and options. If the .git-blame-ignore-revs file changed and
+// opt.ReadIgnoreRevsFile is set, every file is blamed again. If prevRev is
+// empty, this is the same as BlameGitRepository.
+func UpdateGitRepositoryBlame(repoPath, prevRev string, prevHunks map[string][]Hunk, prevCommits map[string]Commit, v string, ignorePatterns []string) (map[string][]Hunk, map[string]Commit, error) {
+	return UpdateGitRepositoryBlameContext(context.Background(), repoPath, prevRev, prevHunks, prevCommits, v, ignorePatterns, nil)
+}
+
+// UpdateGitRepositoryBlameContext is like UpdateGitRepositoryBlame, but
+// stops blaming and kills any running git processes when ctx is done. In
+// that case, the returned error is ctx.Err(). If opt is nil, the default
+// options are used.
+func UpdateGitRepositoryBlameContext(ctx context.Context, repoPath, prevRev string, prevHunks map[string][]Hunk, prevCommits map[string]Commit, v string, ignorePatterns []string, opt *BlameOptions) (map[string][]Hunk, map[string]Commit, error) {
+	if prevRev == "" {
+		return BlameGitRepositoryContext(ctx, repoPath, v, ignorePatterns, opt)
+	}
+	changed, err := changedGitFiles(ctx, repoPath, prevRev, v)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opt != nil && opt.ReadIgnoreRevsFile && changed[gitIgnoreRevsFile] {
+		return BlameGitRepositoryContext(ctx, repoPath, v, ignorePatterns, opt)
+	}
+
+	files, err := listGitRepositoryFiles(ctx, repoPath, v)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err = filterLinguistFiles(files, opt, func(name string) ([]byte, error) {
+		return gitFileContents(ctx, repoPath, v, name)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err = selectFiles(files, ignorePatterns)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hunks := make(map[string][]Hunk)
+	commits := make(map[string]Commit)
+	missing := make(map[string]Commit) // commits whose details must be read
+	addCommit := func(c Commit) {
+		if _, present := commits[c.ID]; present {
+			return
+		}
+		if prev, ok := prevCommits[c.ID]; ok {
+			commits[c.ID] = prev
+		} else {
+			missing[c.ID] = c
+		}
+	}
+	var reblame []string
+	for _, f := range files {
+		fileHunks, ok := prevHunks[f]
+		if !ok || changed[f] {
+			reblame = append(reblame, f)
+			continue
+		}
+		hunks[f] = fileHunks
+		for _, h := range fileHunks {
+			addCommit(Commit{ID: h.CommitID})
+		}
+	}
+	logDebug("updating repository blame", "repo", repoPath, "from", prevRev, "to", v, "changed", len(reblame), "total", len(files))
+
+	opt, cleanup, err := prepareGitOptions(ctx, repoPath, v, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanup()
+	newHunks, newCommits, blameErr := blameFiles(ctx, blameGitFile, repoPath, reblame, v, nil, opt)
+	if blameErr != nil && !isPartial(blameErr) {
+		return nil, nil, blameErr
+	}
+	for f, fileHunks := range newHunks {
+		hunks[f] = fileHunks
+	}
+	for _, c := range newCommits {
+		addCommit(c)
+	}
+	if err := addGitCommitDetails(ctx, repoPath, missing); err != nil {
+		return nil, nil, err
+	}
+	for id, c := range missing {
+		commits[id] = c
+	}
+	return hunks, commits, blameErr
+}
+
+// changedGitFiles returns the set of files (relative to repoPath) that
+// differ between revisions from and to, or that were changed by a commit
+// that is reachable from to but not from from. A file that was changed
+// and then changed back must be blamed again, because git blame
+// attributes its lines to the commit that changed them back.
+func changedGitFiles(ctx context.Context, repoPath, from, to string) (map[string]bool, error) {
+	changed := make(map[string]bool)
+	add := func(out []byte) {
+		for _, name := range bytes.Split(out, []byte{0}) {
+			if len(name) > 0 {
+				changed[string(name)] = true
+			}
+		}
+	}
+
+	cmd := command(ctx, repoPath, "git", "diff-tree", "-r", "-z", "--no-renames", "--relative", "--name-only", from, to, "--")
+	out, err := cmd.Output()
+	if err = commandErr(ctx, cmd, err); err != nil {
+		return nil, err
+	}
+	add(out)
+
+	// With -m, merges are listed with the files that differ from any of
+	// their parents.
+	cmd = command(ctx, repoPath, "git", "log", "-m", "-z", "--no-renames", "--relative", "--name-only", "--format=", from+".."+to, "--")
+	out, err = cmd.Output()
+	if err = commandErr(ctx, cmd, err); err != nil {
+		return nil, err
+	}
+	add(out)
+	return changed, nil
+}
@@ -0,0 +1,60 @@
+package blame
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpdateGitRepositoryBlame(t *testing.T) {
+	r := newTestGitRepo(t)
+	a := "A <a@example.com>"
+	prevRev := r.commit(testCommit{author: a, date: "2014-01-01T00:00:00Z", message: "add", files: map[string]string{
+		"same":    "a\nb\n",
+		"changed": "a\nb\n",
+		"deleted": "a\n",
+		"revert":  "a\n",
+		"empty":   "",
+	}})
+	prevHunks, prevCommits, err := BlameGitRepository(r.dir, prevRev, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.commit(testCommit{author: a, date: "2014-01-02T00:00:00Z", message: "change", files: map[string]string{
+		"changed": "a\nc\n",
+		"added":   "x\n",
+		"revert":  "b\n",
+	}, remove: []string{"deleted"}})
+	v := r.commit(testCommit{author: a, date: "2014-01-03T00:00:00Z", message: "revert", files: map[string]string{
+		"revert": "a\n",
+	}})
+
+	wantHunks, wantCommits, err := BlameGitRepository(r.dir, v, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hunks, commits, err := UpdateGitRepositoryBlame(r.dir, prevRev, prevHunks, prevCommits, v, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hunks, wantHunks) {
+		t.Errorf("got hunks %+v, want %+v", hunks, wantHunks)
+	}
+	if !reflect.DeepEqual(commits, wantCommits) {
+		t.Errorf("got commits %+v, want %+v", commits, wantCommits)
+	}
+
+	// The hunks of unchanged files are carried over, and their commits
+	// are read if they're missing from the previous result.
+	prevHunks["same"] = []Hunk{{CommitID: v, LineStart: 0, LineEnd: 2, CharStart: 0, CharEnd: 4}}
+	hunks, commits, err = UpdateGitRepositoryBlame(r.dir, prevRev, prevHunks, prevCommits, v, []string{"changed", "added", "revert", "empty"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hunks, map[string][]Hunk{"same": prevHunks["same"]}) {
+		t.Errorf("got hunks %+v, want only the previous hunks of same", hunks)
+	}
+	if !reflect.DeepEqual(commits, map[string]Commit{v: wantCommits[v]}) {
+		t.Errorf("got commits %+v, want %s", commits, v)
+	}
+}
@@ -0,0 +1,83 @@
+package blame
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// A Logger receives structured log messages: a level, a short message,
+// and alternating keys and values that give details, such as "repo",
+// repoPath. It must be safe for concurrent use.
+type Logger interface {
+	Log(level Level, msg string, keyvals ...interface{})
+}
+
+// A Level is the importance of a log message.
+type Level int
+
+const (
+	// LevelDebug messages report blaming's progress, such as each file
+	// that has been blamed.
+	LevelDebug Level = iota
+
+	// LevelWarn messages report problems that didn't make blaming fail,
+	// such as git or hg writing to stderr, or a cache that can't be
+	// written.
+	LevelWarn
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelWarn:
+		return "warn"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Log, if non-nil, receives the package's log messages. Output of git and
+// hg on stderr is never written to os.Stderr: it is logged (if the
+// command succeeded) or returned in a *CommandError.
+var Log Logger
+
+// NewStdLogger returns a Logger that writes messages to l, one line each,
+// formatted like "warn: msg key=value key2="value 2"".
+func NewStdLogger(l *log.Logger) Logger {
+	return stdLogger{l}
+}
+
+type stdLogger struct{ l *log.Logger }
+
+func (s stdLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteString(": ")
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var v interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			v = keyvals[i+1]
+		}
+		val := fmt.Sprint(v)
+		if val == "" || strings.ContainsAny(val, " \t\r\n\"=") {
+			val = strconv.Quote(val)
+		}
+		fmt.Fprintf(&b, " %v=%s", keyvals[i], val)
+	}
+	s.l.Print(b.String())
+}
+
+func logDebug(msg string, keyvals ...interface{}) {
+	if l := Log; l != nil {
+		l.Log(LevelDebug, msg, keyvals...)
+	}
+}
+
+func logWarn(msg string, keyvals ...interface{}) {
+	if l := Log; l != nil {
+		l.Log(LevelWarn, msg, keyvals...)
+	}
+}
@@ -0,0 +1,81 @@
+package blame
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0))
+	l.Log(LevelWarn, "something failed", "repo", "/a b", "n", 3, "empty", "", "odd")
+	want := `warn: something failed repo="/a b" n=3 empty="" odd=(MISSING)` + "\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+// recordingLogger is a Logger that records the messages it receives.
+type recordingLogger struct {
+	mu   sync.Mutex
+	msgs []recordedLog
+}
+
+type recordedLog struct {
+	level   Level
+	msg     string
+	keyvals []interface{}
+}
+
+func (l *recordingLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, recordedLog{level, msg, keyvals})
+}
+
+// stderr returns the stderr output of the commands that were logged.
+func (l *recordingLogger) stderr() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var stderr []string
+	for _, m := range l.msgs {
+		for i := 0; i+1 < len(m.keyvals); i += 2 {
+			if m.level == LevelWarn && m.keyvals[i] == "stderr" {
+				stderr = append(stderr, m.keyvals[i+1].(string))
+			}
+		}
+	}
+	return stderr
+}
+
+func TestLogStderr(t *testing.T) {
+	l := &recordingLogger{}
+	defer func(old Logger) { Log = old }(Log)
+	Log = l
+
+	r := newTestGitRepo(t)
+	rev := r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add", files: map[string]string{"f": "a\n"}})
+	t.Setenv("GIT_TRACE", "1") // makes git write to stderr
+	if _, _, err := BlameGitFile(r.dir, "f", rev); err != nil {
+		t.Fatal(err)
+	}
+	if stderr := l.stderr(); len(stderr) == 0 || !strings.Contains(stderr[0], "trace") {
+		t.Errorf("got logged stderr %q, want git's trace output", stderr)
+	}
+
+	l.msgs = nil
+	s := fakeHgServer(t, func(args []string) [][]byte {
+		return [][]byte{hgMessage('e', "warning: x\n"), hgMessage('o', "a\n"), hgResult(0)}
+	})
+	if err := s.runCommand(context.Background(), ioutil.Discard, "cat"); err != nil {
+		t.Fatal(err)
+	}
+	if stderr := l.stderr(); len(stderr) != 1 || stderr[0] != "warning: x" {
+		t.Errorf("got logged stderr %q, want hg's warning", stderr)
+	}
+}
@@ -0,0 +1,288 @@
+package blame
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// porcelainParser parses the output of `git blame --porcelain`, reading it
+// incrementally. The output consists of groups of lines that git blamed on
+// the same commit. Each line is introduced by a header line
+//
+//	<commit ID> <original line> <final line> [<lines in group>]
+//
+// (the line count is only present for the first line of a group). The
+// first time a commit appears, its header line is followed by "<key>
+// <value>" lines describing it. Then comes the line's content, prefixed
+// by a tab.
+type porcelainParser struct {
+	r   *bufio.Reader
+	buf []byte // for lines longer than r's buffer
+
+	// commits holds the commits of all hunks returned by next so far.
+	commits map[string]Commit
+
+	charOffset int
+
+	// binary is set if the file's first 8000 bytes (of those that are
+	// read, which are those after charOffset's initial value) contain a
+	// NUL byte. See isBinary.
+	binary bool
+}
+
+func newPorcelainParser(r io.Reader) *porcelainParser {
+	return &porcelainParser{
+		r:       bufio.NewReader(r),
+		commits: make(map[string]Commit),
+	}
+}
+
+// porcelainCommit holds the "<key> <value>" headers that describe a commit.
+type porcelainCommit struct {
+	author, authorMail, authorTZ          string
+	authorTime                            int64
+	committer, committerMail, committerTZ string
+	committerTime                         int64
+	summary                               string
+	boundary                              bool
+	previous                              string // "<commit ID> <filename>"
+	filename                              string
+}
+
+// next returns the next hunk. It returns io.EOF when there are no more
+// hunks.
+func (p *porcelainParser) next() (Hunk, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return Hunk{}, err
+	}
+	commitID, finalLine, nLines, err := parsePorcelainHeader(line, true)
+	if err != nil {
+		return Hunk{}, err
+	}
+
+	hunk := Hunk{
+		CommitID:  commitID,
+		LineStart: finalLine - 1,
+		LineEnd:   finalLine - 1 + nLines,
+		CharStart: p.charOffset,
+	}
+
+	if _, seen := p.commits[commitID]; !seen {
+		c, err := p.readCommit()
+		if err != nil {
+			return Hunk{}, err
+		}
+		p.commits[commitID] = c.toCommit(commitID)
+	} else if err := p.skipHeaders(); err != nil {
+		return Hunk{}, err
+	}
+	// Older versions of git output a group of 0 lines, without content,
+	// for empty files.
+	if nLines > 0 {
+		if err := p.readContent(); err != nil {
+			return Hunk{}, err
+		}
+	}
+
+	// Consume remaining lines in hunk
+	for i := 1; i < nLines; i++ {
+		line, err := p.readLine()
+		if err != nil {
+			return Hunk{}, unexpectedEOF(err)
+		}
+		if _, _, _, err := parsePorcelainHeader(line, false); err != nil {
+			return Hunk{}, err
+		}
+		if err := p.skipHeaders(); err != nil {
+			return Hunk{}, err
+		}
+		if err := p.readContent(); err != nil {
+			return Hunk{}, err
+		}
+	}
+
+	hunk.CharEnd = p.charOffset
+	return hunk, nil
+}
+
+// parsePorcelainHeader parses the header line that introduces each line of
+// blame output. If first is true, the line must be the first of a group
+// (and include the number of lines in the group).
+func parsePorcelainHeader(line []byte, first bool) (commitID string, finalLine, nLines int, err error) {
+	fields := strings.Fields(string(line))
+	if (first && len(fields) != 4) || (!first && len(fields) != 3 && len(fields) != 4) {
+		return "", 0, 0, fmt.Errorf("unexpected git blame porcelain header line: %q", line)
+	}
+	commitID = fields[0]
+	if finalLine, err = strconv.Atoi(fields[2]); err != nil {
+		return "", 0, 0, fmt.Errorf("bad line number in git blame porcelain header line %q", line)
+	}
+	if first {
+		if nLines, err = strconv.Atoi(fields[3]); err != nil {
+			return "", 0, 0, fmt.Errorf("bad line count in git blame porcelain header line %q", line)
+		}
+	}
+	return commitID, finalLine, nLines, nil
+}
+
+// readCommit reads the "<key> <value>" lines that follow a header line,
+// up to but not including the line's content.
+func (p *porcelainParser) readCommit() (*porcelainCommit, error) {
+	var c porcelainCommit
+	for {
+		b, err := p.r.Peek(1)
+		if err == io.EOF {
+			return &c, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b[0] == '\t' {
+			return &c, nil
+		}
+
+		line, err := p.readLine()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		key, value := string(line), ""
+		if i := bytes.IndexByte(line, ' '); i != -1 {
+			key, value = string(line[:i]), string(line[i+1:])
+		}
+		switch key {
+		case "author":
+			c.author = value
+		case "author-mail":
+			c.authorMail = value
+		case "author-time":
+			if c.authorTime, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("Failed to parse author-time %q", line)
+			}
+		case "author-tz":
+			c.authorTZ = value
+		case "committer":
+			c.committer = value
+		case "committer-mail":
+			c.committerMail = value
+		case "committer-time":
+			if c.committerTime, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("Failed to parse committer-time %q", line)
+			}
+		case "committer-tz":
+			c.committerTZ = value
+		case "summary":
+			c.summary = value
+		case "boundary":
+			c.boundary = true
+		case "previous":
+			c.previous = value
+		case "filename":
+			c.filename = value
+		}
+		// Ignore unknown keys, which future versions of git may add.
+	}
+}
+
+// skipHeaders skips any "<key> <value>" lines up to the line's content.
+func (p *porcelainParser) skipHeaders() error {
+	_, err := p.readCommit()
+	return err
+}
+
+// readContent reads the tab-prefixed content of a line and advances the
+// character offset past it. The tab is counted in place of the line's
+// newline.
+func (p *porcelainParser) readContent() error {
+	line, err := p.readLine()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if len(line) == 0 || line[0] != '\t' {
+		return fmt.Errorf("expected tab-prefixed line content in git blame porcelain output, got %q", line)
+	}
+	if content := line[1:]; p.charOffset < 8000 {
+		if n := 8000 - p.charOffset; len(content) > n {
+			content = content[:n]
+		}
+		p.binary = p.binary || isBinary(content)
+	}
+	p.charOffset += len(line)
+	return nil
+}
+
+// readLine reads the next line, without its trailing newline. The returned
+// slice is only valid until the next read.
+func (p *porcelainParser) readLine() ([]byte, error) {
+	line, err := p.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		p.buf = append(p.buf[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = p.r.ReadSlice('\n')
+			p.buf = append(p.buf, line...)
+		}
+		line = p.buf
+	}
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(line, []byte{'\n'}), nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (c *porcelainCommit) toCommit(id string) Commit {
+	return Commit{
+		ID:      id,
+		Summary: c.summary,
+		Author: Author{
+			Name:  c.author,
+			Email: trimAngleBrackets(c.authorMail),
+		},
+		Committer: Author{
+			Name:  c.committer,
+			Email: trimAngleBrackets(c.committerMail),
+		},
+		AuthorDate:    time.Unix(c.authorTime, 0).In(gitTimeZone(c.authorTZ)),
+		CommitterDate: time.Unix(c.committerTime, 0).In(gitTimeZone(c.committerTZ)),
+	}
+}
+
+// gitTimeZone returns the location for a git time zone offset such as
+// "-0700". Malformed offsets are treated as UTC.
+func gitTimeZone(tz string) *time.Location {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return time.FixedZone("", 0)
+	}
+	hours, err1 := strconv.Atoi(tz[1:3])
+	minutes, err2 := strconv.Atoi(tz[3:5])
+	if err1 != nil || err2 != nil {
+		return time.FixedZone("", 0)
+	}
+	offset := hours*60*60 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone("", offset)
+}
+
+// trimAngleBrackets removes the angle brackets around an email address.
+func trimAngleBrackets(email string) string {
+	if len(email) >= 2 && email[0] == '<' && email[len(email)-1] == '>' {
+		return email[1 : len(email)-1]
+	}
+	return email
+}
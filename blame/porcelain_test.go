@@ -0,0 +1,129 @@
+package blame
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+const testPorcelain = `be880bd90f219883c46b19ef089dccad841b6423 1 1 3
+author Beyang Liu
+author-mail <beyang.liu@gmail.com>
+author-time 1381194838
+author-tz -0700
+committer Beyang Liu
+committer-mail <beyang.liu@gmail.com>
+committer-time 1381194838
+committer-tz -0700
+summary initial commit
+boundary
+filename goblametest.txt
+	package main
+be880bd90f219883c46b19ef089dccad841b6423 2 2
+	
+be880bd90f219883c46b19ef089dccad841b6423 3 3
+	import "fmt"
+305c1fb8c7550994f875aaef38e1bd4c11962a6f 4 4 2
+author Ricky Bobby
+author-mail <ricky@bobby.com>
+author-time 1381197615
+committer-tz +0200
+author-tz -0700
+committer Beyang Liu
+committer-mail <beyang.liu@gmail.com>
+committer-time 1381219200
+some-future-header with a value
+summary modify imports
+previous be880bd90f219883c46b19ef089dccad841b6423 old name with spaces.txt
+filename file name with spaces.txt
+	import "os"
+305c1fb8c7550994f875aaef38e1bd4c11962a6f 5 5
+	  foo bar
+be880bd90f219883c46b19ef089dccad841b6423 4 6 1
+filename old name with spaces.txt
+	}
+`
+
+func TestPorcelainParser(t *testing.T) {
+	wantHunks := []Hunk{
+		{CommitID: "be880bd90f219883c46b19ef089dccad841b6423", LineStart: 0, LineEnd: 3, CharStart: 0, CharEnd: 27},
+		{CommitID: "305c1fb8c7550994f875aaef38e1bd4c11962a6f", LineStart: 3, LineEnd: 5, CharStart: 27, CharEnd: 49},
+		{CommitID: "be880bd90f219883c46b19ef089dccad841b6423", LineStart: 5, LineEnd: 6, CharStart: 49, CharEnd: 51},
+	}
+	wantCommits := map[string]Commit{
+		"be880bd90f219883c46b19ef089dccad841b6423": {
+			ID:            "be880bd90f219883c46b19ef089dccad841b6423",
+			Summary:       "initial commit",
+			Author:        Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+			Committer:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+			AuthorDate:    mustParseTime("Mon Oct 7 18:13:58 2013 -0700"),
+			CommitterDate: mustParseTime("Mon Oct 7 18:13:58 2013 -0700"),
+		},
+		"305c1fb8c7550994f875aaef38e1bd4c11962a6f": {
+			ID:            "305c1fb8c7550994f875aaef38e1bd4c11962a6f",
+			Summary:       "modify imports",
+			Author:        Author{Name: "Ricky Bobby", Email: "ricky@bobby.com"},
+			Committer:     Author{Name: "Beyang Liu", Email: "beyang.liu@gmail.com"},
+			AuthorDate:    mustParseTime("Mon Oct 7 19:00:15 2013 -0700"),
+			CommitterDate: mustParseTime("Tue Oct 8 10:00:00 2013 +0200"),
+		},
+	}
+
+	// Read one byte at a time to exercise incremental parsing.
+	p := newPorcelainParser(iotest.OneByteReader(strings.NewReader(testPorcelain)))
+	var hunks []Hunk
+	for {
+		hunk, err := p.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		hunks = append(hunks, hunk)
+	}
+	if !reflect.DeepEqual(hunks, wantHunks) {
+		t.Errorf("got hunks %+v, want %+v", hunks, wantHunks)
+	}
+	if !reflect.DeepEqual(p.commits, wantCommits) {
+		t.Errorf("got commits %+v, want %+v", p.commits, wantCommits)
+	}
+}
+
+func TestPorcelainParser_Truncated(t *testing.T) {
+	truncated := testPorcelain[:strings.Index(testPorcelain, "305c1fb8c7550994f875aaef38e1bd4c11962a6f 5 5")]
+	p := newPorcelainParser(strings.NewReader(truncated))
+	for {
+		_, err := p.next()
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func TestPorcelainParser_BadHeader(t *testing.T) {
+	p := newPorcelainParser(strings.NewReader("not a header\n"))
+	if _, err := p.next(); err == nil || err == io.EOF {
+		t.Errorf("got error %v, want a parse error", err)
+	}
+}
+
+func TestPorcelainParser_LongLine(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+	p := newPorcelainParser(strings.NewReader("be880bd90f219883c46b19ef089dccad841b6423 1 1 1\nsummary " + long + "\n\t" + long + "\n"))
+	hunk, err := p.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Hunk{CommitID: "be880bd90f219883c46b19ef089dccad841b6423", LineStart: 0, LineEnd: 1, CharStart: 0, CharEnd: 10001}); hunk != want {
+		t.Errorf("got hunk %+v, want %+v", hunk, want)
+	}
+	if msg := p.commits[hunk.CommitID].Summary; msg != long {
+		t.Errorf("got message of length %d, want %d", len(msg), len(long))
+	}
+}
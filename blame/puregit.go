@@ -0,0 +1,517 @@
+package blame
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+func init() {
+	// Registered after git, which detects the same repositories, so that
+	// DetectBackend never picks it.
+	RegisterBackend("puregit", pureGitBackend{})
+}
+
+// pureGitBackend blames git repositories without running git, by reading
+// their objects directly (see gitRepo) and diffing file versions with a
+// port of git's diff algorithm, so that its results are the same as the
+// git backend's. Use LookupBackend("puregit") to get it.
+//
+// It honors NoIgnoreWhitespace, SkipGenerated and SkipVendored. It doesn't
+// detect moved or copied lines or ignore commits, and returns an error if
+// opt asks it to (see checkPureGitOptions). Renames are followed using
+// git's rename detection (see findRename).
+type pureGitBackend struct{}
+
+func (pureGitBackend) Detect(repoPath string) bool {
+	return gitBackend{}.Detect(repoPath)
+}
+
+func (pureGitBackend) ListFiles(ctx context.Context, repoPath, v string) ([]string, error) {
+	repo, err := openGitRepo(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer repo.close()
+	commitID, err := repo.resolveRevision(v)
+	if err != nil {
+		return nil, err
+	}
+	return repo.listFiles(commitID)
+}
+
+func (b pureGitBackend) BlameFile(ctx context.Context, repoPath, filePath, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	return b.blameFileRange(ctx, repoPath, filePath, v, nil, opt)
+}
+
+func (b pureGitBackend) BlameFileRange(ctx context.Context, repoPath, filePath, v string, startLine, endLine int, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	if err := checkLineRange(startLine, endLine); err != nil {
+		return nil, nil, err
+	}
+	return b.blameFileRange(ctx, repoPath, filePath, v, &Range{Start: startLine, End: endLine}, opt)
+}
+
+func (pureGitBackend) blameFileRange(ctx context.Context, repoPath, filePath, v string, r *Range, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	if err := checkPureGitOptions(opt); err != nil {
+		return nil, nil, err
+	}
+	repo, err := openGitRepo(repoPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer repo.close()
+	commitID, err := repo.resolveRevision(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	name, err := relSlashPath(repoPath, filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return blamePureGitFile(ctx, repo, commitID, name, r, opt)
+}
+
+func (pureGitBackend) BlameRepository(ctx context.Context, repoPath, v string, ignorePatterns []string, opt *BlameOptions) (map[string][]Hunk, map[string]Commit, error) {
+	repo, files, blameFile, err := openPureGitRepository(repoPath, v, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer repo.close()
+	return blameFiles(ctx, blameFile, repoPath, files, v, ignorePatterns, opt)
+}
+
+func (pureGitBackend) StreamRepository(ctx context.Context, repoPath, v string, ignorePatterns []string, opt *BlameOptions, fn func(FileBlame) error) error {
+	repo, files, blameFile, err := openPureGitRepository(repoPath, v, opt)
+	if err != nil {
+		return err
+	}
+	defer repo.close()
+	return streamFiles(ctx, blameFile, repoPath, files, v, ignorePatterns, opt, nil, fn)
+}
+
+// openPureGitRepository opens a repository to blame it at revision v. It
+// returns the files to blame (without those that opt skips) and a
+// function that blames one of them. The repository must be closed when
+// blaming is done.
+func openPureGitRepository(repoPath, v string, opt *BlameOptions) (_ *gitRepo, files []string, blameFile blameFileFunc, err error) {
+	if err := checkPureGitOptions(opt); err != nil {
+		return nil, nil, nil, err
+	}
+	repo, err := openGitRepo(repoPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			repo.close()
+		}
+	}()
+	commitID, err := repo.resolveRevision(v)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	files, err = repo.listFiles(commitID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	files, err = filterLinguistFiles(files, opt, func(name string) ([]byte, error) {
+		return repo.fileContents(commitID, name)
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	blameFile = func(ctx context.Context, repoPath, filePath, v string, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+		return blamePureGitFile(ctx, repo, commitID, filePath, nil, opt)
+	}
+	return repo, files, blameFile, nil
+}
+
+// checkPureGitOptions returns an error if opt asks for git blame features
+// that pureGitBackend doesn't implement, rather than silently giving
+// different results than the git backend.
+func checkPureGitOptions(opt *BlameOptions) error {
+	if opt == nil {
+		return nil
+	}
+	var unsupported []string
+	if opt.DetectMoves {
+		unsupported = append(unsupported, "DetectMoves")
+	}
+	if opt.DetectCopies > 0 {
+		unsupported = append(unsupported, "DetectCopies")
+	}
+	if len(opt.IgnoreRevs) > 0 || opt.IgnoreRevsFile != "" || opt.ReadIgnoreRevsFile {
+		unsupported = append(unsupported, "IgnoreRevs")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("the puregit backend doesn't support %s", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// listFiles returns the paths of the files (relative to the repository
+// path that was opened) in a commit, like git ls-tree -r.
+func (r *gitRepo) listFiles(commitID oid) ([]string, error) {
+	c, err := r.commit(commitID)
+	if err != nil {
+		return nil, err
+	}
+	tree := c.tree
+	if r.prefix != "" {
+		e, ok, err := r.treeEntry(c.tree, r.prefix)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || !e.isTree() {
+			return nil, nil
+		}
+		tree = e.id
+	}
+	var files []string
+	err = r.walkTree(tree, "", func(p string, e gitTreeEntry) error {
+		// Submodules can't be blamed.
+		if !e.isSubmodule() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// fileEntry returns the tree entry of a file (relative to the repository
+// path that was opened) in a commit.
+func (r *gitRepo) fileEntry(commitID oid, name string) (gitTreeEntry, error) {
+	c, err := r.commit(commitID)
+	if err != nil {
+		return gitTreeEntry{}, err
+	}
+	e, ok, err := r.treeEntry(c.tree, path.Join(r.prefix, name))
+	if err != nil {
+		return gitTreeEntry{}, err
+	}
+	if !ok || e.isTree() || e.isSubmodule() {
+		return gitTreeEntry{}, fileError(ErrFileNotFound, name, commitID.String())
+	}
+	return e, nil
+}
+
+// fileContents returns the contents of a file (relative to the repository
+// path that was opened) in a commit.
+func (r *gitRepo) fileContents(commitID oid, name string) ([]byte, error) {
+	e, err := r.fileEntry(commitID, name)
+	if err != nil {
+		return nil, err
+	}
+	return r.readObjectType(e.id, objBlob)
+}
+
+// blamePureGitFile blames a file (relative to the repository path that was
+// opened) in a commit. If r is non-nil, only the lines that it selects are
+// blamed.
+func blamePureGitFile(ctx context.Context, repo *gitRepo, commitID oid, name string, r *Range, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	e, err := repo.fileEntry(commitID, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	b := &pureGitBlame{
+		ctx:              ctx,
+		repo:             repo,
+		ignoreWhitespace: opt == nil || !opt.NoIgnoreWhitespace,
+		contents:         make(map[oid][]byte),
+		files:            make(map[blameOrigin]gitTreeEntry),
+		pending:          make(map[blameOrigin][]blameLine),
+	}
+	data, err := b.content(e.id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if isBinary(data) {
+		return nil, nil, fileError(ErrBinaryFile, name, commitID.String())
+	}
+	lines := splitLines(data)
+	if len(lines) == 0 {
+		// Like git blame, which outputs nothing for empty files.
+		return nil, nil, nil
+	}
+	if r != nil && r.Start >= len(lines) {
+		// Like the git backend: there is nothing to blame.
+		return nil, nil, nil
+	}
+
+	// Blame the lines that were asked for.
+	start, end := 0, len(lines)
+	if r != nil {
+		start = r.Start
+		if r.End < end {
+			end = r.End
+		}
+	}
+	b.blamed = make([]blamedLine, len(lines))
+	blameLines := make([]blameLine, 0, end-start)
+	for i := start; i < end; i++ {
+		blameLines = append(blameLines, blameLine{final: i, orig: i})
+	}
+	if err := b.add(blameOrigin{commitID, path.Join(repo.prefix, name)}, e, blameLines); err != nil {
+		return nil, nil, err
+	}
+	if err := b.run(); err != nil {
+		return nil, nil, err
+	}
+
+	// Group the lines into hunks. Like git blame, consecutive lines are in
+	// the same hunk if they were consecutive in the commit they're blamed
+	// on.
+	hunks := make([]Hunk, 0)
+	commits := make(map[string]Commit)
+	charOffset := 0
+	for i, line := range lines {
+		n := len(line)
+		if line[n-1] != '\n' {
+			n++ // counted as if it had a newline, as in git blame output
+		}
+		if i < start || i >= end {
+			charOffset += n
+			continue
+		}
+		bl := b.blamed[i]
+		if i > start && bl.origin == b.blamed[i-1].origin && bl.orig == b.blamed[i-1].orig+1 {
+			hunks[len(hunks)-1].LineEnd++
+			hunks[len(hunks)-1].CharEnd += n
+		} else {
+			hunks = append(hunks, Hunk{
+				CommitID:  bl.origin.commit.String(),
+				LineStart: i,
+				LineEnd:   i + 1,
+				CharStart: charOffset,
+				CharEnd:   charOffset + n,
+			})
+		}
+		charOffset += n
+
+		id := bl.origin.commit.String()
+		if _, ok := commits[id]; !ok {
+			c, err := repo.commit(bl.origin.commit)
+			if err != nil {
+				return nil, nil, err
+			}
+			commits[id] = c.Commit
+		}
+	}
+	return hunks, commits, nil
+}
+
+// A blameOrigin is a version of a file: its path in a commit.
+type blameOrigin struct {
+	commit oid
+	path   string
+}
+
+// A blameLine is a line of the blamed file: its number in the blamed
+// version (final), and in an origin (orig).
+type blameLine struct{ final, orig int }
+
+// A blamedLine is the origin that a line of the blamed file is blamed on.
+type blamedLine struct {
+	origin blameOrigin
+	orig   int
+}
+
+// pureGitBlame blames the lines of a file the way git blame does: each
+// line is passed from the commit that it's blamed on (initially, the
+// blamed one) to the parents that have it unchanged, starting with the
+// most recent commits, until it reaches the commit that added it.
+type pureGitBlame struct {
+	ctx              context.Context
+	repo             *gitRepo
+	ignoreWhitespace bool
+
+	contents map[oid][]byte
+	files    map[blameOrigin]gitTreeEntry // the tree entry of each origin's file
+
+	// pending holds the lines that have been passed to an origin but not
+	// yet to its parents; queue holds the origins with pending lines.
+	pending map[blameOrigin][]blameLine
+	queue   originQueue
+	seq     int
+
+	blamed []blamedLine // by final line number
+}
+
+func (b *pureGitBlame) content(blob oid) ([]byte, error) {
+	if data, ok := b.contents[blob]; ok {
+		return data, nil
+	}
+	data, err := b.repo.readObjectType(blob, objBlob)
+	if err != nil {
+		return nil, err
+	}
+	b.contents[blob] = data
+	return data, nil
+}
+
+// add passes lines to an origin, whose file has the given tree entry.
+func (b *pureGitBlame) add(o blameOrigin, file gitTreeEntry, lines []blameLine) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	b.files[o] = file
+	if len(b.pending[o]) == 0 {
+		c, err := b.repo.commit(o.commit)
+		if err != nil {
+			return err
+		}
+		b.seq++
+		heap.Push(&b.queue, originQueueItem{o, c.CommitterDate.Unix(), b.seq})
+	}
+	b.pending[o] = append(b.pending[o], lines...)
+	return nil
+}
+
+func (b *pureGitBlame) run() error {
+	for b.queue.Len() > 0 {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+		o := heap.Pop(&b.queue).(originQueueItem).origin
+		lines := b.pending[o]
+		delete(b.pending, o)
+		if err := b.pass(o, lines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parentOrigin is the version of a file in a parent commit.
+type parentOrigin struct {
+	blameOrigin
+	file gitTreeEntry
+}
+
+// pass passes the lines of an origin that are unchanged in its commit's
+// parents to them, and blames the rest on the origin (git's pass_blame).
+func (b *pureGitBlame) pass(o blameOrigin, lines []blameLine) error {
+	c, err := b.repo.commit(o.commit)
+	if err != nil {
+		return err
+	}
+	file := b.files[o]
+
+	// Find the file in each parent, first by its path, and then as a
+	// renamed file. If it's unchanged in a parent, the whole file is
+	// passed to it.
+	parents := make([]*parentOrigin, len(c.parent))
+	for pass := 0; pass < 2; pass++ {
+		for i, parentID := range c.parent {
+			if parents[i] != nil {
+				continue
+			}
+			parent, err := b.repo.commit(parentID)
+			if errors.Is(err, errObjectNotFound) {
+				continue // e.g., in a shallow clone
+			}
+			if err != nil {
+				return err
+			}
+			var po *parentOrigin
+			if pass == 0 {
+				po, err = b.findOrigin(parentID, parent, o.path, file)
+			} else {
+				po, err = b.findRename(parentID, parent, c, o.path, file)
+			}
+			if err != nil {
+				return err
+			}
+			if po == nil {
+				continue
+			}
+			if po.file.id == file.id {
+				return b.add(po.blameOrigin, po.file, lines)
+			}
+			same := false
+			for _, other := range parents[:i] {
+				if other != nil && other.file.id == po.file.id {
+					same = true
+				}
+			}
+			if !same {
+				parents[i] = po
+			}
+		}
+	}
+
+	data, err := b.content(file.id)
+	if err != nil {
+		return err
+	}
+	for _, po := range parents {
+		if po == nil {
+			continue
+		}
+		parentData, err := b.content(po.file.id)
+		if err != nil {
+			return err
+		}
+		match := diffLines(parentData, data, b.ignoreWhitespace)
+		var passed, kept []blameLine
+		for _, l := range lines {
+			if m := match[l.orig]; m != -1 {
+				passed = append(passed, blameLine{final: l.final, orig: m})
+			} else {
+				kept = append(kept, l)
+			}
+		}
+		if err := b.add(po.blameOrigin, po.file, passed); err != nil {
+			return err
+		}
+		if lines = kept; len(lines) == 0 {
+			return nil
+		}
+	}
+
+	for _, l := range lines {
+		b.blamed[l.final] = blamedLine{origin: o, orig: l.orig}
+	}
+	return nil
+}
+
+// findOrigin returns the file at p in a parent commit, or nil if it
+// doesn't exist there or isn't the same type of file (e.g., a symlink
+// instead of a regular file).
+func (b *pureGitBlame) findOrigin(parentID oid, parent *gitCommit, p string, file gitTreeEntry) (*parentOrigin, error) {
+	e, ok, err := b.repo.treeEntry(parent.tree, p)
+	if err != nil || !ok || e.isTree() || e.isSubmodule() || e.isSymlink() != file.isSymlink() {
+		return nil, err
+	}
+	return &parentOrigin{blameOrigin{parentID, p}, e}, nil
+}
+
+// originQueue is a priority queue of origins, with the most recently
+// committed first. Origins of commits with the same date are ordered by
+// when they were added.
+type originQueue []originQueueItem
+
+type originQueueItem struct {
+	origin blameOrigin
+	date   int64
+	seq    int
+}
+
+func (q originQueue) Len() int { return len(q) }
+func (q originQueue) Less(i, j int) bool {
+	if q[i].date != q[j].date {
+		return q[i].date > q[j].date
+	}
+	return q[i].seq < q[j].seq
+}
+func (q originQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *originQueue) Push(x interface{}) { *q = append(*q, x.(originQueueItem)) }
+func (q *originQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,205 @@
+package blame
+
+import (
+	"bytes"
+	"path"
+	"strings"
+)
+
+// When a file doesn't exist in a parent commit, git blame looks for the
+// file that it was renamed from, using git diff's rename detection
+// (diffcore-rename.c). The functions in this file do the same for a single
+// renamed file: an identical deleted file is preferred, then a deleted
+// file with the same name that is at least 75% similar, then the most
+// similar deleted file that is at least 50% similar.
+
+const (
+	renameMaxScore          = 60000
+	renameMinScore          = renameMaxScore / 2 // git's default, 50%
+	renameMinBasenameScore  = renameMinScore + (renameMaxScore-renameMinScore)/2
+	renameHashBase          = 107927
+	renameBinaryCheckLength = 8000
+)
+
+// findRename returns the file in a parent commit that c renamed to the
+// file at p, or nil if there isn't one.
+func (b *pureGitBlame) findRename(parentID oid, parent, c *gitCommit, p string, file gitTreeEntry) (*parentOrigin, error) {
+	// Only files that were added can have been renamed.
+	if e, ok, err := b.repo.treeEntry(parent.tree, p); err != nil || (ok && !e.isTree()) {
+		return nil, err
+	}
+
+	var sources []*parentOrigin
+	err := b.repo.deletedFiles(parent.tree, c.tree, "", func(p string, e gitTreeEntry) error {
+		if !e.isSubmodule() {
+			sources = append(sources, &parentOrigin{blameOrigin{parentID, p}, e})
+		}
+		return nil
+	})
+	if err != nil || len(sources) == 0 {
+		return nil, err
+	}
+	base := path.Base(p)
+	sameBase := func(s *parentOrigin) bool { return path.Base(s.path) == base }
+
+	// Exact renames.
+	var exact *parentOrigin
+	for _, s := range sources {
+		if s.file.id != file.id || ((!s.file.isRegular() || !file.isRegular()) && s.file.mode != file.mode) {
+			continue
+		}
+		if exact == nil || (!sameBase(exact) && sameBase(s)) {
+			exact = s
+		}
+	}
+	if exact != nil || !file.isRegular() {
+		return exact, nil
+	}
+
+	dst, err := b.content(file.id)
+	if err != nil {
+		return nil, err
+	}
+	score := func(s *parentOrigin, minScore int) (int, error) {
+		if !s.file.isRegular() {
+			return 0, nil
+		}
+		src, err := b.repo.readObjectType(s.file.id, objBlob)
+		if err != nil {
+			return 0, err
+		}
+		return renameScore(src, dst, minScore), nil
+	}
+
+	// A file with the same name, if it's the only deleted one.
+	var sameName []*parentOrigin
+	for _, s := range sources {
+		if sameBase(s) {
+			sameName = append(sameName, s)
+		}
+	}
+	if len(sameName) == 1 {
+		n, err := score(sameName[0], renameMinBasenameScore)
+		if err != nil {
+			return nil, err
+		}
+		if n >= renameMinBasenameScore {
+			return sameName[0], nil
+		}
+	}
+
+	// The most similar file, preferring ones with the same name.
+	var best *parentOrigin
+	bestScore := -1
+	for _, s := range sources {
+		n, err := score(s, renameMinScore)
+		if err != nil {
+			return nil, err
+		}
+		if n > bestScore || (n == bestScore && sameBase(s) && !sameBase(best)) {
+			best, bestScore = s, n
+		}
+	}
+	if bestScore < renameMinScore {
+		return nil, nil
+	}
+	return best, nil
+}
+
+// deletedFiles calls fn with the path and entry of each file that is in
+// tree from, but not in tree to, in the order that git diff-tree lists
+// them.
+func (r *gitRepo) deletedFiles(from, to oid, dir string, fn func(p string, e gitTreeEntry) error) error {
+	fromEntries, err := r.tree(from)
+	if err != nil {
+		return err
+	}
+	toEntries, err := r.tree(to)
+	if err != nil {
+		return err
+	}
+	toByName := make(map[string]gitTreeEntry, len(toEntries))
+	for _, e := range toEntries {
+		toByName[e.name] = e
+	}
+	for _, e := range fromEntries {
+		p := path.Join(dir, e.name)
+		t, ok := toByName[e.name]
+		switch {
+		case ok && t.id == e.id && t.mode == e.mode:
+			// Unchanged.
+		case e.isTree() && ok && t.isTree():
+			err = r.deletedFiles(e.id, t.id, p, fn)
+		case e.isTree():
+			err = r.walkTree(e.id, p, fn)
+		case !ok || t.isTree():
+			err = fn(p, e)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e gitTreeEntry) isRegular() bool { return strings.HasPrefix(e.mode, "100") }
+
+// renameScore returns how similar dst is to src, from 0 to
+// renameMaxScore, as git's estimate_similarity does. If the files' sizes
+// are too different for the score to be at least minScore, it returns 0.
+func renameScore(src, dst []byte, minScore int) int {
+	maxSize, baseSize := len(src), len(dst)
+	if baseSize > maxSize {
+		maxSize, baseSize = baseSize, maxSize
+	}
+	if int64(maxSize)*int64(renameMaxScore-minScore) < int64(maxSize-baseSize)*renameMaxScore {
+		return 0
+	}
+	if len(dst) == 0 {
+		return 0
+	}
+	srcSpans, dstSpans := spanHashes(src), spanHashes(dst)
+	copied := 0
+	for h, n := range srcSpans {
+		if m := dstSpans[h]; m < n {
+			copied += m
+		} else {
+			copied += n
+		}
+	}
+	return int(int64(copied) * renameMaxScore / int64(maxSize))
+}
+
+// spanHashes splits data into lines (or 64-byte pieces of long lines) and
+// returns the number of bytes in the spans with each hash, as git's
+// diffcore-delta.c does.
+func spanHashes(data []byte) map[uint32]int {
+	check := data
+	if len(check) > renameBinaryCheckLength {
+		check = check[:renameBinaryCheckLength]
+	}
+	isText := bytes.IndexByte(check, 0) == -1
+
+	spans := make(map[uint32]int)
+	var accum1, accum2 uint32
+	n := 0
+	for i, c := range data {
+		// CRs of CRLFs in text files are ignored.
+		if isText && c == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			continue
+		}
+		old1 := accum1
+		accum1 = (accum1 << 7) ^ (accum2 >> 25)
+		accum2 = (accum2 << 7) ^ (old1 >> 25)
+		accum1 += uint32(c)
+		if n++; n < 64 && c != '\n' {
+			continue
+		}
+		spans[(accum1+accum2*0x61)%renameHashBase] += n
+		n, accum1, accum2 = 0, 0, 0
+	}
+	if n > 0 {
+		spans[(accum1+accum2*0x61)%renameHashBase] += n
+	}
+	return spans
+}
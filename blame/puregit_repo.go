@@ -0,0 +1,827 @@
+package blame
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// This file implements just enough of git to blame files without running
+// git: reading refs, and loose and packed objects, from a repository's
+// .git directory. Only SHA-1 repositories are supported.
+
+// An oid is a git object ID.
+type oid [20]byte
+
+func (id oid) String() string { return hex.EncodeToString(id[:]) }
+
+func parseOID(s string) (oid, error) {
+	var id oid
+	if len(s) != 40 {
+		return id, fmt.Errorf("bad git object ID %q", s)
+	}
+	if _, err := hex.Decode(id[:], []byte(s)); err != nil {
+		return id, fmt.Errorf("bad git object ID %q", s)
+	}
+	return id, nil
+}
+
+// Object types, as numbered in packfiles.
+const (
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+var objTypeNames = map[string]int{"commit": objCommit, "tree": objTree, "blob": objBlob, "tag": objTag}
+
+// errObjectNotFound is returned when an object isn't in the repository.
+var errObjectNotFound = errors.New("git object not found")
+
+// gitRepo reads a git repository's files directly.
+type gitRepo struct {
+	gitDir    string // the .git directory (of the work tree, for linked work trees)
+	commonDir string // the directory that holds objects and refs
+	prefix    string // the path of repoPath in the work tree ("" at the root)
+
+	objectDirs []string
+	packs      []*gitPack
+
+	mu      sync.Mutex
+	trees   map[oid][]gitTreeEntry
+	commits map[oid]*gitCommit
+}
+
+type gitTreeEntry struct {
+	name string
+	mode string
+	id   oid
+}
+
+func (e gitTreeEntry) isTree() bool      { return e.mode == "40000" }
+func (e gitTreeEntry) isSubmodule() bool { return e.mode == "160000" }
+func (e gitTreeEntry) isSymlink() bool   { return e.mode == "120000" }
+
+// gitCommit is a parsed commit object.
+type gitCommit struct {
+	tree   oid
+	parent []oid
+	Commit
+}
+
+// openGitRepo opens the repository that contains repoPath, which may be
+// a subdirectory of a work tree.
+func openGitRepo(repoPath string) (*gitRepo, error) {
+	if !isDir(repoPath) {
+		return nil, fmt.Errorf("%w: %s", ErrNotRepository, repoPath)
+	}
+	absRepoPath, err := filepath.Abs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	r := &gitRepo{trees: make(map[oid][]gitTreeEntry), commits: make(map[oid]*gitCommit)}
+	for dir := absRepoPath; ; dir = filepath.Dir(dir) {
+		if r.gitDir, err = findGitDir(dir); err != nil {
+			return nil, err
+		}
+		if r.gitDir != "" {
+			if rel, _ := filepath.Rel(dir, absRepoPath); rel != "." {
+				r.prefix = filepath.ToSlash(rel)
+			}
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			return nil, fmt.Errorf("%w: %s", ErrNotRepository, repoPath)
+		}
+	}
+
+	r.commonDir = r.gitDir
+	if data, err := ioutil.ReadFile(filepath.Join(r.gitDir, "commondir")); err == nil {
+		r.commonDir = resolvePath(r.gitDir, strings.TrimSpace(string(data)))
+	}
+	if err := r.checkFormat(); err != nil {
+		return nil, err
+	}
+	if err := r.addObjectDir(filepath.Join(r.commonDir, "objects"), 0); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// findGitDir returns the git directory of dir, if dir is the top of a
+// work tree or a bare repository, and "" otherwise.
+func findGitDir(dir string) (string, error) {
+	dotGit := filepath.Join(dir, ".git")
+	fi, err := os.Stat(dotGit)
+	switch {
+	case err == nil && fi.IsDir():
+		return dotGit, nil
+	case err == nil:
+		// A "gitdir: <path>" file, as in linked work trees and
+		// submodules.
+		data, err := ioutil.ReadFile(dotGit)
+		if err != nil {
+			return "", err
+		}
+		line := strings.TrimSpace(string(data))
+		if !strings.HasPrefix(line, "gitdir: ") {
+			return "", fmt.Errorf("bad .git file %s", dotGit)
+		}
+		return resolvePath(dir, strings.TrimPrefix(line, "gitdir: ")), nil
+	}
+	if isDir(filepath.Join(dir, "objects")) && isDir(filepath.Join(dir, "refs")) {
+		return dir, nil
+	}
+	return "", nil
+}
+
+func resolvePath(dir, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(dir, p)
+}
+
+// checkFormat returns an error if the repository uses an object format
+// other than SHA-1.
+func (r *gitRepo) checkFormat() error {
+	data, err := ioutil.ReadFile(filepath.Join(r.commonDir, "config"))
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.ToLower(strings.Join(strings.Fields(line), ""))
+		if strings.HasPrefix(line, "objectformat=") && line != "objectformat=sha1" {
+			return fmt.Errorf("unsupported git object format %q", line[len("objectformat="):])
+		}
+	}
+	return nil
+}
+
+// addObjectDir adds an object directory, its packs and its alternates.
+func (r *gitRepo) addObjectDir(dir string, depth int) error {
+	if depth > 5 {
+		return fmt.Errorf("too many nested git alternates at %s", dir)
+	}
+	r.objectDirs = append(r.objectDirs, dir)
+
+	idxFiles, err := filepath.Glob(filepath.Join(dir, "pack", "*.idx"))
+	if err != nil {
+		return err
+	}
+	for _, idxFile := range idxFiles {
+		p, err := openGitPack(strings.TrimSuffix(idxFile, ".idx"))
+		if err != nil {
+			return err
+		}
+		r.packs = append(r.packs, p)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "info", "alternates"))
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			if err := r.addObjectDir(resolvePath(dir, line), depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// close closes the repository's packfiles.
+func (r *gitRepo) close() {
+	for _, p := range r.packs {
+		p.close()
+	}
+}
+
+// readObject returns the type and contents of an object.
+func (r *gitRepo) readObject(id oid) (typ int, data []byte, err error) {
+	for _, p := range r.packs {
+		if offset, ok := p.find(id); ok {
+			return p.readAt(offset, r)
+		}
+	}
+	hexID := id.String()
+	for _, dir := range r.objectDirs {
+		f, err := os.Open(filepath.Join(dir, hexID[:2], hexID[2:]))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		defer f.Close()
+		return readLooseObject(f)
+	}
+	return 0, nil, fmt.Errorf("%w: %s", errObjectNotFound, hexID)
+}
+
+// readObjectType is like readObject, but returns an error if the object
+// doesn't have type want.
+func (r *gitRepo) readObjectType(id oid, want int) ([]byte, error) {
+	typ, data, err := r.readObject(id)
+	if err != nil {
+		return nil, err
+	}
+	if typ != want {
+		return nil, fmt.Errorf("git object %s has type %d, want %d", id, typ, want)
+	}
+	return data, nil
+}
+
+func readLooseObject(f io.Reader) (typ int, data []byte, err error) {
+	zr, err := zlib.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+	br := bufio.NewReader(zr)
+	header, err := br.ReadString(0)
+	if err != nil {
+		return 0, nil, fmt.Errorf("bad loose git object header: %s", err)
+	}
+	fields := strings.Fields(strings.TrimSuffix(header, "\x00"))
+	if len(fields) != 2 {
+		return 0, nil, fmt.Errorf("bad loose git object header %q", header)
+	}
+	typ, ok := objTypeNames[fields[0]]
+	size, err := strconv.Atoi(fields[1])
+	if !ok || err != nil {
+		return 0, nil, fmt.Errorf("bad loose git object header %q", header)
+	}
+	data = make([]byte, size)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return 0, nil, err
+	}
+	return typ, data, nil
+}
+
+// tree returns the entries of a tree.
+func (r *gitRepo) tree(id oid) ([]gitTreeEntry, error) {
+	r.mu.Lock()
+	entries, ok := r.trees[id]
+	r.mu.Unlock()
+	if ok {
+		return entries, nil
+	}
+
+	data, err := r.readObjectType(id, objTree)
+	if err != nil {
+		return nil, err
+	}
+	// Each entry is "<mode> <name>\0<20-byte ID>".
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp == -1 || nul < sp || len(data) < nul+21 {
+			return nil, fmt.Errorf("bad git tree %s", id)
+		}
+		var e gitTreeEntry
+		e.mode, e.name = string(data[:sp]), string(data[sp+1:nul])
+		copy(e.id[:], data[nul+1:nul+21])
+		entries = append(entries, e)
+		data = data[nul+21:]
+	}
+
+	r.mu.Lock()
+	r.trees[id] = entries
+	r.mu.Unlock()
+	return entries, nil
+}
+
+// treeEntry returns the entry at a slash-separated path in a tree, or
+// false if there is none.
+func (r *gitRepo) treeEntry(tree oid, p string) (gitTreeEntry, bool, error) {
+	e := gitTreeEntry{mode: "40000", id: tree}
+	for _, name := range strings.Split(p, "/") {
+		if !e.isTree() {
+			return gitTreeEntry{}, false, nil
+		}
+		entries, err := r.tree(e.id)
+		if err != nil {
+			return gitTreeEntry{}, false, err
+		}
+		found := false
+		for _, child := range entries {
+			if child.name == name {
+				e, found = child, true
+				break
+			}
+		}
+		if !found {
+			return gitTreeEntry{}, false, nil
+		}
+	}
+	return e, true, nil
+}
+
+// walkTree calls fn with the path (below dir) and entry of each file in a
+// tree and its subtrees, in the order that git ls-tree -r lists them.
+func (r *gitRepo) walkTree(tree oid, dir string, fn func(p string, e gitTreeEntry) error) error {
+	entries, err := r.tree(tree)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		p := path.Join(dir, e.name)
+		if e.isTree() {
+			err = r.walkTree(e.id, p, fn)
+		} else {
+			err = fn(p, e)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit returns a parsed commit.
+func (r *gitRepo) commit(id oid) (*gitCommit, error) {
+	r.mu.Lock()
+	c, ok := r.commits[id]
+	r.mu.Unlock()
+	if ok {
+		return c, nil
+	}
+
+	data, err := r.readObjectType(id, objCommit)
+	if err != nil {
+		return nil, err
+	}
+	c = new(gitCommit)
+	if c.Commit, err = parseGitCommit(id.String(), data); err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte("tree ")) || len(data) < 45 {
+		return nil, fmt.Errorf("bad git commit %s: no tree", id)
+	}
+	if c.tree, err = parseOID(string(data[5:45])); err != nil {
+		return nil, err
+	}
+	for _, p := range c.Parents {
+		pid, err := parseOID(p)
+		if err != nil {
+			return nil, err
+		}
+		c.parent = append(c.parent, pid)
+	}
+
+	r.mu.Lock()
+	r.commits[id] = c
+	r.mu.Unlock()
+	return c, nil
+}
+
+// resolveRevision returns the commit that a revision refers to. It
+// supports object IDs (full or abbreviated), ref names (as in git
+// rev-parse), and "^", "^<n>" and "~<n>" suffixes.
+func (r *gitRepo) resolveRevision(rev string) (oid, error) {
+	base := rev
+	if i := strings.IndexAny(rev, "^~"); i != -1 {
+		base = rev[:i]
+	}
+	id, err := r.resolveName(base)
+	if err != nil {
+		return oid{}, err
+	}
+	if id, err = r.peelToCommit(id); errors.Is(err, errObjectNotFound) {
+		return oid{}, fmt.Errorf("%w: %s", ErrRevisionNotFound, rev)
+	} else if err != nil {
+		return oid{}, err
+	}
+
+	for s := rev[len(base):]; s != ""; {
+		op := s[0]
+		s = s[1:]
+		n := 1
+		if i := strings.IndexFunc(s, func(c rune) bool { return c < '0' || c > '9' }); i != 0 {
+			if i == -1 {
+				i = len(s)
+			}
+			if n, err = strconv.Atoi(s[:i]); err != nil {
+				return oid{}, fmt.Errorf("%w: %s", ErrRevisionNotFound, rev)
+			}
+			s = s[i:]
+		}
+		switch op {
+		case '^':
+			if n == 0 {
+				continue
+			}
+			c, err := r.commit(id)
+			if err != nil {
+				return oid{}, err
+			}
+			if n > len(c.parent) {
+				return oid{}, fmt.Errorf("%w: %s", ErrRevisionNotFound, rev)
+			}
+			id = c.parent[n-1]
+		case '~':
+			for ; n > 0; n-- {
+				c, err := r.commit(id)
+				if err != nil {
+					return oid{}, err
+				}
+				if len(c.parent) == 0 {
+					return oid{}, fmt.Errorf("%w: %s", ErrRevisionNotFound, rev)
+				}
+				id = c.parent[0]
+			}
+		default:
+			return oid{}, fmt.Errorf("%w: %s", ErrRevisionNotFound, rev)
+		}
+	}
+	return id, nil
+}
+
+// resolveName resolves a ref name or object ID.
+func (r *gitRepo) resolveName(name string) (oid, error) {
+	if name == "" || name == "@" {
+		name = "HEAD"
+	}
+	if len(name) == 40 {
+		if id, err := parseOID(name); err == nil {
+			return id, nil
+		}
+	}
+	for _, ref := range []string{name, "refs/" + name, "refs/tags/" + name, "refs/heads/" + name, "refs/remotes/" + name, "refs/remotes/" + name + "/HEAD"} {
+		id, ok, err := r.readRef(ref, 0)
+		if err != nil {
+			return oid{}, err
+		}
+		if ok {
+			return id, nil
+		}
+	}
+	if len(name) >= 4 && len(name) < 40 && isHex(name) {
+		return r.findAbbreviated(strings.ToLower(name))
+	}
+	return oid{}, fmt.Errorf("%w: %s", ErrRevisionNotFound, name)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// readRef reads a (possibly symbolic) ref from its loose file or
+// packed-refs.
+func (r *gitRepo) readRef(ref string, depth int) (oid, bool, error) {
+	if depth > 10 {
+		return oid{}, false, fmt.Errorf("git ref %s is a symbolic ref loop", ref)
+	}
+	// HEAD and other pseudo-refs are per-work tree; other refs are shared.
+	dir := r.commonDir
+	if !strings.HasPrefix(ref, "refs/") {
+		dir = r.gitDir
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(ref)))
+	if err == nil {
+		s := strings.TrimSpace(string(data))
+		if strings.HasPrefix(s, "ref: ") {
+			return r.readRef(strings.TrimPrefix(s, "ref: "), depth+1)
+		}
+		id, err := parseOID(s)
+		return id, err == nil, nil
+	}
+
+	f, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return oid{}, false, nil
+	}
+	if err != nil {
+		return oid{}, false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// "<ID> <ref>", or "^<peeled ID>" after a tag.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == ref {
+			id, err := parseOID(fields[0])
+			return id, err == nil, nil
+		}
+	}
+	return oid{}, false, scanner.Err()
+}
+
+// findAbbreviated returns the object whose ID starts with prefix.
+func (r *gitRepo) findAbbreviated(prefix string) (oid, error) {
+	var matches []oid
+	for _, dir := range r.objectDirs {
+		names, _ := filepath.Glob(filepath.Join(dir, prefix[:2], prefix[2:]+"*"))
+		for _, name := range names {
+			if id, err := parseOID(prefix[:2] + filepath.Base(name)); err == nil {
+				matches = append(matches, id)
+			}
+		}
+	}
+	for _, p := range r.packs {
+		matches = append(matches, p.findPrefix(prefix)...)
+	}
+	sort.Slice(matches, func(i, j int) bool { return bytes.Compare(matches[i][:], matches[j][:]) < 0 })
+	for i := 1; i < len(matches); i++ {
+		if matches[i] != matches[0] {
+			return oid{}, fmt.Errorf("%w: short object ID %s is ambiguous", ErrRevisionNotFound, prefix)
+		}
+	}
+	if len(matches) == 0 {
+		return oid{}, fmt.Errorf("%w: %s", ErrRevisionNotFound, prefix)
+	}
+	return matches[0], nil
+}
+
+// peelToCommit follows annotated tags to the commit that they point to.
+func (r *gitRepo) peelToCommit(id oid) (oid, error) {
+	for i := 0; i < 10; i++ {
+		typ, data, err := r.readObject(id)
+		if err != nil {
+			return oid{}, err
+		}
+		switch typ {
+		case objCommit:
+			return id, nil
+		case objTag:
+			if !bytes.HasPrefix(data, []byte("object ")) || len(data) < 47 {
+				return oid{}, fmt.Errorf("bad git tag %s", id)
+			}
+			if id, err = parseOID(string(data[7:47])); err != nil {
+				return oid{}, err
+			}
+		default:
+			return oid{}, fmt.Errorf("git object %s is not a commit", id)
+		}
+	}
+	return oid{}, fmt.Errorf("too many nested git tags at %s", id)
+}
+
+// gitPack is a packfile and its index.
+type gitPack struct {
+	f         *os.File
+	fanout    [256]uint32
+	ids       []byte // sorted 20-byte IDs
+	offsets   []byte // 4-byte offsets
+	offsets64 []byte
+
+	mu    sync.Mutex
+	cache map[int64]packedObject // recently read delta bases, by offset
+}
+
+type packedObject struct {
+	typ  int
+	data []byte
+}
+
+// maxPackCacheEntries bounds the number of delta bases cached per pack.
+const maxPackCacheEntries = 256
+
+func openGitPack(base string) (*gitPack, error) {
+	idx, err := ioutil.ReadFile(base + ".idx")
+	if err != nil {
+		return nil, err
+	}
+	// Version 2 index: magic, version, fanout table, IDs, CRCs, offsets,
+	// 64-bit offsets, and checksums.
+	if len(idx) < 8+256*4 || !bytes.Equal(idx[:8], []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}) {
+		return nil, fmt.Errorf("unsupported git pack index %s.idx", base)
+	}
+	p := &gitPack{cache: make(map[int64]packedObject)}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(idx[8+i*4:])
+	}
+	n := int(p.fanout[255])
+	tables := idx[8+256*4:]
+	if len(tables) < n*(20+4+4)+40 {
+		return nil, fmt.Errorf("truncated git pack index %s.idx", base)
+	}
+	p.ids = tables[:n*20]
+	p.offsets = tables[n*24 : n*28]
+	p.offsets64 = tables[n*28 : len(tables)-40]
+
+	if p.f, err = os.Open(base + ".pack"); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *gitPack) close() { p.f.Close() }
+
+// find returns the offset of an object in the pack.
+func (p *gitPack) find(id oid) (int64, bool) {
+	lo := 0
+	if id[0] > 0 {
+		lo = int(p.fanout[id[0]-1])
+	}
+	hi := int(p.fanout[id[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.ids[(lo+i)*20:(lo+i+1)*20], id[:]) >= 0
+	})
+	if i == hi || !bytes.Equal(p.ids[i*20:(i+1)*20], id[:]) {
+		return 0, false
+	}
+	offset := int64(binary.BigEndian.Uint32(p.offsets[i*4:]))
+	if offset&0x80000000 != 0 {
+		j := int(offset & 0x7fffffff)
+		offset = int64(binary.BigEndian.Uint64(p.offsets64[j*8:]))
+	}
+	return offset, true
+}
+
+// findPrefix returns the IDs of the objects in the pack that start with a
+// hexadecimal prefix.
+func (p *gitPack) findPrefix(prefix string) []oid {
+	var matches []oid
+	n := int(p.fanout[255])
+	for i := 0; i < n; i++ {
+		if s := hex.EncodeToString(p.ids[i*20 : (i+1)*20]); strings.HasPrefix(s, prefix) {
+			var id oid
+			copy(id[:], p.ids[i*20:])
+			matches = append(matches, id)
+		}
+	}
+	return matches
+}
+
+// readAt reads the object at an offset, applying deltas. r is used to
+// find the bases of ref deltas, which may be in other packs.
+func (p *gitPack) readAt(offset int64, r *gitRepo) (int, []byte, error) {
+	p.mu.Lock()
+	obj, ok := p.cache[offset]
+	p.mu.Unlock()
+	if ok {
+		return obj.typ, obj.data, nil
+	}
+
+	br := bufio.NewReader(io.NewSectionReader(p.f, offset, 1<<62))
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	typ := int(c>>4) & 7
+	size := int64(c & 0x0f)
+	for shift := uint(4); c&0x80 != 0; shift += 7 {
+		if c, err = br.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+		size |= int64(c&0x7f) << shift
+	}
+
+	var baseTyp int
+	var base []byte
+	switch typ {
+	case objOfsDelta:
+		c, err := br.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = br.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+			rel = ((rel + 1) << 7) | int64(c&0x7f)
+		}
+		if baseTyp, base, err = p.readAt(offset-rel, r); err != nil {
+			return 0, nil, err
+		}
+	case objRefDelta:
+		var baseID oid
+		if _, err := io.ReadFull(br, baseID[:]); err != nil {
+			return 0, nil, err
+		}
+		if baseTyp, base, err = r.readObject(baseID); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+	data := make([]byte, size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return 0, nil, err
+	}
+	if base != nil {
+		if data, err = applyDelta(base, data); err != nil {
+			return 0, nil, err
+		}
+		typ = baseTyp
+		p.cacheObject(offset, typ, data)
+	}
+	return typ, data, nil
+}
+
+// cacheObject caches a reconstructed object, which is likely to be the
+// base of other deltas.
+func (p *gitPack) cacheObject(offset int64, typ int, data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.cache) >= maxPackCacheEntries {
+		p.cache = make(map[int64]packedObject)
+	}
+	p.cache[offset] = packedObject{typ, data}
+}
+
+// applyDelta applies a git delta to base.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errBad := errors.New("bad git delta")
+	varint := func() (int, error) {
+		n, shift := 0, uint(0)
+		for {
+			if len(delta) == 0 {
+				return 0, errBad
+			}
+			c := delta[0]
+			delta = delta[1:]
+			n |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return n, nil
+			}
+		}
+	}
+	baseSize, err := varint()
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, errBad
+	}
+	size, err := varint()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, size)
+	for len(delta) > 0 {
+		cmd := delta[0]
+		delta = delta[1:]
+		switch {
+		case cmd&0x80 != 0:
+			// Copy from base. The low 4 bits say which offset bytes are
+			// present, and the next 3 which size bytes are.
+			var offset, n int
+			for i := uint(0); i < 7; i++ {
+				if cmd&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errBad
+				}
+				if i < 4 {
+					offset |= int(delta[0]) << (8 * i)
+				} else {
+					n |= int(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if n == 0 {
+				n = 0x10000
+			}
+			if offset+n > len(base) {
+				return nil, errBad
+			}
+			out = append(out, base[offset:offset+n]...)
+		case cmd != 0:
+			// Insert the next cmd bytes.
+			if int(cmd) > len(delta) {
+				return nil, errBad
+			}
+			out = append(out, delta[:cmd]...)
+			delta = delta[cmd:]
+		default:
+			return nil, errBad
+		}
+	}
+	if len(out) != size {
+		return nil, errBad
+	}
+	return out, nil
+}
@@ -0,0 +1,149 @@
+package blame
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestPureGitBackend checks that the pure-Go git backend gives the same
+// results as the git backend, with loose and packed objects.
+func TestPureGitBackend(t *testing.T) {
+	r := newTestGitRepo(t)
+	a := "A <a@example.com>"
+	r.commit(testCommit{author: a, date: "2014-01-01T00:00:00Z", message: "add", files: map[string]string{
+		"f":       "package f\n\nfunc a() {\n\treturn\n}\n",
+		"d/g.txt": "one\ntwo\nthree\nfour\nfive\nsix\n",
+	}})
+	r.commit(testCommit{author: a, date: "2014-01-02T00:00:00Z", message: "indent", files: map[string]string{
+		"f": "package f\n\nfunc a() {\n    return\n}\n\nfunc b() {\n}\n",
+	}})
+	r.git(nil, "mv", "d/g.txt", "d/h.txt")
+	r.commit(testCommit{author: a, date: "2014-01-03T00:00:00Z", message: "rename and edit", files: map[string]string{
+		"d/h.txt": "one\ntwo\nthree\nfour\nfive\nsix\nseven",
+	}})
+
+	// A merge of a branch that edited f.
+	r.git(nil, "checkout", "-q", "-b", "side", "HEAD~1")
+	r.commit(testCommit{author: a, date: "2014-01-04T00:00:00Z", message: "side", files: map[string]string{
+		"f": "package f\n\n// a does nothing.\nfunc a() {\n    return\n}\n\nfunc b() {\n}\n",
+	}})
+	r.git(nil, "checkout", "-q", "-")
+	mergeEnv := []string{"GIT_AUTHOR_NAME=A", "GIT_AUTHOR_EMAIL=a@example.com", "GIT_AUTHOR_DATE=2014-01-05T00:00:00Z",
+		"GIT_COMMITTER_NAME=A", "GIT_COMMITTER_EMAIL=a@example.com", "GIT_COMMITTER_DATE=2014-01-05T00:00:00Z"}
+	r.git(mergeEnv, "merge", "-q", "--no-edit", "side")
+	r.git(nil, "tag", "v1", "HEAD~1")
+
+	ctx := context.Background()
+	git, err := LookupBackend("git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pure, err := LookupBackend("puregit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(name string) {
+		for _, opt := range []*BlameOptions{nil, {NoIgnoreWhitespace: true}} {
+			for _, file := range []string{"f", "d/h.txt", filepath.Join(r.dir, "f")} {
+				for _, v := range []string{"HEAD", "HEAD^2", "v1", "HEAD~2"} {
+					wantHunks, wantCommits, wantErr := git.BlameFile(ctx, r.dir, file, v, opt)
+					hunks, commits, err := pure.BlameFile(ctx, r.dir, file, v, opt)
+					if (err != nil) != (wantErr != nil) {
+						t.Errorf("%s: %s at %s: got error %v, want %v", name, file, v, err, wantErr)
+						continue
+					}
+					if !reflect.DeepEqual(hunks, wantHunks) {
+						t.Errorf("%s: %s at %s (%+v): got hunks %+v, want %+v", name, file, v, opt, hunks, wantHunks)
+					}
+					if !reflect.DeepEqual(commits, wantCommits) {
+						t.Errorf("%s: %s at %s: got commits %+v, want %+v", name, file, v, commits, wantCommits)
+					}
+				}
+			}
+
+			// The second range starts past the end of the file.
+			for _, lines := range [][2]int{{2, 5}, {100, 200}} {
+				wantHunks, _, err := git.(RangeBackend).BlameFileRange(ctx, r.dir, "f", "HEAD", lines[0], lines[1], opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				hunks, _, err := pure.(RangeBackend).BlameFileRange(ctx, r.dir, "f", "HEAD", lines[0], lines[1], opt)
+				if err != nil || !reflect.DeepEqual(hunks, wantHunks) {
+					t.Errorf("%s: range %v: got hunks %+v and error %v, want %+v", name, lines, hunks, err, wantHunks)
+				}
+			}
+		}
+
+		// Blaming a subdirectory of the work tree.
+		wantFiles, err := git.ListFiles(ctx, filepath.Join(r.dir, "d"), "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := pure.ListFiles(ctx, filepath.Join(r.dir, "d"), "HEAD")
+		if err != nil || !reflect.DeepEqual(files, wantFiles) {
+			t.Errorf("%s: got files %v and error %v, want %v", name, files, err, wantFiles)
+		}
+
+		wantHunksByFile, wantCommits, err := git.BlameRepository(ctx, r.dir, "HEAD", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hunksByFile, commits, err := pure.BlameRepository(ctx, r.dir, "HEAD", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(hunksByFile, wantHunksByFile) || !reflect.DeepEqual(commits, wantCommits) {
+			t.Errorf("%s: got repository blame %+v, %+v, want %+v, %+v", name, hunksByFile, commits, wantHunksByFile, wantCommits)
+		}
+
+		if _, _, err := pure.BlameFile(ctx, r.dir, "nonexistent", "HEAD", nil); err == nil {
+			t.Errorf("%s: got nil error for nonexistent file", name)
+		}
+
+		// Options that only the git backend supports.
+		for _, opt := range []*BlameOptions{{DetectMoves: true}, {DetectCopies: 1}, {IgnoreRevs: []string{"HEAD"}}, {ReadIgnoreRevsFile: true}} {
+			if _, _, err := pure.BlameFile(ctx, r.dir, "f", "HEAD", opt); err == nil {
+				t.Errorf("%s: got nil error for unsupported options %+v", name, opt)
+			}
+			if _, _, err := pure.BlameRepository(ctx, r.dir, "HEAD", nil, opt); err == nil {
+				t.Errorf("%s: got nil error for unsupported options %+v in a repository blame", name, opt)
+			}
+		}
+	}
+	check("loose")
+	r.git(nil, "gc", "-q")
+	check("packed")
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b             string
+		ignoreWhitespace bool
+		want             []int
+	}{
+		{"", "x\n", false, []int{-1}},
+		{"a\nb\nc\n", "a\nc\n", false, []int{0, 2}},
+		{"a\nb\n", "a\nx\nb\n", false, []int{0, -1, 1}},
+		{"a\n b\n", "a\nb \n", false, []int{0, -1}},
+		{"a\n b\n", "a\nb \n", true, []int{0, 1}},
+		{"a\nb", "a\nb\n", false, []int{0, -1}},
+		{"a\nb", "a\nb\n", true, []int{0, 1}},
+
+		// The inserted function is placed after the existing one's closing
+		// brace, not before it, by the indent heuristic.
+		{
+			"func a() {\n}\n",
+			"func a() {\n}\n\nfunc b() {\n}\n",
+			false, []int{0, 1, -1, -1, -1},
+		},
+	}
+	for _, test := range tests {
+		got := diffLines([]byte(test.a), []byte(test.b), test.ignoreWhitespace)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("diffLines(%q, %q, %v): got %v, want %v", test.a, test.b, test.ignoreWhitespace, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package blame
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+)
+
+// A RangeBackend is a Backend that can blame a range of a file's lines
+// without blaming the whole file. The git and hg backends are
+// RangeBackends.
+type RangeBackend interface {
+	Backend
+
+	// BlameFileRange blames lines [startLine, endLine) of a file, which
+	// are numbered from 0. See BlameFileRange.
+	BlameFileRange(ctx context.Context, repoPath, filePath, v string, startLine, endLine int, opt *BlameOptions) ([]Hunk, map[string]Commit, error)
+}
+
+// BlameFileRange blames lines [startLine, endLine) of a file, numbered
+// from 0, as in Hunk. The hunks only cover lines in the range, but their
+// line and character offsets are still relative to the start of the file,
+// so they line up with the hunks that BlameFile returns. If endLine is
+// past the end of the file, the lines up to the end are blamed; if
+// startLine is too, no hunks are returned.
+func BlameFileRange(repoPath, filePath, v string, startLine, endLine int) ([]Hunk, map[string]Commit, error) {
+	return BlameFileRangeContext(context.Background(), repoPath, filePath, v, startLine, endLine, nil)
+}
+
+// BlameFileRangeContext is like BlameFileRange, but kills the git or hg
+// process when ctx is done. In that case, the returned error is ctx.Err().
+// If opt is nil, the default options are used.
+//
+// If the backend returned by DetectBackend is not a RangeBackend, the
+// whole file is blamed and the hunks that overlap the range are returned
+// unchanged, so they may extend past it.
+func BlameFileRangeContext(ctx context.Context, repoPath, filePath, v string, startLine, endLine int, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	if err := checkLineRange(startLine, endLine); err != nil {
+		return nil, nil, err
+	}
+	_, b := DetectBackend(repoPath)
+	if rb, ok := b.(RangeBackend); ok {
+		return rb.BlameFileRange(ctx, repoPath, filePath, v, startLine, endLine, opt)
+	}
+
+	hunks, commits, err := b.BlameFile(ctx, repoPath, filePath, v, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	var overlapping []Hunk
+	for _, h := range hunks {
+		if overlap(h.LineStart, h.LineEnd, startLine, endLine) > 0 {
+			overlapping = append(overlapping, h)
+		}
+	}
+	return overlapping, commits, nil
+}
+
+// Note: filePath should be absolute or relative to repoPath
+func BlameGitFileRange(repoPath string, filePath string, v string, startLine, endLine int) ([]Hunk, map[string]Commit, error) {
+	return BlameGitFileRangeContext(context.Background(), repoPath, filePath, v, startLine, endLine, nil)
+}
+
+func BlameGitFileRangeContext(ctx context.Context, repoPath string, filePath string, v string, startLine, endLine int, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	if err := checkLineRange(startLine, endLine); err != nil {
+		return nil, nil, err
+	}
+	opt, cleanup, err := prepareGitOptions(ctx, repoPath, v, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanup()
+	hunks, commits, err := blameGitFileRange(ctx, repoPath, filePath, v, &Range{Start: startLine, End: endLine}, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := addGitCommitDetails(ctx, repoPath, commits); err != nil {
+		return nil, nil, err
+	}
+	return hunks, commits, nil
+}
+
+// Note: filePath should be absolute or relative to repoPath
+func BlameHgFileRange(repoPath string, filePath string, v string, startLine, endLine int) ([]Hunk, map[string]Commit, error) {
+	return BlameHgFileRangeContext(context.Background(), repoPath, filePath, v, startLine, endLine, nil)
+}
+
+// BlameHgFileRangeContext annotates the whole file with hg, which has no
+// equivalent of git blame -L, and returns the hunks of the lines in the
+// range.
+func BlameHgFileRangeContext(ctx context.Context, repoPath string, filePath string, v string, startLine, endLine int, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	if err := checkLineRange(startLine, endLine); err != nil {
+		return nil, nil, err
+	}
+	return blameHgFileRange(ctx, repoPath, filePath, v, &Range{Start: startLine, End: endLine}, opt)
+}
+
+func (gitBackend) BlameFileRange(ctx context.Context, repoPath, filePath, v string, startLine, endLine int, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	return BlameGitFileRangeContext(ctx, repoPath, filePath, v, startLine, endLine, opt)
+}
+
+func (hgBackend) BlameFileRange(ctx context.Context, repoPath, filePath, v string, startLine, endLine int, opt *BlameOptions) ([]Hunk, map[string]Commit, error) {
+	return BlameHgFileRangeContext(ctx, repoPath, filePath, v, startLine, endLine, opt)
+}
+
+func checkLineRange(startLine, endLine int) error {
+	if startLine < 0 || endLine <= startLine {
+		return fmt.Errorf("blame: invalid line range [%d, %d)", startLine, endLine)
+	}
+	return nil
+}
+
+// gitArgs returns the git blame flags that select the lines of r, which
+// must be a line range. A nil r selects the whole file.
+func (r *Range) gitArgs() []string {
+	if r == nil {
+		return nil
+	}
+	return []string{"-L", strconv.Itoa(r.Start+1) + "," + strconv.Itoa(r.End)}
+}
+
+// errPastEnd is returned by gitLineOffset, and is the kind of the
+// *CommandError that git blame -L fails with, for line ranges that start
+// past the end of the file.
+var errPastEnd = errors.New("line is past the end of the file")
+
+// gitLineOffset returns the character offset of the start of line n
+// (numbered from 0) of a file at revision v, or errPastEnd if the file
+// has no such line. It returns ErrBinaryFile if the file is binary, as far
+// as can be told from the lines before n. Line 0 is at offset 0, even in
+// an empty file.
+func gitLineOffset(ctx context.Context, repoPath, filePath, v string, n int) (int, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if filepath.IsAbs(filePath) {
+		absRepoPath, err := filepath.Abs(repoPath)
+		if err != nil {
+			return 0, err
+		}
+		if filePath, err = filepath.Rel(absRepoPath, filePath); err != nil {
+			return 0, err
+		}
+	}
+	// "<rev>:./<path>" is relative to the command's directory, like the
+	// paths given to git blame.
+	cmd := command(ctx, repoPath, "git", "cat-file", "blob", v+":./"+filepath.ToSlash(filePath))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, commandErr(ctx, cmd, err)
+	}
+	// Only the first n lines are needed, so stop git early.
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	r := bufio.NewReader(stdout)
+	var (
+		offset int
+		binary bool
+	)
+	advance := func(data []byte) {
+		if n := 8000 - offset; n > 0 {
+			if len(data) < n {
+				n = len(data)
+			}
+			binary = binary || isBinary(data[:n])
+		}
+		offset += len(data)
+	}
+	for i := 0; i < n && !binary; i++ {
+		line, err := r.ReadSlice('\n')
+		for err == bufio.ErrBufferFull {
+			advance(line)
+			line, err = r.ReadSlice('\n')
+		}
+		advance(line)
+		if err == io.EOF {
+			return 0, errPastEnd
+		}
+		if err != nil {
+			return 0, contextErr(ctx, err)
+		}
+	}
+	if binary {
+		return 0, fileError(ErrBinaryFile, filePath, v)
+	}
+	// Line n exists if anything follows line n-1.
+	if _, err := r.Peek(1); err == io.EOF {
+		return 0, errPastEnd
+	} else if err != nil {
+		return 0, contextErr(ctx, err)
+	}
+	return offset, nil
+}
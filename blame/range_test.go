@@ -0,0 +1,66 @@
+package blame
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestBlameGitFileRange(t *testing.T) {
+	r := newTestGitRepo(t)
+	c1 := r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add f", files: map[string]string{"f": "a\nbb\nccc\n"}})
+	c2 := r.commit(testCommit{author: "B <b@example.com>", date: "2014-01-02T00:00:00Z", message: "insert", files: map[string]string{"f": "a\nxx\nyy\nbb\nccc\n"}})
+
+	tests := []struct {
+		start, end int
+		want       []Hunk
+	}{
+		{0, 5, []Hunk{
+			{CommitID: c1, LineStart: 0, LineEnd: 1, CharStart: 0, CharEnd: 2},
+			{CommitID: c2, LineStart: 1, LineEnd: 3, CharStart: 2, CharEnd: 8},
+			{CommitID: c1, LineStart: 3, LineEnd: 5, CharStart: 8, CharEnd: 15},
+		}},
+		{2, 4, []Hunk{
+			{CommitID: c2, LineStart: 2, LineEnd: 3, CharStart: 5, CharEnd: 8},
+			{CommitID: c1, LineStart: 3, LineEnd: 4, CharStart: 8, CharEnd: 11},
+		}},
+		{4, 100, []Hunk{
+			{CommitID: c1, LineStart: 4, LineEnd: 5, CharStart: 11, CharEnd: 15},
+		}},
+		{5, 100, nil},
+		{7, 100, nil},
+	}
+	for _, test := range tests {
+		hunks, commits, err := BlameFileRange(r.dir, "f", "HEAD", test.start, test.end)
+		if err != nil {
+			t.Errorf("[%d, %d): %s", test.start, test.end, err)
+			continue
+		}
+		if !reflect.DeepEqual(hunks, test.want) {
+			t.Errorf("[%d, %d): got hunks %+v, want %+v", test.start, test.end, hunks, test.want)
+		}
+		for _, h := range hunks {
+			if commits[h.CommitID].Message == "" {
+				t.Errorf("[%d, %d): commit %s has no message", test.start, test.end, h.CommitID)
+			}
+		}
+	}
+
+	r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-03T00:00:00Z", message: "add empty", files: map[string]string{"empty": ""}})
+	if hunks, _, err := BlameFileRange(r.dir, "empty", "HEAD", 0, 1); err != nil || hunks != nil {
+		t.Errorf("empty file: got %+v, %v, want no hunks", hunks, err)
+	}
+
+	if _, _, err := BlameFileRange(r.dir, "f", "HEAD", 3, 3); err == nil {
+		t.Error("got nil error for empty range")
+	}
+}
+
+func TestGitLineOffset_zero(t *testing.T) {
+	// Line 0 is at offset 0 without reading the file, so even a missing
+	// one has it.
+	offset, err := gitLineOffset(context.Background(), t.TempDir(), "missing", "HEAD", 0)
+	if offset != 0 || err != nil {
+		t.Errorf("got %d, %v, want 0, nil", offset, err)
+	}
+}
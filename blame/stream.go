@@ -0,0 +1,156 @@
+package blame
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// A FileBlame is the blame of one file of a repository, as passed to the
+// function given to StreamRepository.
+type FileBlame struct {
+	Path  string // relative to the repository
+	Hunks []Hunk
+
+	// Commits are the commits of Hunks that weren't in the Commits of an
+	// earlier FileBlame of the same repository, by ID. Together, the
+	// FileBlames' Commits are the commits that BlameRepository returns.
+	Commits map[string]Commit
+
+	// Err, if non-nil, is why the file couldn't be blamed. Hunks and
+	// Commits are nil.
+	Err error
+}
+
+// A StreamBackend is a Backend that can pass the blame of each file of a
+// repository on as soon as it's done. The git, hg and puregit backends are
+// StreamBackends.
+type StreamBackend interface {
+	Backend
+
+	// StreamRepository blames all files in the repository at revision v,
+	// like BlameRepository, calling fn with each file's blame. See
+	// StreamRepository.
+	StreamRepository(ctx context.Context, repoPath, v string, ignorePatterns []string, opt *BlameOptions, fn func(FileBlame) error) error
+}
+
+// StreamRepository blames all files in the repository at repoPath, like
+// BlameRepository, but calls fn with the blame of each file as soon as
+// it's done, so that the results needn't all be kept in memory. Files are
+// passed in the order in which they finish, and fn is called by one
+// goroutine at a time. Binary files are skipped.
+//
+// If a file can't be blamed, fn is called with the error in its Err. If
+// fn returns an error, no more files are blamed or passed to fn, and
+// StreamRepository returns the error.
+func StreamRepository(repoPath, v string, ignorePatterns []string, fn func(FileBlame) error) error {
+	return StreamRepositoryContext(context.Background(), repoPath, v, ignorePatterns, nil, fn)
+}
+
+// StreamRepositoryContext is like StreamRepository, but stops blaming and
+// kills any running git or hg processes when ctx is done. In that case,
+// the returned error is ctx.Err(). If opt is nil, the default options are
+// used.
+//
+// If the backend returned by DetectBackend is not a StreamBackend, the
+// repository is blamed with BlameRepository, and then its files are
+// passed to fn in order. Failed files are then only passed to fn if
+// opt.MaxFailedFiles lets BlameRepository continue past them.
+func StreamRepositoryContext(ctx context.Context, repoPath, v string, ignorePatterns []string, opt *BlameOptions, fn func(FileBlame) error) error {
+	_, b := DetectBackend(repoPath)
+	if sb, ok := b.(StreamBackend); ok {
+		return sb.StreamRepository(ctx, repoPath, v, ignorePatterns, opt, fn)
+	}
+
+	hunks, commits, err := b.BlameRepository(ctx, repoPath, v, ignorePatterns, opt)
+	if err != nil && !isPartial(err) {
+		return err
+	}
+	failed := make(map[string]error)
+	var fileErrs *FileErrors
+	if errors.As(err, &fileErrs) {
+		for _, f := range fileErrs.Files {
+			failed[f.Path] = f.Err
+		}
+	}
+	files := make([]string, 0, len(hunks)+len(failed))
+	for file := range hunks {
+		files = append(files, file)
+	}
+	for file := range failed {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	sent := make(map[string]bool)
+	for _, file := range files {
+		fb := FileBlame{Path: file, Err: failed[file]}
+		if fb.Err == nil {
+			fb.Hunks, fb.Commits = hunks[file], newCommits(hunks[file], commits, sent)
+		}
+		if err := fn(fb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (gitBackend) StreamRepository(ctx context.Context, repoPath, v string, ignorePatterns []string, opt *BlameOptions, fn func(FileBlame) error) error {
+	return streamGitRepository(ctx, repoPath, v, ignorePatterns, opt, fn)
+}
+
+func (hgBackend) StreamRepository(ctx context.Context, repoPath, v string, ignorePatterns []string, opt *BlameOptions, fn func(FileBlame) error) error {
+	return streamHgRepository(ctx, repoPath, v, ignorePatterns, opt, fn)
+}
+
+// streamFiles blames files like blameFiles, but calls fn with the blame
+// of each file as soon as it's done, as StreamRepository describes. If
+// details is non-nil, it is called with the new commits of each file
+// before fn, to fill them in.
+func streamFiles(ctx context.Context, blameFile blameFileFunc, repoPath string, files []string, v string, ignorePatterns []string, opt *BlameOptions, details func(map[string]Commit) error, fn func(FileBlame) error) error {
+	blameable, err := selectFiles(files, ignorePatterns)
+	if err != nil {
+		return err
+	}
+
+	sent := make(map[string]bool)
+	stopped := false
+	return forEachFile(ctx, blameFile, repoPath, blameable, v, opt, func(i int, r fileResult) error {
+		// Files that were started before fn failed or ctx was done still
+		// finish, but aren't passed on.
+		if stopped || r.binary || ctx.Err() != nil {
+			return nil
+		}
+		fb := FileBlame{Path: blameable[i], Err: r.err}
+		if r.err == nil {
+			fb.Hunks = r.hunks
+			fb.Commits = newCommits(r.hunks, r.commits, sent)
+			if details != nil {
+				if err := details(fb.Commits); err != nil {
+					stopped = true
+					return err
+				}
+			}
+		}
+		if err := fn(fb); err != nil {
+			stopped = true
+			return err
+		}
+		return nil
+	})
+}
+
+// newCommits returns the commits of hunks that aren't in sent, and adds
+// them to sent.
+func newCommits(hunks []Hunk, commits map[string]Commit, sent map[string]bool) map[string]Commit {
+	var c map[string]Commit
+	for _, h := range hunks {
+		if !sent[h.CommitID] {
+			sent[h.CommitID] = true
+			if c == nil {
+				c = make(map[string]Commit)
+			}
+			c[h.CommitID] = commits[h.CommitID]
+		}
+	}
+	return c
+}
@@ -0,0 +1,232 @@
+package blame
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// collectStream returns the files and commits that fn is called with by
+// stream, checking that each file and commit is passed once.
+func collectStream(t *testing.T, stream func(fn func(FileBlame) error) error) (map[string][]Hunk, map[string]Commit) {
+	hunks := make(map[string][]Hunk)
+	commits := make(map[string]Commit)
+	err := stream(func(fb FileBlame) error {
+		if fb.Err != nil {
+			return fb.Err
+		}
+		if _, dup := hunks[fb.Path]; dup {
+			t.Errorf("file %s passed twice", fb.Path)
+		}
+		hunks[fb.Path] = fb.Hunks
+		for id, c := range fb.Commits {
+			if _, dup := commits[id]; dup {
+				t.Errorf("commit %s passed twice", id)
+			}
+			commits[id] = c
+		}
+		for _, h := range fb.Hunks {
+			if _, ok := commits[h.CommitID]; !ok {
+				t.Errorf("%s: commit %s passed after its hunk", fb.Path, h.CommitID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hunks, commits
+}
+
+func TestStreamRepository(t *testing.T) {
+	r := newTestGitRepo(t)
+	r.commit(testCommit{author: "A <a@example.com>", date: "2014-01-01T00:00:00Z", message: "add", files: map[string]string{
+		"a": "a\nb\n", "b": "b\n", "d/c": "c\n", "empty": "", "bin": "\x00",
+	}})
+	r.commit(testCommit{author: "B <b@example.com>", date: "2014-01-02T00:00:00Z", message: "change", files: map[string]string{
+		"a": "a\nx\n", "d/e": "e\n",
+	}})
+
+	for _, name := range []string{"git", "puregit"} {
+		b, err := LookupBackend(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sb, ok := b.(StreamBackend)
+		if !ok {
+			t.Fatalf("%s: not a StreamBackend", name)
+		}
+		wantHunks, wantCommits, err := b.BlameRepository(context.Background(), r.dir, "HEAD", []string{"b"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hunks, commits := collectStream(t, func(fn func(FileBlame) error) error {
+			return sb.StreamRepository(context.Background(), r.dir, "HEAD", []string{"b"}, nil, fn)
+		})
+		if !reflect.DeepEqual(hunks, wantHunks) {
+			t.Errorf("%s: got hunks %+v, want %+v", name, hunks, wantHunks)
+		}
+		if !reflect.DeepEqual(commits, wantCommits) {
+			t.Errorf("%s: got commits %+v, want %+v", name, commits, wantCommits)
+		}
+	}
+
+	wantErr := errors.New("stop")
+	n := 0
+	err := StreamRepositoryContext(context.Background(), r.dir, "HEAD", nil, nil, func(fb FileBlame) error {
+		n++
+		return wantErr
+	})
+	if err != wantErr || n != 1 {
+		t.Errorf("got error %v after %d files, want %v after 1", err, n, wantErr)
+	}
+
+	if err := StreamRepository(r.dir, "nonexistent", nil, func(FileBlame) error { return nil }); !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrRevisionNotFound)
+	}
+}
+
+func TestStreamRepository_Hg(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".hg"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	node1, node2 := strings.Repeat("1", 40), strings.Repeat("2", 40)
+	s := fakeHgServer(t, func(args []string) [][]byte {
+		var out string
+		switch args[0] {
+		case "locate":
+			out = "a\x00b\x00empty\x00"
+		case "log":
+			out = `[{"node": "` + node2 + `", "user": "B <b@example.com>", "date": [1388620800, 0], "desc": "change", "parents": ["` + node1 + `"]},
+				{"node": "` + node1 + `", "user": "A <a@example.com>", "date": [1388534400, 0], "desc": "add", "parents": []}]`
+		case "annotate":
+			// Only the files in the list file are annotated.
+			annotated := map[string]string{
+				"a":     `{"abspath": "a", "lines": [{"line": "a\n", "node": "` + node1 + `"}, {"line": "x\n", "node": "` + node2 + `"}]}`,
+				"b":     `{"abspath": "b", "lines": [{"line": "b\n", "node": "` + node2 + `"}]}`,
+				"empty": `{"abspath": "empty", "lines": []}`,
+			}
+			list, err := ioutil.ReadFile(strings.TrimPrefix(args[len(args)-1], "listfile0:"))
+			if err != nil {
+				t.Error(err)
+				return [][]byte{hgResult(255)}
+			}
+			var files []string
+			for _, name := range strings.Split(strings.TrimSuffix(string(list), "\x00"), "\x00") {
+				files = append(files, annotated[strings.TrimPrefix(name, "path:")])
+			}
+			out = "[" + strings.Join(files, ",") + "]"
+		default:
+			t.Errorf("unexpected hg command %q", args)
+			return [][]byte{hgResult(255)}
+		}
+		return [][]byte{hgMessage('o', out), hgResult(0)}
+	})
+	useHgServer(t, dir, s)
+
+	wantHunks, wantCommits, err := hgBackend{}.BlameRepository(context.Background(), dir, "tip", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hunks, commits := collectStream(t, func(fn func(FileBlame) error) error {
+		return StreamRepository(dir, "tip", nil, fn)
+	})
+	if !reflect.DeepEqual(hunks, wantHunks) || len(hunks) != 2 {
+		t.Errorf("got hunks %+v, want %+v", hunks, wantHunks)
+	}
+	if !reflect.DeepEqual(commits, wantCommits) || len(commits) != 2 {
+		t.Errorf("got commits %+v, want %+v", commits, wantCommits)
+	}
+
+	// fn may run hg in the same repository, because it's called between
+	// hg commands.
+	defer func(n int) { hgStreamBatch = n }(hgStreamBatch)
+	hgStreamBatch = 1
+	var files []string
+	err = StreamRepository(dir, "tip", nil, func(fb FileBlame) error {
+		files = append(files, fb.Path)
+		_, err := listHgRepositoryFiles(context.Background(), dir, "tip")
+		return err
+	})
+	if err != nil || !reflect.DeepEqual(files, []string{"a", "b"}) {
+		t.Errorf("got files %v and error %v, want [a b]", files, err)
+	}
+}
+
+func TestStreamRepository_notStreamBackend(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, ".testvcs"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	hunks, commits := collectStream(t, func(fn func(FileBlame) error) error {
+		return StreamRepository(dir, "v", nil, fn)
+	})
+	want, wantCommits, _ := testBackend{}.BlameRepository(context.Background(), dir, "v", nil, nil)
+	if !reflect.DeepEqual(hunks, want) || !reflect.DeepEqual(commits, wantCommits) {
+		t.Errorf("got %+v and %+v, want %+v and %+v", hunks, commits, want, wantCommits)
+	}
+}
+
+func TestStreamFiles(t *testing.T) {
+	opt := &BlameOptions{Workers: 4}
+	var files []string
+	for i := 0; i < 50; i++ {
+		files = append(files, fmt.Sprintf("f%d", i))
+	}
+	b := seqBackend{fail: map[string]bool{"f7": true, "f30": true}}
+
+	// Files that fail are passed with their errors.
+	var failed []string
+	n := 0
+	err := streamFiles(context.Background(), b.BlameFile, "", files, "v", nil, opt, nil, func(fb FileBlame) error {
+		n++
+		if fb.Err != nil {
+			failed = append(failed, fb.Path)
+			if fb.Hunks != nil || fb.Commits != nil {
+				t.Errorf("%s: got hunks or commits with error", fb.Path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 50 || len(failed) != 2 {
+		t.Errorf("got %d files and failures %v, want 50 and [f7 f30]", n, failed)
+	}
+
+	// Returning an error stops blaming.
+	n = 0
+	err = streamFiles(context.Background(), b.BlameFile, "", files, "v", nil, opt, nil, func(fb FileBlame) error {
+		n++
+		return fb.Err
+	})
+	if err == nil || (err.Error() != "failed f7" && err.Error() != "failed f30") {
+		t.Errorf("got error %v, want failed f7 or f30", err)
+	}
+	if n > 31+opt.Workers {
+		t.Errorf("got %d files after the failure, want blaming to stop", n)
+	}
+
+	// If ctx is done, nothing more is passed on.
+	ctx, cancel := context.WithCancel(context.Background())
+	bb := blockingBackend{started: make(chan struct{}, 3)}
+	go func() {
+		<-bb.started
+		cancel()
+	}()
+	err = streamFiles(ctx, bb.BlameFile, "", []string{"a", "b", "c"}, "v", nil, nil, nil, func(fb FileBlame) error {
+		t.Errorf("got file %s after cancellation", fb.Path)
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
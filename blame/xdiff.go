@@ -0,0 +1,790 @@
+package blame
+
+import "bytes"
+
+// This file is a port of the parts of git's xdiff library that git blame
+// uses to compare two versions of a file: the Myers diff algorithm (with
+// xdiff's heuristics for large inputs) and the post-processing that slides
+// groups of changed lines to where a human would put them. Blame output
+// depends on exactly which lines a diff considers unchanged, so the port
+// follows xdiff closely, including its choices between equally short
+// diffs.
+
+// diffLines compares the lines of a and b. It returns, for each line of
+// b, the index of the line of a that it is unchanged from, or -1 if it was
+// added or changed. If ignoreWhitespace is true, lines that only differ
+// in whitespace are considered unchanged (git diff -w).
+func diffLines(a, b []byte, ignoreWhitespace bool) []int {
+	// git blame doesn't diff the identical ends of the files.
+	a, b, nTail := trimCommonTail(a, b)
+	linesA, linesB := splitLines(a), splitLines(b)
+
+	match := make([]int, len(linesB)+nTail)
+	for i := range match {
+		match[i] = -1
+	}
+	for i := 0; i < nTail; i++ {
+		match[len(linesB)+i] = len(linesA) + i
+	}
+
+	x1, x2 := prepareXDFiles(linesA, linesB, ignoreWhitespace)
+	x1.compareRecords(x2)
+	x1.compact(x2)
+	x2.compact(x1)
+
+	i, j := 0, 0
+	for {
+		for i < x1.nrec && x1.changed(i) {
+			i++
+		}
+		for j < x2.nrec && x2.changed(j) {
+			j++
+		}
+		if i == x1.nrec || j == x2.nrec {
+			break
+		}
+		match[j] = i
+		i++
+		j++
+	}
+	return match
+}
+
+// trimCommonTail removes the identical ends of a and b in 1 KB blocks, as
+// git's xdi_diff does, keeping the part of the last block up to and
+// including its first newline. It returns the number of lines removed.
+func trimCommonTail(a, b []byte) ([]byte, []byte, int) {
+	const blk = 1024
+	smaller := len(a)
+	if len(b) < smaller {
+		smaller = len(b)
+	}
+	trimmed := 0
+	for blk+trimmed <= smaller && bytes.Equal(a[len(a)-trimmed-blk:len(a)-trimmed], b[len(b)-trimmed-blk:len(b)-trimmed]) {
+		trimmed += blk
+	}
+	if trimmed == 0 {
+		return a, b, 0
+	}
+	tail := a[len(a)-trimmed:]
+	i := bytes.IndexByte(tail, '\n')
+	if i == -1 {
+		return a, b, 0
+	}
+	tail = tail[i+1:]
+	return a[:len(a)-len(tail)], b[:len(b)-len(tail)], len(splitLines(tail))
+}
+
+// splitLines splits data into lines, each including its newline (except
+// perhaps the last).
+func splitLines(data []byte) [][]byte {
+	var lines [][]byte
+	for len(data) > 0 {
+		n := bytes.IndexByte(data, '\n') + 1
+		if n == 0 {
+			n = len(data)
+		}
+		lines = append(lines, data[:n])
+		data = data[n:]
+	}
+	return lines
+}
+
+// xdiffIsSpace reports whether xdiff considers c whitespace.
+func xdiffIsSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// xdfile is one of the files being compared (xdiff's xdfile_t).
+type xdfile struct {
+	recs [][]byte
+	ha   []int // the equivalence class of each line
+	nrec int
+
+	// rchg[i+1] is true if line i is changed. The extra elements before
+	// and after the lines are always false.
+	rchg []bool
+
+	// The lines between dstart and dend (inclusive) are the ones that are
+	// not identical at the start and end of both files. rindex maps the
+	// lines that the diff algorithm considers to their line numbers, and
+	// rha holds their classes.
+	dstart, dend int
+	rindex       []int
+	rha          []int
+}
+
+func (x *xdfile) changed(i int) bool       { return x.rchg[i+1] }
+func (x *xdfile) setChanged(i int, c bool) { x.rchg[i+1] = c }
+
+// prepareXDFiles classifies the lines of both files, trims their identical
+// starts and ends, and discards lines that can't match or that match too
+// often to be useful (xdl_prepare_env).
+func prepareXDFiles(linesA, linesB [][]byte, ignoreWhitespace bool) (*xdfile, *xdfile) {
+	classes := make(map[string]int)
+	var count [2][]int // occurrences of each class in each file
+	classify := func(lines [][]byte, which int) *xdfile {
+		x := &xdfile{recs: lines, ha: make([]int, len(lines)), nrec: len(lines), rchg: make([]bool, len(lines)+2)}
+		for i, line := range lines {
+			key := line
+			if ignoreWhitespace {
+				key = make([]byte, 0, len(line))
+				for _, c := range line {
+					if !xdiffIsSpace(c) {
+						key = append(key, c)
+					}
+				}
+			}
+			class, ok := classes[string(key)]
+			if !ok {
+				class = len(classes)
+				classes[string(key)] = class
+				count[0] = append(count[0], 0)
+				count[1] = append(count[1], 0)
+			}
+			count[which][class]++
+			x.ha[i] = class
+		}
+		return x
+	}
+	x1, x2 := classify(linesA, 0), classify(linesB, 1)
+
+	// xdl_trim_ends
+	n := x1.nrec
+	if x2.nrec < n {
+		n = x2.nrec
+	}
+	start := 0
+	for start < n && x1.ha[start] == x2.ha[start] {
+		start++
+	}
+	end := 0
+	for end < n-start && x1.ha[x1.nrec-1-end] == x2.ha[x2.nrec-1-end] {
+		end++
+	}
+	x1.dstart, x2.dstart = start, start
+	x1.dend, x2.dend = x1.nrec-end-1, x2.nrec-end-1
+
+	// xdl_cleanup_records
+	x1.cleanup(count[1])
+	x2.cleanup(count[0])
+	return x1, x2
+}
+
+const (
+	xdlMaxEqLimit     = 1024
+	xdlSimScanWindow  = 100
+	xdlKeepDiscardRun = 4
+)
+
+// cleanup chooses the lines for the diff algorithm to consider, given the
+// number of times that each class occurs in the other file. Lines that
+// don't occur in the other file are changed. Lines that occur very often
+// are also discarded if they are mostly surrounded by discarded lines.
+func (x *xdfile) cleanup(otherCount []int) {
+	mlim := bogoSqrt(x.nrec)
+	if mlim > xdlMaxEqLimit {
+		mlim = xdlMaxEqLimit
+	}
+	dis := make([]byte, x.nrec+1)
+	for i := x.dstart; i <= x.dend; i++ {
+		switch nm := otherCount[x.ha[i]]; {
+		case nm == 0:
+			dis[i] = 0
+		case nm >= mlim:
+			dis[i] = 2
+		default:
+			dis[i] = 1
+		}
+	}
+	for i := x.dstart; i <= x.dend; i++ {
+		if dis[i] == 1 || (dis[i] == 2 && !cleanMultiMatch(dis, i, x.dstart, x.dend)) {
+			x.rindex = append(x.rindex, i)
+			x.rha = append(x.rha, x.ha[i])
+		} else {
+			x.setChanged(i, true)
+		}
+	}
+}
+
+// cleanMultiMatch reports whether the line i, which occurs many times in
+// the other file, should be discarded because the lines around it are
+// mostly discarded too (xdl_clean_mmatch).
+func cleanMultiMatch(dis []byte, i, s, e int) bool {
+	if i-s > xdlSimScanWindow {
+		s = i - xdlSimScanWindow
+	}
+	if e-i > xdlSimScanWindow {
+		e = i + xdlSimScanWindow
+	}
+	rdis0, rpdis0 := 0, 1
+	for r := 1; i-r >= s; r++ {
+		if dis[i-r] == 0 {
+			rdis0++
+		} else if dis[i-r] == 2 {
+			rpdis0++
+		} else {
+			break
+		}
+	}
+	if rdis0 == 0 {
+		return false
+	}
+	rdis1, rpdis1 := 0, 1
+	for r := 1; i+r <= e; r++ {
+		if dis[i+r] == 0 {
+			rdis1++
+		} else if dis[i+r] == 2 {
+			rpdis1++
+		} else {
+			break
+		}
+	}
+	if rdis1 == 0 {
+		return false
+	}
+	rdis1 += rdis0
+	rpdis1 += rpdis0
+	return rpdis1*xdlKeepDiscardRun < rpdis1+rdis1
+}
+
+// bogoSqrt approximates the square root of n as xdiff does.
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+	return i
+}
+
+const (
+	xdlMaxCostMin  = 256
+	xdlHeurMinCost = 256
+	xdlSnakeCnt    = 20
+	xdlKHeur       = 4
+	xdlLineMax     = int(^uint(0) >> 1)
+)
+
+// myersEnv holds the state of the diff algorithm.
+type myersEnv struct {
+	x1, x2     *xdfile
+	kvdf, kvdb []int
+	koff       int // the index in kvdf and kvdb of diagonal 0
+	mxcost     int
+}
+
+// compareRecords marks the changed lines of x and y, which must have been
+// prepared by prepareXDFiles (xdl_do_diff).
+func (x *xdfile) compareRecords(y *xdfile) {
+	ndiags := len(x.rindex) + len(y.rindex) + 3
+	e := &myersEnv{
+		x1:     x,
+		x2:     y,
+		kvdf:   make([]int, 2*ndiags+2),
+		kvdb:   make([]int, 2*ndiags+2),
+		koff:   len(y.rindex) + 1,
+		mxcost: bogoSqrt(ndiags),
+	}
+	if e.mxcost < xdlMaxCostMin {
+		e.mxcost = xdlMaxCostMin
+	}
+	e.recsCmp(0, len(x.rindex), 0, len(y.rindex), false)
+}
+
+// recsCmp recursively compares the considered lines [off1, lim1) of the
+// first file with [off2, lim2) of the second (xdl_recs_cmp).
+func (e *myersEnv) recsCmp(off1, lim1, off2, lim2 int, needMin bool) {
+	ha1, ha2 := e.x1.rha, e.x2.rha
+	for off1 < lim1 && off2 < lim2 && ha1[off1] == ha2[off2] {
+		off1++
+		off2++
+	}
+	for off1 < lim1 && off2 < lim2 && ha1[lim1-1] == ha2[lim2-1] {
+		lim1--
+		lim2--
+	}
+	switch {
+	case off1 == lim1:
+		for ; off2 < lim2; off2++ {
+			e.x2.setChanged(e.x2.rindex[off2], true)
+		}
+	case off2 == lim2:
+		for ; off1 < lim1; off1++ {
+			e.x1.setChanged(e.x1.rindex[off1], true)
+		}
+	default:
+		i1, i2, minLo, minHi := e.split(off1, lim1, off2, lim2, needMin)
+		e.recsCmp(off1, i1, off2, i2, minLo)
+		e.recsCmp(i1, lim1, i2, lim2, minHi)
+	}
+}
+
+// split finds the middle snake of the shortest edit script (or, for
+// expensive inputs, a good enough split point) of the given ranges
+// (xdl_split).
+func (e *myersEnv) split(off1, lim1, off2, lim2 int, needMin bool) (splitI1, splitI2 int, minLo, minHi bool) {
+	ha1, ha2 := e.x1.rha, e.x2.rha
+	kvdf := func(d int) *int { return &e.kvdf[d+e.koff] }
+	kvdb := func(d int) *int { return &e.kvdb[d+e.koff] }
+
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	*kvdf(fmid) = off1
+	*kvdb(bmid) = lim1
+
+	for ec := 1; ; ec++ {
+		gotSnake := false
+
+		// Extend the forward paths.
+		if fmin > dmin {
+			fmin--
+			*kvdf(fmin - 1) = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			*kvdf(fmax + 1) = -1
+		} else {
+			fmax--
+		}
+		for d := fmax; d >= fmin; d -= 2 {
+			var i1 int
+			if *kvdf(d - 1) >= *kvdf(d + 1) {
+				i1 = *kvdf(d - 1) + 1
+			} else {
+				i1 = *kvdf(d + 1)
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 < lim1 && i2 < lim2 && ha1[i1] == ha2[i2] {
+				i1++
+				i2++
+			}
+			if i1-prev1 > xdlSnakeCnt {
+				gotSnake = true
+			}
+			*kvdf(d) = i1
+			if odd && bmin <= d && d <= bmax && *kvdb(d) <= i1 {
+				return i1, i2, true, true
+			}
+		}
+
+		// Extend the backward paths.
+		if bmin > dmin {
+			bmin--
+			*kvdb(bmin - 1) = xdlLineMax
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			*kvdb(bmax + 1) = xdlLineMax
+		} else {
+			bmax--
+		}
+		for d := bmax; d >= bmin; d -= 2 {
+			var i1 int
+			if *kvdb(d - 1) < *kvdb(d + 1) {
+				i1 = *kvdb(d - 1)
+			} else {
+				i1 = *kvdb(d + 1) - 1
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 > off1 && i2 > off2 && ha1[i1-1] == ha2[i2-1] {
+				i1--
+				i2--
+			}
+			if prev1-i1 > xdlSnakeCnt {
+				gotSnake = true
+			}
+			*kvdb(d) = i1
+			if !odd && fmin <= d && d <= fmax && i1 <= *kvdf(d) {
+				return i1, i2, true, true
+			}
+		}
+
+		if needMin {
+			continue
+		}
+
+		// If the edit cost is getting high, settle for a split after (or
+		// before) a long snake that has made good progress.
+		if gotSnake && ec > xdlHeurMinCost {
+			best := 0
+			for d := fmax; d >= fmin; d -= 2 {
+				dd := d - fmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kvdf(d)
+				i2 := i1 - d
+				v := (i1 - off1) + (i2 - off2) - dd
+				if v > xdlKHeur*ec && v > best && off1+xdlSnakeCnt <= i1 && i1 < lim1 && off2+xdlSnakeCnt <= i2 && i2 < lim2 {
+					for k := 1; ha1[i1-k] == ha2[i2-k]; k++ {
+						if k == xdlSnakeCnt {
+							best = v
+							splitI1, splitI2 = i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return splitI1, splitI2, true, false
+			}
+
+			for d := bmax; d >= bmin; d -= 2 {
+				dd := d - bmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kvdb(d)
+				i2 := i1 - d
+				v := (lim1 - i1) + (lim2 - i2) - dd
+				if v > xdlKHeur*ec && v > best && off1 < i1 && i1 <= lim1-xdlSnakeCnt && off2 < i2 && i2 <= lim2-xdlSnakeCnt {
+					for k := 0; ha1[i1+k] == ha2[i2+k]; k++ {
+						if k == xdlSnakeCnt-1 {
+							best = v
+							splitI1, splitI2 = i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return splitI1, splitI2, false, true
+			}
+		}
+
+		// If it's too expensive, split at the furthest reaching path.
+		if ec >= e.mxcost {
+			fbest, fbest1 := -1, -1
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := *kvdf(d)
+				if i1 > lim1 {
+					i1 = lim1
+				}
+				i2 := i1 - d
+				if lim2 < i2 {
+					i1, i2 = lim2+d, lim2
+				}
+				if fbest < i1+i2 {
+					fbest, fbest1 = i1+i2, i1
+				}
+			}
+			bbest, bbest1 := xdlLineMax, xdlLineMax
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := *kvdb(d)
+				if i1 < off1 {
+					i1 = off1
+				}
+				i2 := i1 - d
+				if i2 < off2 {
+					i1, i2 = off2+d, off2
+				}
+				if i1+i2 < bbest {
+					bbest, bbest1 = i1+i2, i1
+				}
+			}
+			if (lim1+lim2)-bbest < fbest-(off1+off2) {
+				return fbest1, fbest - fbest1, true, false
+			}
+			return bbest1, bbest - bbest1, false, true
+		}
+	}
+}
+
+// An xdgroup is a (possibly empty) run of changed lines [start, end).
+type xdgroup struct{ start, end int }
+
+func (x *xdfile) firstGroup() xdgroup {
+	g := xdgroup{}
+	for x.changed(g.end) {
+		g.end++
+	}
+	return g
+}
+
+// nextGroup moves g to the next group, returning false if there is none.
+func (x *xdfile) nextGroup(g *xdgroup) bool {
+	if g.end == x.nrec {
+		return false
+	}
+	g.start = g.end + 1
+	for g.end = g.start; x.changed(g.end); g.end++ {
+	}
+	return true
+}
+
+// previousGroup moves g to the previous group, returning false if there
+// is none.
+func (x *xdfile) previousGroup(g *xdgroup) bool {
+	if g.start == 0 {
+		return false
+	}
+	g.end = g.start - 1
+	for g.start = g.end; x.changed(g.start - 1); g.start-- {
+	}
+	return true
+}
+
+// slideDown moves g down by one line, if the line after it is the same as
+// its first line, merging it with the group after it if they touch.
+func (x *xdfile) slideDown(g *xdgroup) bool {
+	if g.end < x.nrec && x.ha[g.start] == x.ha[g.end] {
+		x.setChanged(g.start, false)
+		x.setChanged(g.end, true)
+		g.start++
+		g.end++
+		for x.changed(g.end) {
+			g.end++
+		}
+		return true
+	}
+	return false
+}
+
+// slideUp is like slideDown, in the other direction.
+func (x *xdfile) slideUp(g *xdgroup) bool {
+	if g.start > 0 && x.ha[g.start-1] == x.ha[g.end-1] {
+		g.start--
+		g.end--
+		x.setChanged(g.start, true)
+		x.setChanged(g.end, false)
+		for x.changed(g.start - 1) {
+			g.start--
+		}
+		return true
+	}
+	return false
+}
+
+// compact slides each group of changed lines of x, which was compared with
+// o, as far down as possible, unless it can be aligned with a group of
+// changes in o or the indent heuristic finds a better place for it
+// (xdl_change_compact).
+func (x *xdfile) compact(o *xdfile) {
+	g, go_ := x.firstGroup(), o.firstGroup()
+	for {
+		if g.end != g.start {
+			var groupSize, earliestEnd, endMatchingOther int
+			for {
+				groupSize = g.end - g.start
+				endMatchingOther = -1
+
+				for x.slideUp(&g) {
+					o.previousGroup(&go_)
+				}
+				earliestEnd = g.end
+				if go_.end > go_.start {
+					endMatchingOther = g.end
+				}
+
+				for x.slideDown(&g) {
+					o.nextGroup(&go_)
+					if go_.end > go_.start {
+						endMatchingOther = g.end
+					}
+				}
+				if groupSize == g.end-g.start {
+					break
+				}
+			}
+
+			switch {
+			case g.end == earliestEnd:
+				// No shifting was possible.
+			case endMatchingOther != -1:
+				// Line the group up with the last group of changes in o
+				// that it can be aligned with.
+				for go_.end == go_.start {
+					x.slideUp(&g)
+					o.previousGroup(&go_)
+				}
+			default:
+				// Use the indent heuristic to choose where to put the
+				// group.
+				shift := earliestEnd
+				if g.end-groupSize-1 > shift {
+					shift = g.end - groupSize - 1
+				}
+				if g.end-indentHeuristicMaxSliding > shift {
+					shift = g.end - indentHeuristicMaxSliding
+				}
+				bestShift := -1
+				var bestScore splitScore
+				for ; shift <= g.end; shift++ {
+					var score splitScore
+					score.add(x.measureSplit(shift))
+					score.add(x.measureSplit(shift - groupSize))
+					if bestShift == -1 || score.cmp(bestScore) <= 0 {
+						bestScore = score
+						bestShift = shift
+					}
+				}
+				for g.end > bestShift {
+					x.slideUp(&g)
+					o.previousGroup(&go_)
+				}
+			}
+		}
+
+		if !x.nextGroup(&g) {
+			break
+		}
+		o.nextGroup(&go_)
+	}
+}
+
+// The indent heuristic scores the possible positions of a group of changed
+// lines by the indentation and blank lines around its ends. See git's
+// xdiff/xdiffi.c for how the weights were chosen.
+const (
+	maxIndent = 200
+	maxBlanks = 20
+
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+
+	indentHeuristicMaxSliding = 100
+)
+
+// splitMeasurement describes the lines around a split between lines.
+type splitMeasurement struct {
+	endOfFile  bool
+	indent     int // of the line after the split, or -1 if it's blank
+	preBlank   int // blank lines before the split
+	preIndent  int // of the nearest non-blank line before, or -1
+	postBlank  int // blank lines after the line after the split
+	postIndent int // of the nearest non-blank line after that, or -1
+}
+
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+// lineIndent returns the indentation of a line, or -1 if it is blank.
+func lineIndent(line []byte) int {
+	ret := 0
+	for _, c := range line {
+		if !xdiffIsSpace(c) {
+			return ret
+		} else if c == ' ' {
+			ret++
+		} else if c == '\t' {
+			ret += 8 - ret%8
+		}
+		if ret >= maxIndent {
+			return maxIndent
+		}
+	}
+	return -1
+}
+
+func (x *xdfile) measureSplit(split int) splitMeasurement {
+	var m splitMeasurement
+	if split >= x.nrec {
+		m.endOfFile = true
+		m.indent = -1
+	} else {
+		m.indent = lineIndent(x.recs[split])
+	}
+
+	m.preIndent = -1
+	for i := split - 1; i >= 0; i-- {
+		if m.preIndent = lineIndent(x.recs[i]); m.preIndent != -1 {
+			break
+		}
+		m.preBlank++
+		if m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+
+	m.postIndent = -1
+	for i := split + 1; i < x.nrec; i++ {
+		if m.postIndent = lineIndent(x.recs[i]); m.postIndent != -1 {
+			break
+		}
+		m.postBlank++
+		if m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+	return m
+}
+
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+	s.penalty += totalBlankWeight * totalBlank
+	s.penalty += postBlankWeight * postBlank
+
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+	anyBlanks := totalBlank != 0
+	s.effectiveIndent += indent
+
+	switch {
+	case indent == -1, m.preIndent == -1, indent == m.preIndent:
+	case indent > m.preIndent:
+		if anyBlanks {
+			s.penalty += relativeIndentWithBlankPenalty
+		} else {
+			s.penalty += relativeIndentPenalty
+		}
+	case m.postIndent != -1 && m.postIndent > indent:
+		if anyBlanks {
+			s.penalty += relativeOutdentWithBlankPenalty
+		} else {
+			s.penalty += relativeOutdentPenalty
+		}
+	default:
+		if anyBlanks {
+			s.penalty += relativeDedentWithBlankPenalty
+		} else {
+			s.penalty += relativeDedentPenalty
+		}
+	}
+}
+
+// cmp returns a negative number if s is a better split than t.
+func (s splitScore) cmp(t splitScore) int {
+	cmpIndents := 0
+	if s.effectiveIndent > t.effectiveIndent {
+		cmpIndents = 1
+	} else if s.effectiveIndent < t.effectiveIndent {
+		cmpIndents = -1
+	}
+	return indentWeight*cmpIndents + (s.penalty - t.penalty)
+}
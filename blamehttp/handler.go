@@ -0,0 +1,293 @@
+// Package blamehttp serves blame results for repositories over HTTP, as
+// JSON.
+//
+// A Handler serves these endpoints, which take GET requests:
+//
+//	/file?repo=R&path=P[&rev=V]                 the blame of a file
+//	/range?repo=R&path=P&start=S&end=E[&rev=V]  the blame of lines [S, E) of a file
+//	/repo?repo=R[&rev=V][&ignore=PATTERN...]    the blame of all files in a repository
+//	/authorship?repo=R[&rev=V][&path=P...]      authorship summaries of files and directories
+//
+// Repositories are named by a root (see blameroots.Roots) and the path
+// of the repository in it, as in "myroot/team/project". rev defaults to
+// HEAD for git and tip for hg. The blame options can be set with
+// no_ignore_whitespace=1, hg_ignore_whitespace=1, skip_generated=1 and
+// skip_vendored=1.
+//
+// /file and /range respond with {"Hunks": [...], "Commits": {...}}, /repo
+// with {"Files": {path: [hunk, ...]}, "Commits": {...}}, and /authorship
+// with {path: authorship}, using the blame package's Hunk, Commit and
+// Authorship types. Errors are responded to with {"Error": "message"}
+// and a status code that says what went wrong (e.g., 404 for
+// blame.ErrFileNotFound).
+package blamehttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/go-blame/blame"
+	"github.com/sourcegraph/go-blame/blameroots"
+)
+
+// A Handler serves blame results for the repositories in its roots.
+type Handler struct {
+	// Roots are the directories of the repositories that can be blamed.
+	Roots blameroots.Roots
+
+	// Timeout, if nonzero, is the longest that a request may take.
+	// Blaming stops when it's reached.
+	Timeout time.Duration
+
+	// MaxConcurrent, if nonzero, is the maximum number of requests that
+	// are served at once. Others wait for their turn, until they time
+	// out.
+	MaxConcurrent int
+
+	semOnce sync.Once
+	sem     chan struct{}
+}
+
+// errorResponse is the body of error responses.
+type errorResponse struct {
+	Error string
+}
+
+// A badRequest error is responded to with status 400.
+type badRequest string
+
+func (e badRequest) Error() string { return string(e) }
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{"method not allowed"})
+		return
+	}
+	var serve func(context.Context, *request) (interface{}, error)
+	switch r.URL.Path {
+	case "/file":
+		serve = serveFile
+	case "/range":
+		serve = serveRange
+	case "/repo":
+		serve = serveRepo
+	case "/authorship":
+		serve = serveAuthorship
+	default:
+		writeJSON(w, http.StatusNotFound, errorResponse{"not found"})
+		return
+	}
+
+	ctx := r.Context()
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+	if h.MaxConcurrent > 0 {
+		h.semOnce.Do(func() { h.sem = make(chan struct{}, h.MaxConcurrent) })
+		select {
+		case h.sem <- struct{}{}:
+			defer func() { <-h.sem }()
+		case <-ctx.Done():
+			writeJSON(w, http.StatusServiceUnavailable, errorResponse{"too many concurrent requests"})
+			return
+		}
+	}
+
+	req, err := h.parseRequest(r)
+	if err == nil {
+		var resp interface{}
+		if resp, err = serve(ctx, req); err == nil {
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+	}
+	writeJSON(w, errorStatus(ctx, err), errorResponse{err.Error()})
+}
+
+// errorStatus returns the status code of the response to a request that
+// failed with err.
+func errorStatus(ctx context.Context, err error) int {
+	var bad badRequest
+	var badName blameroots.BadNameError
+	switch {
+	case errors.As(err, &bad), errors.As(err, &badName):
+		return http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, blame.ErrNotRepository), errors.Is(err, blame.ErrRevisionNotFound), errors.Is(err, blame.ErrFileNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, blame.ErrBinaryFile):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// A request holds the parameters of a request.
+type request struct {
+	repoPath    string // the repository's directory
+	backend     blame.Backend
+	backendName string
+	rev         string
+	opt         blame.BlameOptions
+	query       map[string][]string
+}
+
+func (h *Handler) parseRequest(r *http.Request) (*request, error) {
+	q := r.URL.Query()
+	repoPath, err := h.Roots.Repo(q.Get("repo"))
+	if err != nil {
+		return nil, err
+	}
+	req := &request{repoPath: repoPath, rev: q.Get("rev"), query: q}
+	req.backendName, req.backend = blame.DetectBackend(repoPath)
+	if req.rev == "" {
+		req.rev = "HEAD"
+		if req.backendName == "hg" {
+			req.rev = "tip"
+		}
+	}
+	if strings.HasPrefix(req.rev, "-") {
+		// It would be taken for a git or hg option.
+		return nil, badRequest(fmt.Sprintf("bad revision %q", req.rev))
+	}
+	for param, opt := range map[string]*bool{
+		"no_ignore_whitespace": &req.opt.NoIgnoreWhitespace,
+		"hg_ignore_whitespace": &req.opt.HgIgnoreWhitespace,
+		"skip_generated":       &req.opt.SkipGenerated,
+		"skip_vendored":        &req.opt.SkipVendored,
+	} {
+		if s := q.Get(param); s != "" {
+			if *opt, err = strconv.ParseBool(s); err != nil {
+				return nil, badRequest(fmt.Sprintf("bad %s %q", param, s))
+			}
+		}
+	}
+	return req, nil
+}
+
+// filePath returns the path parameter, which names a file in the
+// repository.
+func (req *request) filePath() (string, error) {
+	p := req.query["path"]
+	if len(p) != 1 || p[0] == "" {
+		return "", badRequest("want one path")
+	}
+	return blameroots.CleanPath(p[0])
+}
+
+func (req *request) intParam(name string) (int, error) {
+	s := req.query[name]
+	if len(s) != 1 {
+		return 0, badRequest("missing " + name)
+	}
+	n, err := strconv.Atoi(s[0])
+	if err != nil {
+		return 0, badRequest(fmt.Sprintf("bad %s %q", name, s[0]))
+	}
+	return n, nil
+}
+
+// fileResponse is the response to /file and /range.
+type fileResponse struct {
+	Hunks   []blame.Hunk
+	Commits map[string]blame.Commit
+}
+
+func serveFile(ctx context.Context, req *request) (interface{}, error) {
+	p, err := req.filePath()
+	if err != nil {
+		return nil, err
+	}
+	hunks, commits, err := req.backend.BlameFile(ctx, req.repoPath, p, req.rev, &req.opt)
+	if err != nil {
+		return nil, err
+	}
+	return fileResponse{hunks, commits}, nil
+}
+
+func serveRange(ctx context.Context, req *request) (interface{}, error) {
+	p, err := req.filePath()
+	if err != nil {
+		return nil, err
+	}
+	start, err := req.intParam("start")
+	if err != nil {
+		return nil, err
+	}
+	end, err := req.intParam("end")
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 || end <= start {
+		return nil, badRequest(fmt.Sprintf("bad line range [%d, %d)", start, end))
+	}
+	rb, ok := req.backend.(blame.RangeBackend)
+	if !ok {
+		return nil, badRequest("the repository's backend can't blame line ranges")
+	}
+	hunks, commits, err := rb.BlameFileRange(ctx, req.repoPath, p, req.rev, start, end, &req.opt)
+	if err != nil {
+		return nil, err
+	}
+	return fileResponse{hunks, commits}, nil
+}
+
+// repoResponse is the response to /repo.
+type repoResponse struct {
+	Files   map[string][]blame.Hunk
+	Commits map[string]blame.Commit
+}
+
+func serveRepo(ctx context.Context, req *request) (interface{}, error) {
+	hunks, commits, err := req.backend.BlameRepository(ctx, req.repoPath, req.rev, req.query["ignore"], &req.opt)
+	if err != nil {
+		return nil, err
+	}
+	return repoResponse{hunks, commits}, nil
+}
+
+func serveAuthorship(ctx context.Context, req *request) (interface{}, error) {
+	paths := req.query["path"]
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	for i, p := range paths {
+		var err error
+		if paths[i], err = blameroots.CleanPath(p); err != nil {
+			return nil, err
+		}
+	}
+	hunks, commits, err := req.backend.BlameRepository(ctx, req.repoPath, req.rev, req.query["ignore"], &req.opt)
+	if err != nil {
+		return nil, err
+	}
+	for file, fileHunks := range hunks {
+		hunks[file] = blame.NormalizeHunks(req.backendName, fileHunks)
+	}
+	summaries := blame.RepositoryAuthorship(hunks, commits)
+	resp := make(map[string]*blame.Authorship, len(paths))
+	for _, p := range paths {
+		s, ok := summaries[p]
+		if !ok {
+			return nil, fmt.Errorf("%w: no blamed files in %s", blame.ErrFileNotFound, p)
+		}
+		resp[p] = s
+	}
+	return resp, nil
+}
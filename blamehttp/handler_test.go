@@ -0,0 +1,134 @@
+package blamehttp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRoot creates a root directory with a git repository, "repo", with
+// one commit, and a symlink, "escape", to a directory outside of it.
+func testRoot(t *testing.T) string {
+	root := t.TempDir()
+	dir := filepath.Join(root, "repo")
+	for name, data := range map[string]string{"a.txt": "a\nb\nc\n", "d/c.go": "package c\n", "bin": "\x00"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{{"init", "-q"}, {"add", "-A"}, {"commit", "-q", "-m", "Add files"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com", "GIT_AUTHOR_DATE=2014-01-02T00:00:00Z",
+			"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com", "GIT_COMMITTER_DATE=2014-01-02T00:00:00Z")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s: %s", args, err, out)
+		}
+	}
+	if err := os.Symlink(filepath.Dir(root), filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestHandler(t *testing.T) {
+	h := &Handler{Roots: map[string]string{"r": testRoot(t)}, Timeout: time.Minute, MaxConcurrent: 2}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	tests := []struct {
+		url      string
+		status   int
+		contains []string
+	}{
+		{url: "/file?repo=r/repo&path=a.txt", status: 200, contains: []string{`"Hunks":[{`, `"LineStart":0,"LineEnd":3`, `"Summary":"Add files"`}},
+		{url: "/range?repo=r/repo&path=a.txt&start=1&end=2", status: 200, contains: []string{`"LineStart":1,"LineEnd":2`}},
+		{url: "/repo?repo=r/repo&ignore=*.go", status: 200, contains: []string{`"Files":{"a.txt":[{`}},
+		{url: "/authorship?repo=r/repo&path=.&path=d", status: 200, contains: []string{`".":{"Lines":4,`, `"d":{"Lines":1,`, `"Name":"Jane Doe"`}},
+
+		{url: "/file?repo=r/repo", status: 400},
+		{url: "/file?path=a.txt", status: 400},
+		{url: "/file?repo=r/repo&path=../repo/a.txt", status: 400},
+		{url: "/file?repo=r/repo&path=/etc/passwd", status: 400},
+		{url: "/file?repo=r/repo&path=a.txt&rev=--output=x", status: 400},
+		{url: "/file?repo=r/repo&path=a.txt&no_ignore_whitespace=x", status: 400},
+		{url: "/range?repo=r/repo&path=a.txt&start=2&end=1", status: 400},
+		{url: "/file?repo=r/../r/repo&path=a.txt", status: 400},
+		{url: "/file?repo=r/repo/../..&path=a.txt", status: 400},
+		{url: "/file?repo=r/escape&path=a.txt", status: 404},
+		{url: "/file?repo=x/repo&path=a.txt", status: 404},
+		{url: "/file?repo=r/nonexistent&path=a.txt", status: 404},
+		{url: "/file?repo=r/repo&path=a.txt&rev=nonexistent", status: 404},
+		{url: "/file?repo=r/repo&path=nonexistent", status: 404},
+		{url: "/authorship?repo=r/repo&path=nonexistent", status: 404},
+		{url: "/file?repo=r/repo&path=bin", status: 422},
+		{url: "/unknown", status: 404},
+	}
+	for _, test := range tests {
+		resp, err := http.Get(srv.URL + test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: got status %d, want %d (body: %s)", test.url, resp.StatusCode, test.status, body)
+			continue
+		}
+		if test.status != 200 {
+			var e errorResponse
+			if err := json.Unmarshal(body, &e); err != nil || e.Error == "" {
+				t.Errorf("%s: got error body %s, want {\"Error\": ...}", test.url, body)
+			}
+		}
+		for _, s := range test.contains {
+			if !strings.Contains(string(body), s) {
+				t.Errorf("%s: body doesn't contain %q:\n%s", test.url, s, body)
+			}
+		}
+	}
+
+	resp, err := http.PostForm(srv.URL+"/file", url.Values{"repo": {"r/repo"}, "path": {"a.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got status %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHandler_limits(t *testing.T) {
+	h := &Handler{Roots: map[string]string{"r": testRoot(t)}, Timeout: 50 * time.Millisecond, MaxConcurrent: 1}
+
+	// Take the only slot, so requests time out waiting for it.
+	h.semOnce.Do(func() { h.sem = make(chan struct{}, h.MaxConcurrent) })
+	h.sem <- struct{}{}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/file?repo=r/repo&path=a.txt", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	<-h.sem
+
+	h.Timeout = time.Nanosecond
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/repo?repo=r/repo", nil))
+	if w.Code != http.StatusGatewayTimeout && w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+}
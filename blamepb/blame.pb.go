@@ -0,0 +1,857 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: blame.proto
+
+// The blame package's result types, and a service that blames files and
+// repositories. The Go code is generated (see gen.go).
+
+package blamepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// A Hunk is a range of lines (and characters) of a file that were last
+// changed by a commit. Lines and characters are numbered from 0; the end
+// is exclusive.
+type Hunk struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	CommitId  string                 `protobuf:"bytes,1,opt,name=commit_id,json=commitId,proto3" json:"commit_id,omitempty"`
+	LineStart int64                  `protobuf:"varint,2,opt,name=line_start,json=lineStart,proto3" json:"line_start,omitempty"`
+	LineEnd   int64                  `protobuf:"varint,3,opt,name=line_end,json=lineEnd,proto3" json:"line_end,omitempty"`
+	CharStart int64                  `protobuf:"varint,4,opt,name=char_start,json=charStart,proto3" json:"char_start,omitempty"`
+	CharEnd   int64                  `protobuf:"varint,5,opt,name=char_end,json=charEnd,proto3" json:"char_end,omitempty"`
+	// ignored is true if the hunk was attributed to commit_id by looking
+	// past a commit that the options said to ignore.
+	Ignored       bool `protobuf:"varint,6,opt,name=ignored,proto3" json:"ignored,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Hunk) Reset() {
+	*x = Hunk{}
+	mi := &file_blame_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Hunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Hunk) ProtoMessage() {}
+
+func (x *Hunk) ProtoReflect() protoreflect.Message {
+	mi := &file_blame_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Hunk.ProtoReflect.Descriptor instead.
+func (*Hunk) Descriptor() ([]byte, []int) {
+	return file_blame_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Hunk) GetCommitId() string {
+	if x != nil {
+		return x.CommitId
+	}
+	return ""
+}
+
+func (x *Hunk) GetLineStart() int64 {
+	if x != nil {
+		return x.LineStart
+	}
+	return 0
+}
+
+func (x *Hunk) GetLineEnd() int64 {
+	if x != nil {
+		return x.LineEnd
+	}
+	return 0
+}
+
+func (x *Hunk) GetCharStart() int64 {
+	if x != nil {
+		return x.CharStart
+	}
+	return 0
+}
+
+func (x *Hunk) GetCharEnd() int64 {
+	if x != nil {
+		return x.CharEnd
+	}
+	return 0
+}
+
+func (x *Hunk) GetIgnored() bool {
+	if x != nil {
+		return x.Ignored
+	}
+	return false
+}
+
+type Commit struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Id        string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Author    *Author                `protobuf:"bytes,2,opt,name=author,proto3" json:"author,omitempty"`
+	Committer *Author                `protobuf:"bytes,3,opt,name=committer,proto3" json:"committer,omitempty"`
+	// message is the full commit message, and summary is its first line.
+	Message string `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	Summary string `protobuf:"bytes,5,opt,name=summary,proto3" json:"summary,omitempty"`
+	// The dates, and the offsets of the author's and committer's time
+	// zones from UTC, in seconds.
+	AuthorDate          *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=author_date,json=authorDate,proto3" json:"author_date,omitempty"`
+	AuthorDateOffset    int32                  `protobuf:"varint,7,opt,name=author_date_offset,json=authorDateOffset,proto3" json:"author_date_offset,omitempty"`
+	CommitterDate       *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=committer_date,json=committerDate,proto3" json:"committer_date,omitempty"`
+	CommitterDateOffset int32                  `protobuf:"varint,9,opt,name=committer_date_offset,json=committerDateOffset,proto3" json:"committer_date_offset,omitempty"`
+	// parents are the IDs of the commit's parent commits.
+	Parents       []string `protobuf:"bytes,10,rep,name=parents,proto3" json:"parents,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Commit) Reset() {
+	*x = Commit{}
+	mi := &file_blame_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Commit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Commit) ProtoMessage() {}
+
+func (x *Commit) ProtoReflect() protoreflect.Message {
+	mi := &file_blame_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Commit.ProtoReflect.Descriptor instead.
+func (*Commit) Descriptor() ([]byte, []int) {
+	return file_blame_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Commit) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Commit) GetAuthor() *Author {
+	if x != nil {
+		return x.Author
+	}
+	return nil
+}
+
+func (x *Commit) GetCommitter() *Author {
+	if x != nil {
+		return x.Committer
+	}
+	return nil
+}
+
+func (x *Commit) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Commit) GetSummary() string {
+	if x != nil {
+		return x.Summary
+	}
+	return ""
+}
+
+func (x *Commit) GetAuthorDate() *timestamppb.Timestamp {
+	if x != nil {
+		return x.AuthorDate
+	}
+	return nil
+}
+
+func (x *Commit) GetAuthorDateOffset() int32 {
+	if x != nil {
+		return x.AuthorDateOffset
+	}
+	return 0
+}
+
+func (x *Commit) GetCommitterDate() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CommitterDate
+	}
+	return nil
+}
+
+func (x *Commit) GetCommitterDateOffset() int32 {
+	if x != nil {
+		return x.CommitterDateOffset
+	}
+	return 0
+}
+
+func (x *Commit) GetParents() []string {
+	if x != nil {
+		return x.Parents
+	}
+	return nil
+}
+
+type Author struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Email         string                 `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Author) Reset() {
+	*x = Author{}
+	mi := &file_blame_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Author) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Author) ProtoMessage() {}
+
+func (x *Author) ProtoReflect() protoreflect.Message {
+	mi := &file_blame_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Author.ProtoReflect.Descriptor instead.
+func (*Author) Descriptor() ([]byte, []int) {
+	return file_blame_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Author) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Author) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+// BlameOptions controls how lines are attributed to commits, like the
+// blame package's BlameOptions.
+type BlameOptions struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	NoIgnoreWhitespace bool                   `protobuf:"varint,1,opt,name=no_ignore_whitespace,json=noIgnoreWhitespace,proto3" json:"no_ignore_whitespace,omitempty"`
+	DetectMoves        bool                   `protobuf:"varint,2,opt,name=detect_moves,json=detectMoves,proto3" json:"detect_moves,omitempty"`
+	MoveScore          int32                  `protobuf:"varint,3,opt,name=move_score,json=moveScore,proto3" json:"move_score,omitempty"`
+	DetectCopies       int32                  `protobuf:"varint,4,opt,name=detect_copies,json=detectCopies,proto3" json:"detect_copies,omitempty"`
+	CopyScore          int32                  `protobuf:"varint,5,opt,name=copy_score,json=copyScore,proto3" json:"copy_score,omitempty"`
+	IgnoreRevs         []string               `protobuf:"bytes,6,rep,name=ignore_revs,json=ignoreRevs,proto3" json:"ignore_revs,omitempty"`
+	IgnoreRevsFile     string                 `protobuf:"bytes,7,opt,name=ignore_revs_file,json=ignoreRevsFile,proto3" json:"ignore_revs_file,omitempty"`
+	ReadIgnoreRevsFile bool                   `protobuf:"varint,8,opt,name=read_ignore_revs_file,json=readIgnoreRevsFile,proto3" json:"read_ignore_revs_file,omitempty"`
+	SkipGenerated      bool                   `protobuf:"varint,9,opt,name=skip_generated,json=skipGenerated,proto3" json:"skip_generated,omitempty"`
+	SkipVendored       bool                   `protobuf:"varint,10,opt,name=skip_vendored,json=skipVendored,proto3" json:"skip_vendored,omitempty"`
+	HgIgnoreWhitespace bool                   `protobuf:"varint,11,opt,name=hg_ignore_whitespace,json=hgIgnoreWhitespace,proto3" json:"hg_ignore_whitespace,omitempty"`
+	// max_failed_files is the number of files that BlameRepository sends
+	// errors for before it fails (any number, if it's negative).
+	MaxFailedFiles int32 `protobuf:"varint,12,opt,name=max_failed_files,json=maxFailedFiles,proto3" json:"max_failed_files,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *BlameOptions) Reset() {
+	*x = BlameOptions{}
+	mi := &file_blame_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlameOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlameOptions) ProtoMessage() {}
+
+func (x *BlameOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_blame_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlameOptions.ProtoReflect.Descriptor instead.
+func (*BlameOptions) Descriptor() ([]byte, []int) {
+	return file_blame_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BlameOptions) GetNoIgnoreWhitespace() bool {
+	if x != nil {
+		return x.NoIgnoreWhitespace
+	}
+	return false
+}
+
+func (x *BlameOptions) GetDetectMoves() bool {
+	if x != nil {
+		return x.DetectMoves
+	}
+	return false
+}
+
+func (x *BlameOptions) GetMoveScore() int32 {
+	if x != nil {
+		return x.MoveScore
+	}
+	return 0
+}
+
+func (x *BlameOptions) GetDetectCopies() int32 {
+	if x != nil {
+		return x.DetectCopies
+	}
+	return 0
+}
+
+func (x *BlameOptions) GetCopyScore() int32 {
+	if x != nil {
+		return x.CopyScore
+	}
+	return 0
+}
+
+func (x *BlameOptions) GetIgnoreRevs() []string {
+	if x != nil {
+		return x.IgnoreRevs
+	}
+	return nil
+}
+
+func (x *BlameOptions) GetIgnoreRevsFile() string {
+	if x != nil {
+		return x.IgnoreRevsFile
+	}
+	return ""
+}
+
+func (x *BlameOptions) GetReadIgnoreRevsFile() bool {
+	if x != nil {
+		return x.ReadIgnoreRevsFile
+	}
+	return false
+}
+
+func (x *BlameOptions) GetSkipGenerated() bool {
+	if x != nil {
+		return x.SkipGenerated
+	}
+	return false
+}
+
+func (x *BlameOptions) GetSkipVendored() bool {
+	if x != nil {
+		return x.SkipVendored
+	}
+	return false
+}
+
+func (x *BlameOptions) GetHgIgnoreWhitespace() bool {
+	if x != nil {
+		return x.HgIgnoreWhitespace
+	}
+	return false
+}
+
+func (x *BlameOptions) GetMaxFailedFiles() int32 {
+	if x != nil {
+		return x.MaxFailedFiles
+	}
+	return 0
+}
+
+type BlameFileRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// repo names the repository, as "<root>/<path in root>".
+	Repo string `protobuf:"bytes,1,opt,name=repo,proto3" json:"repo,omitempty"`
+	Path string `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	// rev is the revision to blame, by default HEAD (git) or tip (hg).
+	Rev string `protobuf:"bytes,3,opt,name=rev,proto3" json:"rev,omitempty"`
+	// If end_line is nonzero, only lines [start_line, end_line) are blamed.
+	StartLine     int64         `protobuf:"varint,4,opt,name=start_line,json=startLine,proto3" json:"start_line,omitempty"`
+	EndLine       int64         `protobuf:"varint,5,opt,name=end_line,json=endLine,proto3" json:"end_line,omitempty"`
+	Options       *BlameOptions `protobuf:"bytes,6,opt,name=options,proto3" json:"options,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BlameFileRequest) Reset() {
+	*x = BlameFileRequest{}
+	mi := &file_blame_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlameFileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlameFileRequest) ProtoMessage() {}
+
+func (x *BlameFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blame_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlameFileRequest.ProtoReflect.Descriptor instead.
+func (*BlameFileRequest) Descriptor() ([]byte, []int) {
+	return file_blame_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BlameFileRequest) GetRepo() string {
+	if x != nil {
+		return x.Repo
+	}
+	return ""
+}
+
+func (x *BlameFileRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *BlameFileRequest) GetRev() string {
+	if x != nil {
+		return x.Rev
+	}
+	return ""
+}
+
+func (x *BlameFileRequest) GetStartLine() int64 {
+	if x != nil {
+		return x.StartLine
+	}
+	return 0
+}
+
+func (x *BlameFileRequest) GetEndLine() int64 {
+	if x != nil {
+		return x.EndLine
+	}
+	return 0
+}
+
+func (x *BlameFileRequest) GetOptions() *BlameOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type BlameFileResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Hunks []*Hunk                `protobuf:"bytes,1,rep,name=hunks,proto3" json:"hunks,omitempty"`
+	// commits are the commits of the hunks, by ID.
+	Commits       map[string]*Commit `protobuf:"bytes,2,rep,name=commits,proto3" json:"commits,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BlameFileResponse) Reset() {
+	*x = BlameFileResponse{}
+	mi := &file_blame_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlameFileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlameFileResponse) ProtoMessage() {}
+
+func (x *BlameFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blame_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlameFileResponse.ProtoReflect.Descriptor instead.
+func (*BlameFileResponse) Descriptor() ([]byte, []int) {
+	return file_blame_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BlameFileResponse) GetHunks() []*Hunk {
+	if x != nil {
+		return x.Hunks
+	}
+	return nil
+}
+
+func (x *BlameFileResponse) GetCommits() map[string]*Commit {
+	if x != nil {
+		return x.Commits
+	}
+	return nil
+}
+
+type BlameRepositoryRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Repo  string                 `protobuf:"bytes,1,opt,name=repo,proto3" json:"repo,omitempty"`
+	Rev   string                 `protobuf:"bytes,2,opt,name=rev,proto3" json:"rev,omitempty"`
+	// ignore_patterns are the patterns of files not to blame, in
+	// .gitignore syntax.
+	IgnorePatterns []string      `protobuf:"bytes,3,rep,name=ignore_patterns,json=ignorePatterns,proto3" json:"ignore_patterns,omitempty"`
+	Options        *BlameOptions `protobuf:"bytes,4,opt,name=options,proto3" json:"options,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *BlameRepositoryRequest) Reset() {
+	*x = BlameRepositoryRequest{}
+	mi := &file_blame_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlameRepositoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlameRepositoryRequest) ProtoMessage() {}
+
+func (x *BlameRepositoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blame_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlameRepositoryRequest.ProtoReflect.Descriptor instead.
+func (*BlameRepositoryRequest) Descriptor() ([]byte, []int) {
+	return file_blame_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BlameRepositoryRequest) GetRepo() string {
+	if x != nil {
+		return x.Repo
+	}
+	return ""
+}
+
+func (x *BlameRepositoryRequest) GetRev() string {
+	if x != nil {
+		return x.Rev
+	}
+	return ""
+}
+
+func (x *BlameRepositoryRequest) GetIgnorePatterns() []string {
+	if x != nil {
+		return x.IgnorePatterns
+	}
+	return nil
+}
+
+func (x *BlameRepositoryRequest) GetOptions() *BlameOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+// A BlameRepositoryResponse is the blame of one file.
+type BlameRepositoryResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Path  string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Hunks []*Hunk                `protobuf:"bytes,2,rep,name=hunks,proto3" json:"hunks,omitempty"`
+	// commits are the commits of the hunks that weren't sent in earlier
+	// messages, by ID.
+	Commits map[string]*Commit `protobuf:"bytes,3,rep,name=commits,proto3" json:"commits,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// error is set, instead of the hunks, if the file couldn't be blamed.
+	Error         string `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BlameRepositoryResponse) Reset() {
+	*x = BlameRepositoryResponse{}
+	mi := &file_blame_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlameRepositoryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlameRepositoryResponse) ProtoMessage() {}
+
+func (x *BlameRepositoryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blame_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlameRepositoryResponse.ProtoReflect.Descriptor instead.
+func (*BlameRepositoryResponse) Descriptor() ([]byte, []int) {
+	return file_blame_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *BlameRepositoryResponse) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *BlameRepositoryResponse) GetHunks() []*Hunk {
+	if x != nil {
+		return x.Hunks
+	}
+	return nil
+}
+
+func (x *BlameRepositoryResponse) GetCommits() map[string]*Commit {
+	if x != nil {
+		return x.Commits
+	}
+	return nil
+}
+
+func (x *BlameRepositoryResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_blame_proto protoreflect.FileDescriptor
+
+const file_blame_proto_rawDesc = "" +
+	"\n" +
+	"\vblame.proto\x12\agoblame\x1a\x1fgoogle/protobuf/timestamp.proto\"\xb1\x01\n" +
+	"\x04Hunk\x12\x1b\n" +
+	"\tcommit_id\x18\x01 \x01(\tR\bcommitId\x12\x1d\n" +
+	"\n" +
+	"line_start\x18\x02 \x01(\x03R\tlineStart\x12\x19\n" +
+	"\bline_end\x18\x03 \x01(\x03R\alineEnd\x12\x1d\n" +
+	"\n" +
+	"char_start\x18\x04 \x01(\x03R\tcharStart\x12\x19\n" +
+	"\bchar_end\x18\x05 \x01(\x03R\acharEnd\x12\x18\n" +
+	"\aignored\x18\x06 \x01(\bR\aignored\"\xa0\x03\n" +
+	"\x06Commit\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12'\n" +
+	"\x06author\x18\x02 \x01(\v2\x0f.goblame.AuthorR\x06author\x12-\n" +
+	"\tcommitter\x18\x03 \x01(\v2\x0f.goblame.AuthorR\tcommitter\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\x12\x18\n" +
+	"\asummary\x18\x05 \x01(\tR\asummary\x12;\n" +
+	"\vauthor_date\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"authorDate\x12,\n" +
+	"\x12author_date_offset\x18\a \x01(\x05R\x10authorDateOffset\x12A\n" +
+	"\x0ecommitter_date\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\rcommitterDate\x122\n" +
+	"\x15committer_date_offset\x18\t \x01(\x05R\x13committerDateOffset\x12\x18\n" +
+	"\aparents\x18\n" +
+	" \x03(\tR\aparents\"2\n" +
+	"\x06Author\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05email\x18\x02 \x01(\tR\x05email\"\xec\x03\n" +
+	"\fBlameOptions\x120\n" +
+	"\x14no_ignore_whitespace\x18\x01 \x01(\bR\x12noIgnoreWhitespace\x12!\n" +
+	"\fdetect_moves\x18\x02 \x01(\bR\vdetectMoves\x12\x1d\n" +
+	"\n" +
+	"move_score\x18\x03 \x01(\x05R\tmoveScore\x12#\n" +
+	"\rdetect_copies\x18\x04 \x01(\x05R\fdetectCopies\x12\x1d\n" +
+	"\n" +
+	"copy_score\x18\x05 \x01(\x05R\tcopyScore\x12\x1f\n" +
+	"\vignore_revs\x18\x06 \x03(\tR\n" +
+	"ignoreRevs\x12(\n" +
+	"\x10ignore_revs_file\x18\a \x01(\tR\x0eignoreRevsFile\x121\n" +
+	"\x15read_ignore_revs_file\x18\b \x01(\bR\x12readIgnoreRevsFile\x12%\n" +
+	"\x0eskip_generated\x18\t \x01(\bR\rskipGenerated\x12#\n" +
+	"\rskip_vendored\x18\n" +
+	" \x01(\bR\fskipVendored\x120\n" +
+	"\x14hg_ignore_whitespace\x18\v \x01(\bR\x12hgIgnoreWhitespace\x12(\n" +
+	"\x10max_failed_files\x18\f \x01(\x05R\x0emaxFailedFiles\"\xb7\x01\n" +
+	"\x10BlameFileRequest\x12\x12\n" +
+	"\x04repo\x18\x01 \x01(\tR\x04repo\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x10\n" +
+	"\x03rev\x18\x03 \x01(\tR\x03rev\x12\x1d\n" +
+	"\n" +
+	"start_line\x18\x04 \x01(\x03R\tstartLine\x12\x19\n" +
+	"\bend_line\x18\x05 \x01(\x03R\aendLine\x12/\n" +
+	"\aoptions\x18\x06 \x01(\v2\x15.goblame.BlameOptionsR\aoptions\"\xc8\x01\n" +
+	"\x11BlameFileResponse\x12#\n" +
+	"\x05hunks\x18\x01 \x03(\v2\r.goblame.HunkR\x05hunks\x12A\n" +
+	"\acommits\x18\x02 \x03(\v2'.goblame.BlameFileResponse.CommitsEntryR\acommits\x1aK\n" +
+	"\fCommitsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12%\n" +
+	"\x05value\x18\x02 \x01(\v2\x0f.goblame.CommitR\x05value:\x028\x01\"\x98\x01\n" +
+	"\x16BlameRepositoryRequest\x12\x12\n" +
+	"\x04repo\x18\x01 \x01(\tR\x04repo\x12\x10\n" +
+	"\x03rev\x18\x02 \x01(\tR\x03rev\x12'\n" +
+	"\x0fignore_patterns\x18\x03 \x03(\tR\x0eignorePatterns\x12/\n" +
+	"\aoptions\x18\x04 \x01(\v2\x15.goblame.BlameOptionsR\aoptions\"\xfe\x01\n" +
+	"\x17BlameRepositoryResponse\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12#\n" +
+	"\x05hunks\x18\x02 \x03(\v2\r.goblame.HunkR\x05hunks\x12G\n" +
+	"\acommits\x18\x03 \x03(\v2-.goblame.BlameRepositoryResponse.CommitsEntryR\acommits\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x1aK\n" +
+	"\fCommitsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12%\n" +
+	"\x05value\x18\x02 \x01(\v2\x0f.goblame.CommitR\x05value:\x028\x012\xaa\x01\n" +
+	"\fBlameService\x12B\n" +
+	"\tBlameFile\x12\x19.goblame.BlameFileRequest\x1a\x1a.goblame.BlameFileResponse\x12V\n" +
+	"\x0fBlameRepository\x12\x1f.goblame.BlameRepositoryRequest\x1a .goblame.BlameRepositoryResponse0\x01B)Z'github.com/sourcegraph/go-blame/blamepbb\x06proto3"
+
+var (
+	file_blame_proto_rawDescOnce sync.Once
+	file_blame_proto_rawDescData []byte
+)
+
+func file_blame_proto_rawDescGZIP() []byte {
+	file_blame_proto_rawDescOnce.Do(func() {
+		file_blame_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_blame_proto_rawDesc), len(file_blame_proto_rawDesc)))
+	})
+	return file_blame_proto_rawDescData
+}
+
+var file_blame_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_blame_proto_goTypes = []any{
+	(*Hunk)(nil),                    // 0: goblame.Hunk
+	(*Commit)(nil),                  // 1: goblame.Commit
+	(*Author)(nil),                  // 2: goblame.Author
+	(*BlameOptions)(nil),            // 3: goblame.BlameOptions
+	(*BlameFileRequest)(nil),        // 4: goblame.BlameFileRequest
+	(*BlameFileResponse)(nil),       // 5: goblame.BlameFileResponse
+	(*BlameRepositoryRequest)(nil),  // 6: goblame.BlameRepositoryRequest
+	(*BlameRepositoryResponse)(nil), // 7: goblame.BlameRepositoryResponse
+	nil,                             // 8: goblame.BlameFileResponse.CommitsEntry
+	nil,                             // 9: goblame.BlameRepositoryResponse.CommitsEntry
+	(*timestamppb.Timestamp)(nil),   // 10: google.protobuf.Timestamp
+}
+var file_blame_proto_depIdxs = []int32{
+	2,  // 0: goblame.Commit.author:type_name -> goblame.Author
+	2,  // 1: goblame.Commit.committer:type_name -> goblame.Author
+	10, // 2: goblame.Commit.author_date:type_name -> google.protobuf.Timestamp
+	10, // 3: goblame.Commit.committer_date:type_name -> google.protobuf.Timestamp
+	3,  // 4: goblame.BlameFileRequest.options:type_name -> goblame.BlameOptions
+	0,  // 5: goblame.BlameFileResponse.hunks:type_name -> goblame.Hunk
+	8,  // 6: goblame.BlameFileResponse.commits:type_name -> goblame.BlameFileResponse.CommitsEntry
+	3,  // 7: goblame.BlameRepositoryRequest.options:type_name -> goblame.BlameOptions
+	0,  // 8: goblame.BlameRepositoryResponse.hunks:type_name -> goblame.Hunk
+	9,  // 9: goblame.BlameRepositoryResponse.commits:type_name -> goblame.BlameRepositoryResponse.CommitsEntry
+	1,  // 10: goblame.BlameFileResponse.CommitsEntry.value:type_name -> goblame.Commit
+	1,  // 11: goblame.BlameRepositoryResponse.CommitsEntry.value:type_name -> goblame.Commit
+	4,  // 12: goblame.BlameService.BlameFile:input_type -> goblame.BlameFileRequest
+	6,  // 13: goblame.BlameService.BlameRepository:input_type -> goblame.BlameRepositoryRequest
+	5,  // 14: goblame.BlameService.BlameFile:output_type -> goblame.BlameFileResponse
+	7,  // 15: goblame.BlameService.BlameRepository:output_type -> goblame.BlameRepositoryResponse
+	14, // [14:16] is the sub-list for method output_type
+	12, // [12:14] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_blame_proto_init() }
+func file_blame_proto_init() {
+	if File_blame_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_blame_proto_rawDesc), len(file_blame_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_blame_proto_goTypes,
+		DependencyIndexes: file_blame_proto_depIdxs,
+		MessageInfos:      file_blame_proto_msgTypes,
+	}.Build()
+	File_blame_proto = out.File
+	file_blame_proto_goTypes = nil
+	file_blame_proto_depIdxs = nil
+}
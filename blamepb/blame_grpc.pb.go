@@ -0,0 +1,180 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: blame.proto
+
+// The blame package's result types, and a service that blames files and
+// repositories. The Go code is generated (see gen.go).
+
+package blamepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	BlameService_BlameFile_FullMethodName       = "/goblame.BlameService/BlameFile"
+	BlameService_BlameRepository_FullMethodName = "/goblame.BlameService/BlameRepository"
+)
+
+// BlameServiceClient is the client API for BlameService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// BlameService blames files and repositories on the server.
+type BlameServiceClient interface {
+	// BlameFile blames a file, or a range of its lines.
+	BlameFile(ctx context.Context, in *BlameFileRequest, opts ...grpc.CallOption) (*BlameFileResponse, error)
+	// BlameRepository blames all files in a repository, sending the result
+	// of each file in its own message. Files that can't be blamed are sent
+	// with an error, until there are more than the options' max_failed_files
+	// of them; then the call fails.
+	BlameRepository(ctx context.Context, in *BlameRepositoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BlameRepositoryResponse], error)
+}
+
+type blameServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBlameServiceClient(cc grpc.ClientConnInterface) BlameServiceClient {
+	return &blameServiceClient{cc}
+}
+
+func (c *blameServiceClient) BlameFile(ctx context.Context, in *BlameFileRequest, opts ...grpc.CallOption) (*BlameFileResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BlameFileResponse)
+	err := c.cc.Invoke(ctx, BlameService_BlameFile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blameServiceClient) BlameRepository(ctx context.Context, in *BlameRepositoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BlameRepositoryResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &BlameService_ServiceDesc.Streams[0], BlameService_BlameRepository_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BlameRepositoryRequest, BlameRepositoryResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BlameService_BlameRepositoryClient = grpc.ServerStreamingClient[BlameRepositoryResponse]
+
+// BlameServiceServer is the server API for BlameService service.
+// All implementations must embed UnimplementedBlameServiceServer
+// for forward compatibility.
+//
+// BlameService blames files and repositories on the server.
+type BlameServiceServer interface {
+	// BlameFile blames a file, or a range of its lines.
+	BlameFile(context.Context, *BlameFileRequest) (*BlameFileResponse, error)
+	// BlameRepository blames all files in a repository, sending the result
+	// of each file in its own message. Files that can't be blamed are sent
+	// with an error, until there are more than the options' max_failed_files
+	// of them; then the call fails.
+	BlameRepository(*BlameRepositoryRequest, grpc.ServerStreamingServer[BlameRepositoryResponse]) error
+	mustEmbedUnimplementedBlameServiceServer()
+}
+
+// UnimplementedBlameServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBlameServiceServer struct{}
+
+func (UnimplementedBlameServiceServer) BlameFile(context.Context, *BlameFileRequest) (*BlameFileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BlameFile not implemented")
+}
+func (UnimplementedBlameServiceServer) BlameRepository(*BlameRepositoryRequest, grpc.ServerStreamingServer[BlameRepositoryResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method BlameRepository not implemented")
+}
+func (UnimplementedBlameServiceServer) mustEmbedUnimplementedBlameServiceServer() {}
+func (UnimplementedBlameServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeBlameServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BlameServiceServer will
+// result in compilation errors.
+type UnsafeBlameServiceServer interface {
+	mustEmbedUnimplementedBlameServiceServer()
+}
+
+func RegisterBlameServiceServer(s grpc.ServiceRegistrar, srv BlameServiceServer) {
+	// If the following call pancis, it indicates UnimplementedBlameServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&BlameService_ServiceDesc, srv)
+}
+
+func _BlameService_BlameFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlameFileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlameServiceServer).BlameFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BlameService_BlameFile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlameServiceServer).BlameFile(ctx, req.(*BlameFileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlameService_BlameRepository_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BlameRepositoryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BlameServiceServer).BlameRepository(m, &grpc.GenericServerStream[BlameRepositoryRequest, BlameRepositoryResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BlameService_BlameRepositoryServer = grpc.ServerStreamingServer[BlameRepositoryResponse]
+
+// BlameService_ServiceDesc is the grpc.ServiceDesc for BlameService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var BlameService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "goblame.BlameService",
+	HandlerType: (*BlameServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "BlameFile",
+			Handler:    _BlameService_BlameFile_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "BlameRepository",
+			Handler:       _BlameService_BlameRepository_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "blame.proto",
+}
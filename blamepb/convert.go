@@ -0,0 +1,183 @@
+package blamepb
+
+import (
+	"time"
+
+	"github.com/sourcegraph/go-blame/blame"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// HunkToProto converts a blame.Hunk to a Hunk.
+func HunkToProto(h blame.Hunk) *Hunk {
+	return &Hunk{
+		CommitId:  h.CommitID,
+		LineStart: int64(h.LineStart),
+		LineEnd:   int64(h.LineEnd),
+		CharStart: int64(h.CharStart),
+		CharEnd:   int64(h.CharEnd),
+		Ignored:   h.Ignored,
+	}
+}
+
+// HunkFromProto converts a Hunk to a blame.Hunk.
+func HunkFromProto(h *Hunk) blame.Hunk {
+	return blame.Hunk{
+		CommitID:  h.GetCommitId(),
+		LineStart: int(h.GetLineStart()),
+		LineEnd:   int(h.GetLineEnd()),
+		CharStart: int(h.GetCharStart()),
+		CharEnd:   int(h.GetCharEnd()),
+		Ignored:   h.GetIgnored(),
+	}
+}
+
+// HunksToProto converts blame.Hunks to Hunks.
+func HunksToProto(hunks []blame.Hunk) []*Hunk {
+	if hunks == nil {
+		return nil
+	}
+	p := make([]*Hunk, len(hunks))
+	for i, h := range hunks {
+		p[i] = HunkToProto(h)
+	}
+	return p
+}
+
+// HunksFromProto converts Hunks to blame.Hunks.
+func HunksFromProto(hunks []*Hunk) []blame.Hunk {
+	if hunks == nil {
+		return nil
+	}
+	b := make([]blame.Hunk, len(hunks))
+	for i, h := range hunks {
+		b[i] = HunkFromProto(h)
+	}
+	return b
+}
+
+// CommitToProto converts a blame.Commit to a Commit. The time zones of
+// its dates are kept as offsets from UTC.
+func CommitToProto(c blame.Commit) *Commit {
+	p := &Commit{
+		Id:        c.ID,
+		Author:    AuthorToProto(c.Author),
+		Committer: AuthorToProto(c.Committer),
+		Message:   c.Message,
+		Summary:   c.Summary,
+		Parents:   c.Parents,
+	}
+	p.AuthorDate, p.AuthorDateOffset = timeToProto(c.AuthorDate)
+	p.CommitterDate, p.CommitterDateOffset = timeToProto(c.CommitterDate)
+	return p
+}
+
+// CommitFromProto converts a Commit to a blame.Commit.
+func CommitFromProto(c *Commit) blame.Commit {
+	return blame.Commit{
+		ID:            c.GetId(),
+		Author:        AuthorFromProto(c.GetAuthor()),
+		Committer:     AuthorFromProto(c.GetCommitter()),
+		Message:       c.GetMessage(),
+		Summary:       c.GetSummary(),
+		AuthorDate:    timeFromProto(c.GetAuthorDate(), c.GetAuthorDateOffset()),
+		CommitterDate: timeFromProto(c.GetCommitterDate(), c.GetCommitterDateOffset()),
+		Parents:       c.GetParents(),
+	}
+}
+
+// CommitsToProto converts a map of blame.Commits by ID to a map of
+// Commits.
+func CommitsToProto(commits map[string]blame.Commit) map[string]*Commit {
+	if commits == nil {
+		return nil
+	}
+	p := make(map[string]*Commit, len(commits))
+	for id, c := range commits {
+		p[id] = CommitToProto(c)
+	}
+	return p
+}
+
+// CommitsFromProto converts a map of Commits by ID to a map of
+// blame.Commits.
+func CommitsFromProto(commits map[string]*Commit) map[string]blame.Commit {
+	if commits == nil {
+		return nil
+	}
+	b := make(map[string]blame.Commit, len(commits))
+	for id, c := range commits {
+		b[id] = CommitFromProto(c)
+	}
+	return b
+}
+
+// AuthorToProto converts a blame.Author to an Author.
+func AuthorToProto(a blame.Author) *Author {
+	return &Author{Name: a.Name, Email: a.Email}
+}
+
+// AuthorFromProto converts an Author to a blame.Author.
+func AuthorFromProto(a *Author) blame.Author {
+	return blame.Author{Name: a.GetName(), Email: a.GetEmail()}
+}
+
+// OptionsToProto converts blame.BlameOptions to BlameOptions. A nil opt
+// is converted to nil.
+func OptionsToProto(opt *blame.BlameOptions) *BlameOptions {
+	if opt == nil {
+		return nil
+	}
+	return &BlameOptions{
+		NoIgnoreWhitespace: opt.NoIgnoreWhitespace,
+		DetectMoves:        opt.DetectMoves,
+		MoveScore:          int32(opt.MoveScore),
+		DetectCopies:       int32(opt.DetectCopies),
+		CopyScore:          int32(opt.CopyScore),
+		IgnoreRevs:         opt.IgnoreRevs,
+		IgnoreRevsFile:     opt.IgnoreRevsFile,
+		ReadIgnoreRevsFile: opt.ReadIgnoreRevsFile,
+		SkipGenerated:      opt.SkipGenerated,
+		SkipVendored:       opt.SkipVendored,
+		HgIgnoreWhitespace: opt.HgIgnoreWhitespace,
+		MaxFailedFiles:     int32(opt.MaxFailedFiles),
+	}
+}
+
+// OptionsFromProto converts BlameOptions to blame.BlameOptions. A nil opt
+// is converted to nil.
+func OptionsFromProto(opt *BlameOptions) *blame.BlameOptions {
+	if opt == nil {
+		return nil
+	}
+	return &blame.BlameOptions{
+		NoIgnoreWhitespace: opt.NoIgnoreWhitespace,
+		DetectMoves:        opt.DetectMoves,
+		MoveScore:          int(opt.MoveScore),
+		DetectCopies:       int(opt.DetectCopies),
+		CopyScore:          int(opt.CopyScore),
+		IgnoreRevs:         opt.IgnoreRevs,
+		IgnoreRevsFile:     opt.IgnoreRevsFile,
+		ReadIgnoreRevsFile: opt.ReadIgnoreRevsFile,
+		SkipGenerated:      opt.SkipGenerated,
+		SkipVendored:       opt.SkipVendored,
+		HgIgnoreWhitespace: opt.HgIgnoreWhitespace,
+		MaxFailedFiles:     int(opt.MaxFailedFiles),
+	}
+}
+
+// timeToProto returns t as a timestamp and the offset of its time zone.
+// The zero time is returned as nil.
+func timeToProto(t time.Time) (*timestamppb.Timestamp, int32) {
+	if t.IsZero() {
+		return nil, 0
+	}
+	_, offset := t.Zone()
+	return timestamppb.New(t), int32(offset)
+}
+
+func timeFromProto(ts *timestamppb.Timestamp, offset int32) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime().In(time.FixedZone("", int(offset)))
+}
@@ -0,0 +1,62 @@
+package blamepb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/go-blame/blame"
+)
+
+func TestConvert(t *testing.T) {
+	hunks := []blame.Hunk{
+		{CommitID: "a", LineStart: 0, LineEnd: 2, CharStart: 0, CharEnd: 10},
+		{CommitID: "b", LineStart: 2, LineEnd: 3, CharStart: 10, CharEnd: 12, Ignored: true},
+	}
+	if got := HunksFromProto(HunksToProto(hunks)); !reflect.DeepEqual(got, hunks) {
+		t.Errorf("hunks: got %+v, want %+v", got, hunks)
+	}
+	if got := HunksFromProto(HunksToProto(nil)); got != nil {
+		t.Errorf("nil hunks: got %+v, want nil", got)
+	}
+
+	commits := map[string]blame.Commit{
+		"a": {
+			ID:            "a",
+			Author:        blame.Author{Name: "Jane Doe", Email: "jane@example.com"},
+			Committer:     blame.Author{Name: "John Doe", Email: "john@example.com"},
+			Message:       "Add files\n\nDetails.",
+			Summary:       "Add files",
+			AuthorDate:    time.Date(2014, 1, 2, 3, 4, 5, 0, time.FixedZone("", -7*3600)),
+			CommitterDate: time.Date(2014, 1, 3, 3, 4, 5, 0, time.FixedZone("", 5*3600+1800)),
+			Parents:       []string{"b", "c"},
+		},
+		"b": {ID: "b", Author: blame.Author{Name: "Jane Doe"}},
+	}
+	got := CommitsFromProto(CommitsToProto(commits))
+	if len(got) != len(commits) {
+		t.Fatalf("got %d commits, want %d", len(got), len(commits))
+	}
+	for id, want := range commits {
+		c := got[id]
+		for _, d := range []struct{ got, want time.Time }{{c.AuthorDate, want.AuthorDate}, {c.CommitterDate, want.CommitterDate}} {
+			_, gotOffset := d.got.Zone()
+			_, wantOffset := d.want.Zone()
+			if !d.got.Equal(d.want) || gotOffset != wantOffset || d.got.IsZero() != d.want.IsZero() {
+				t.Errorf("commit %s: got date %v, want %v", id, d.got, d.want)
+			}
+		}
+		c.AuthorDate, c.CommitterDate, want.AuthorDate, want.CommitterDate = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("commit %s: got %+v, want %+v", id, c, want)
+		}
+	}
+
+	opt := &blame.BlameOptions{DetectMoves: true, MoveScore: 10, DetectCopies: 2, IgnoreRevs: []string{"a"}, IgnoreRevsFile: ".revs", SkipVendored: true, HgIgnoreWhitespace: true, MaxFailedFiles: -1}
+	if got := OptionsFromProto(OptionsToProto(opt)); !reflect.DeepEqual(got, opt) {
+		t.Errorf("options: got %+v, want %+v", got, opt)
+	}
+	if got := OptionsFromProto(nil); got != nil {
+		t.Errorf("nil options: got %+v, want nil", got)
+	}
+}
@@ -0,0 +1,7 @@
+// Package blamepb defines the blame package's result types as protocol
+// buffers (in blame.proto), converts them to and from the blame package's
+// structs, and implements a gRPC service that blames files and
+// repositories.
+package blamepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative blame.proto
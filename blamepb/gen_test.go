@@ -0,0 +1,51 @@
+package blamepb
+
+import (
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestGenerated checks that blame.pb.go is up to date with blame.proto
+// (see gen.go), by comparing the fields of their messages.
+func TestGenerated(t *testing.T) {
+	data, err := ioutil.ReadFile("blame.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		messageRE = regexp.MustCompile(`^message (\w+) \{$`)
+		fieldRE   = regexp.MustCompile(`^\s+[^/=]+\s(\w+) = (\d+);$`)
+		want      = make(map[string]map[string]int)
+		message   string
+	)
+	for _, line := range strings.Split(string(data), "\n") {
+		if m := messageRE.FindStringSubmatch(line); m != nil {
+			message = m[1]
+			want[message] = make(map[string]int)
+		} else if line == "}" {
+			message = ""
+		} else if m := fieldRE.FindStringSubmatch(line); m != nil && message != "" {
+			n, _ := strconv.Atoi(m[2])
+			want[message][m[1]] = n
+		}
+	}
+
+	got := make(map[string]map[string]int)
+	messages := File_blame_proto.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		md := messages.Get(i)
+		fields := make(map[string]int)
+		for j := 0; j < md.Fields().Len(); j++ {
+			f := md.Fields().Get(j)
+			fields[string(f.Name())] = int(f.Number())
+		}
+		got[string(md.Name())] = fields
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("blame.pb.go is out of date (run go generate): got messages %v, want %v", got, want)
+	}
+}
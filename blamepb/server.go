@@ -0,0 +1,128 @@
+package blamepb
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/sourcegraph/go-blame/blame"
+	"github.com/sourcegraph/go-blame/blameroots"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// A Server implements BlameServiceServer for the repositories in its
+// roots. Register it with RegisterBlameServiceServer. The
+// ignore_revs_file option must name a file in the repository's work tree
+// (see blameroots.File).
+type Server struct {
+	UnimplementedBlameServiceServer
+
+	// Roots are the directories of the repositories that can be blamed.
+	Roots blameroots.Roots
+}
+
+func (s *Server) BlameFile(ctx context.Context, req *BlameFileRequest) (*BlameFileResponse, error) {
+	repoPath, backend, rev, opt, err := s.resolve(req.GetRepo(), req.GetRev(), req.GetOptions())
+	if err != nil {
+		return nil, err
+	}
+	filePath, err := blameroots.CleanPath(req.GetPath())
+	if err != nil || req.GetPath() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "bad path %q", req.GetPath())
+	}
+
+	var hunks []blame.Hunk
+	var commits map[string]blame.Commit
+	if start, end := int(req.GetStartLine()), int(req.GetEndLine()); end != 0 {
+		if start < 0 || end <= start {
+			return nil, status.Errorf(codes.InvalidArgument, "bad line range [%d, %d)", start, end)
+		}
+		rb, ok := backend.(blame.RangeBackend)
+		if !ok {
+			return nil, status.Error(codes.Unimplemented, "the repository's backend can't blame line ranges")
+		}
+		hunks, commits, err = rb.BlameFileRange(ctx, repoPath, filePath, rev, start, end, opt)
+	} else {
+		hunks, commits, err = backend.BlameFile(ctx, repoPath, filePath, rev, opt)
+	}
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return &BlameFileResponse{Hunks: HunksToProto(hunks), Commits: CommitsToProto(commits)}, nil
+}
+
+func (s *Server) BlameRepository(req *BlameRepositoryRequest, stream BlameService_BlameRepositoryServer) error {
+	ctx := stream.Context()
+	repoPath, _, rev, opt, err := s.resolve(req.GetRepo(), req.GetRev(), req.GetOptions())
+	if err != nil {
+		return err
+	}
+	maxFailed := int(req.GetOptions().GetMaxFailedFiles())
+	failed := 0
+	err = blame.StreamRepositoryContext(ctx, repoPath, rev, req.GetIgnorePatterns(), opt, func(fb blame.FileBlame) error {
+		if fb.Err != nil {
+			failed++
+			if ctx.Err() != nil || (maxFailed >= 0 && failed > maxFailed) {
+				return statusError(ctx, fb.Err)
+			}
+			return stream.Send(&BlameRepositoryResponse{Path: fb.Path, Error: fb.Err.Error()})
+		}
+		return stream.Send(&BlameRepositoryResponse{Path: fb.Path, Hunks: HunksToProto(fb.Hunks), Commits: CommitsToProto(fb.Commits)})
+	})
+	if _, ok := status.FromError(err); !ok {
+		err = statusError(ctx, err)
+	}
+	return err
+}
+
+// resolve returns the directory and backend of a repository, and the
+// revision and options to blame it with.
+func (s *Server) resolve(repo, rev string, popt *BlameOptions) (string, blame.Backend, string, *blame.BlameOptions, error) {
+	repoPath, err := s.Roots.Repo(repo)
+	if errors.Is(err, blame.ErrNotRepository) {
+		return "", nil, "", nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return "", nil, "", nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	name, backend := blame.DetectBackend(repoPath)
+	if rev == "" {
+		rev = "HEAD"
+		if name == "hg" {
+			rev = "tip"
+		}
+	}
+	if strings.HasPrefix(rev, "-") {
+		// It would be taken for a git or hg option.
+		return "", nil, "", nil, status.Errorf(codes.InvalidArgument, "bad revision %q", rev)
+	}
+	opt := OptionsFromProto(popt)
+	if opt != nil && opt.IgnoreRevsFile != "" {
+		// git reads the file from the file system, and quotes it in its
+		// error messages.
+		if opt.IgnoreRevsFile, err = blameroots.File(repoPath, opt.IgnoreRevsFile); errors.Is(err, blame.ErrFileNotFound) {
+			return "", nil, "", nil, status.Errorf(codes.NotFound, "ignore_revs_file %q not found", popt.GetIgnoreRevsFile())
+		} else if err != nil {
+			return "", nil, "", nil, status.Errorf(codes.InvalidArgument, "bad ignore_revs_file %q", popt.GetIgnoreRevsFile())
+		}
+	}
+	return repoPath, backend, rev, opt, nil
+}
+
+// statusError returns the gRPC status error for an error from blaming.
+func statusError(ctx context.Context, err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, blame.ErrNotRepository), errors.Is(err, blame.ErrRevisionNotFound), errors.Is(err, blame.ErrFileNotFound):
+		code = codes.NotFound
+	case errors.Is(err, blame.ErrBinaryFile):
+		code = codes.FailedPrecondition
+	case errors.Is(err, blame.ErrToolMissing):
+		code = codes.Unavailable
+	}
+	return status.Error(code, err.Error())
+}
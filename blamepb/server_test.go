@@ -0,0 +1,224 @@
+package blamepb
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-blame/blameroots"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testRoot creates a root directory with a git repository, "repo", with
+// one commit.
+func testRoot(t *testing.T) string {
+	root := t.TempDir()
+	dir := filepath.Join(root, "repo")
+	for name, data := range map[string]string{"a.txt": "a\nb\nc\n", "d/c.go": "package c\n", "bin": "\x00"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{{"init", "-q"}, {"add", "-A"}, {"commit", "-q", "-m", "Add files"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com", "GIT_AUTHOR_DATE=2014-01-02T00:00:00Z",
+			"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com", "GIT_COMMITTER_DATE=2014-01-02T00:00:00Z")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s: %s", args, err, out)
+		}
+	}
+	// Files outside of the repository, which an ignore_revs_file
+	// mustn't reach.
+	if err := ioutil.WriteFile(filepath.Join(root, "secret"), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "secret"), filepath.Join(dir, "secret-link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "ignore-revs"), []byte("# no commits\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// testClient starts a Server for the repositories in root (see testRoot)
+// and returns a client connected to it.
+func testClient(t *testing.T, root string) BlameServiceClient {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	RegisterBlameServiceServer(srv, &Server{Roots: blameroots.Roots{"r": root}})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewBlameServiceClient(conn)
+}
+
+func TestServer_BlameFile(t *testing.T) {
+	c := testClient(t, testRoot(t))
+	ctx := context.Background()
+
+	resp, err := c.BlameFile(ctx, &BlameFileRequest{Repo: "r/repo", Path: "a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hunks := HunksFromProto(resp.Hunks)
+	if len(hunks) != 1 || hunks[0].LineStart != 0 || hunks[0].LineEnd != 3 {
+		t.Errorf("got hunks %+v, want one of lines [0, 3)", hunks)
+	}
+	commit := CommitFromProto(resp.Commits[hunks[0].CommitID])
+	if commit.Author.Name != "Jane Doe" || commit.Summary != "Add files" || commit.AuthorDate.Year() != 2014 {
+		t.Errorf("got commit %+v", commit)
+	}
+
+	resp, err = c.BlameFile(ctx, &BlameFileRequest{Repo: "r/repo", Path: "a.txt", StartLine: 1, EndLine: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hunks := HunksFromProto(resp.Hunks); len(hunks) != 1 || hunks[0].LineStart != 1 || hunks[0].LineEnd != 2 {
+		t.Errorf("range: got hunks %+v, want one of lines [1, 2)", hunks)
+	}
+
+	tests := []struct {
+		req  *BlameFileRequest
+		code codes.Code
+	}{
+		{&BlameFileRequest{Repo: "r/repo"}, codes.InvalidArgument},
+		{&BlameFileRequest{Repo: "r/repo", Path: "../a.txt"}, codes.InvalidArgument},
+		{&BlameFileRequest{Repo: "r/repo", Path: "a.txt", Rev: "--output=x"}, codes.InvalidArgument},
+		{&BlameFileRequest{Repo: "r/repo", Path: "a.txt", StartLine: 2, EndLine: 1}, codes.InvalidArgument},
+		{&BlameFileRequest{Repo: "r/repo", Path: "a.txt", Options: &BlameOptions{IgnoreRevsFile: "../revs"}}, codes.InvalidArgument},
+		{&BlameFileRequest{Repo: "r/repo", Path: "a.txt", Options: &BlameOptions{IgnoreRevsFile: "secret-link"}}, codes.InvalidArgument},
+		{&BlameFileRequest{Repo: "r/repo", Path: "a.txt", Options: &BlameOptions{IgnoreRevsFile: ".git/config"}}, codes.InvalidArgument},
+		{&BlameFileRequest{Repo: "r/repo", Path: "a.txt", Options: &BlameOptions{IgnoreRevsFile: "nonexistent"}}, codes.NotFound},
+		{&BlameFileRequest{Repo: "r/repo", Path: "a.txt", Options: &BlameOptions{IgnoreRevsFile: "ignore-revs"}}, codes.OK},
+		{&BlameFileRequest{Repo: "r/../x", Path: "a.txt"}, codes.InvalidArgument},
+		{&BlameFileRequest{Repo: "x/repo", Path: "a.txt"}, codes.NotFound},
+		{&BlameFileRequest{Repo: "r/repo", Path: "a.txt", Rev: "nonexistent"}, codes.NotFound},
+		{&BlameFileRequest{Repo: "r/repo", Path: "nonexistent"}, codes.NotFound},
+		{&BlameFileRequest{Repo: "r/repo", Path: "bin"}, codes.FailedPrecondition},
+	}
+	for _, test := range tests {
+		_, err := c.BlameFile(ctx, test.req)
+		if code := status.Code(err); code != test.code {
+			t.Errorf("%v: got code %s, want %s (error: %v)", test.req, code, test.code, err)
+		}
+	}
+}
+
+func TestServer_BlameRepository(t *testing.T) {
+	c := testClient(t, testRoot(t))
+	stream, err := c.BlameRepository(context.Background(), &BlameRepositoryRequest{Repo: "r/repo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	commits := 0
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, resp.Path)
+		commits += len(resp.Commits)
+		for _, h := range resp.Hunks {
+			if h.CommitId == "" {
+				t.Errorf("%s: hunk %+v has no commit", resp.Path, h)
+			}
+		}
+	}
+	sort.Strings(paths)
+	if len(paths) != 2 || paths[0] != "a.txt" || paths[1] != "d/c.go" {
+		t.Errorf("got files %v, want [a.txt d/c.go]", paths)
+	}
+	if commits != 1 {
+		t.Errorf("got %d commits, want each one sent once", commits)
+	}
+
+	stream, err = c.BlameRepository(context.Background(), &BlameRepositoryRequest{Repo: "r/repo", Rev: "nonexistent"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("nonexistent revision: got error %v, want code %s", err, codes.NotFound)
+	}
+}
+
+func TestServer_BlameRepository_failedFiles(t *testing.T) {
+	root := testRoot(t)
+	// Break d/c.go by removing its blob.
+	dir := filepath.Join(root, "repo")
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD:d/c.go").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := strings.TrimSpace(string(out))
+	if err := os.Remove(filepath.Join(dir, ".git", "objects", id[:2], id[2:])); err != nil {
+		t.Fatal(err)
+	}
+	c := testClient(t, root)
+
+	// recv returns the number of hunks of the files that were blamed, and
+	// the error of each failed one.
+	recv := func(opt *BlameOptions) (hunks map[string]int, errs map[string]string, err error) {
+		stream, err := c.BlameRepository(context.Background(), &BlameRepositoryRequest{Repo: "r/repo", Options: opt})
+		if err != nil {
+			return nil, nil, err
+		}
+		hunks, errs = make(map[string]int), make(map[string]string)
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				return hunks, errs, nil
+			} else if err != nil {
+				return hunks, errs, err
+			}
+			if resp.Error != "" {
+				errs[resp.Path] = resp.Error
+			} else {
+				hunks[resp.Path] = len(resp.Hunks)
+			}
+		}
+	}
+
+	// By default, the first failed file fails the call.
+	if _, errs, err := recv(nil); err == nil || len(errs) != 0 {
+		t.Errorf("got errors %v and error %v, want the call to fail", errs, err)
+	}
+
+	for _, maxFailed := range []int32{1, -1} {
+		hunks, errs, err := recv(&BlameOptions{MaxFailedFiles: maxFailed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hunks["a.txt"] != 1 || len(hunks) != 1 {
+			t.Errorf("max %d: got hunks %v, want a.txt's", maxFailed, hunks)
+		}
+		if len(errs) != 1 || errs["d/c.go"] == "" {
+			t.Errorf("max %d: got errors %v, want d/c.go's", maxFailed, errs)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Package blameroots names the repositories that a server (such as
+// blamehttp.Handler or blamepb.Server) may blame, and the paths in them,
+// so that requests can't reach outside of them.
+package blameroots
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sourcegraph/go-blame/blame"
+)
+
+// A BadNameError is returned for a repository name or path that is
+// malformed, or that names something that may not be blamed.
+type BadNameError string
+
+func (e BadNameError) Error() string { return string(e) }
+
+// Roots maps root names to the directories that contain repositories.
+// Repositories in them are named "<root>/<path in root>".
+type Roots map[string]string
+
+// Repo returns the directory of the repository named repo. It returns an
+// error if repo isn't in one of the roots (even through a symlink), which
+// wraps blame.ErrNotRepository if repo is a valid name.
+func (roots Roots) Repo(repo string) (string, error) {
+	if repo == "" {
+		return "", BadNameError("missing repo")
+	}
+	rootName, rel := repo, "."
+	if i := strings.Index(repo, "/"); i != -1 {
+		rootName, rel = repo[:i], repo[i+1:]
+	}
+	root, ok := roots[rootName]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown root %q", blame.ErrNotRepository, rootName)
+	}
+	rel, err := CleanPath(rel)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, filepath.FromSlash(rel))
+	if _, _, err := resolveInside(root, dir); err != nil {
+		return "", fmt.Errorf("%w: %s", blame.ErrNotRepository, repo)
+	}
+	return dir, nil
+}
+
+// CleanPath cleans a slash-separated path of a file or directory in a
+// repository. It returns an error if the path is absolute or refers to a
+// parent directory.
+func CleanPath(p string) (string, error) {
+	if p == "" {
+		p = "."
+	}
+	clean := path.Clean(p)
+	if path.IsAbs(clean) || filepath.IsAbs(p) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(p, "\\") || strings.ContainsRune(p, 0) {
+		return "", BadNameError(fmt.Sprintf("bad path %q", p))
+	}
+	return clean, nil
+}
+
+// File returns the path, with symlinks resolved, of the file that the
+// slash-separated path p names in the repository at repoPath, for a
+// server to read. Unlike the files that are blamed, which are read from
+// the repository's history, it is read from the file system, so File
+// returns an error if p is malformed, if it is in the repository's .git
+// or .hg directory, or if it isn't in the repository (even through a
+// symlink). The error wraps blame.ErrFileNotFound if the file doesn't
+// exist.
+func File(repoPath, p string) (string, error) {
+	clean, err := CleanPath(p)
+	if err != nil {
+		return "", err
+	}
+	bad := BadNameError(fmt.Sprintf("bad path %q", p))
+	if clean == "." || isMetadataDir(clean) {
+		return "", bad
+	}
+	realPath, rel, err := resolveInside(repoPath, filepath.Join(repoPath, filepath.FromSlash(clean)))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: %s", blame.ErrFileNotFound, p)
+	} else if err != nil || isMetadataDir(filepath.ToSlash(rel)) {
+		return "", bad
+	}
+	return realPath, nil
+}
+
+// isMetadataDir returns true if the slash-separated path p (relative to a
+// repository) is in the repository's .git or .hg directory.
+func isMetadataDir(p string) bool {
+	first := strings.SplitN(p, "/", 2)[0]
+	return strings.EqualFold(first, ".git") || strings.EqualFold(first, ".hg")
+}
+
+// resolveInside returns p with symlinks resolved, and relative to dir
+// (with its symlinks resolved), or an error if it isn't in dir.
+func resolveInside(dir, p string) (realPath, rel string, err error) {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", "", err
+	}
+	if realPath, err = filepath.EvalSymlinks(p); err != nil {
+		return "", "", err
+	}
+	rel, err = filepath.Rel(realDir, realPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("%s is outside of %s", p, dir)
+	}
+	return realPath, rel, nil
+}
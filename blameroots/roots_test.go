@@ -0,0 +1,91 @@
+package blameroots
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sourcegraph/go-blame/blame"
+)
+
+// testRoot creates a root with a repository, "repo", that has a file, a
+// .git directory and symlinks that lead out of it.
+func testRoot(t *testing.T) string {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	repo := filepath.Join(root, "repo")
+	for name, data := range map[string]string{
+		"root/repo/f":           "f\n",
+		"root/repo/.git/config": "[core]\n",
+		"root/outside":          "outside\n",
+		"secret":                "secret\n",
+	} {
+		path := filepath.Join(base, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"root/escape":     base,
+		"root/repo/link":  filepath.Join(repo, "f"),
+		"root/repo/out":   filepath.Join(root, "outside"),
+		"root/repo/gitcf": filepath.Join(repo, ".git", "config"),
+	} {
+		if err := os.Symlink(target, filepath.Join(base, filepath.FromSlash(link))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestRoots_Repo(t *testing.T) {
+	root := testRoot(t)
+	roots := Roots{"r": root}
+	for repo, want := range map[string]string{
+		"r":         root,
+		"r/repo":    filepath.Join(root, "repo"),
+		"r/./repo/": filepath.Join(root, "repo"),
+	} {
+		if dir, err := roots.Repo(repo); err != nil || dir != want {
+			t.Errorf("%q: got %q and error %v, want %q", repo, dir, err, want)
+		}
+	}
+
+	var bad BadNameError
+	for _, repo := range []string{"", "r/../x", "r//abs", "r/a\\b"} {
+		if _, err := roots.Repo(repo); !errors.As(err, &bad) {
+			t.Errorf("%q: got error %v, want a BadNameError", repo, err)
+		}
+	}
+	for _, repo := range []string{"x/repo", "r/escape", "r/nonexistent"} {
+		if _, err := roots.Repo(repo); !errors.Is(err, blame.ErrNotRepository) {
+			t.Errorf("%q: got error %v, want ErrNotRepository", repo, err)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	repo := filepath.Join(testRoot(t), "repo")
+	realRepo, err := filepath.EvalSymlinks(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"f", "./f", "link"} {
+		if path, err := File(repo, p); err != nil || path != filepath.Join(realRepo, "f") {
+			t.Errorf("%q: got %q and error %v, want %q", p, path, err, filepath.Join(realRepo, "f"))
+		}
+	}
+
+	var bad BadNameError
+	for _, p := range []string{"", ".", "../outside", "/etc/passwd", "out", ".git/config", ".GIT/config", "gitcf", ".hg/hgrc"} {
+		if path, err := File(repo, p); !errors.As(err, &bad) {
+			t.Errorf("%q: got %q and error %v, want a BadNameError", p, path, err)
+		}
+	}
+	if _, err := File(repo, "nonexistent"); !errors.Is(err, blame.ErrFileNotFound) {
+		t.Errorf("got error %v for a nonexistent file, want ErrFileNotFound", err)
+	}
+}
@@ -0,0 +1,428 @@
+// Command go-blame blames files in git and hg repositories, and summarizes
+// their authorship.
+//
+// Usage:
+//
+//	go-blame file [flags] <file>
+//	go-blame repo [flags]
+//	go-blame authorship [flags] [path ...]
+//
+// Run go-blame <command> -h for the flags of each command. The exit status
+// is 0 on success, 1 on failure, 2 for bad usage, and one of the following
+// if blaming failed for these reasons:
+//
+//	3  not a repository
+//	4  revision not found
+//	5  file not found
+//	6  binary file
+//	7  git or hg not installed
+//
+// With -max-failed-files, the repo and authorship commands carry on past
+// files that can't be blamed; those are listed on stderr, the results of
+// the others are written, and the exit status is 1.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sourcegraph/go-blame/blame"
+)
+
+const (
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// exitCodes are the exit statuses for the package's errors.
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{blame.ErrNotRepository, 3},
+	{blame.ErrRevisionNotFound, 4},
+	{blame.ErrFileNotFound, 5},
+	{blame.ErrBinaryFile, 6},
+	{blame.ErrToolMissing, 7},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+const usage = `usage: go-blame <command> [flags] [args]
+
+Commands:
+  file        blame a file
+  repo        blame all files in a repository
+  authorship  summarize who most recently authored a repository's code
+
+Run go-blame <command> -h for the flags of each command.
+`
+
+// run runs go-blame with args (not including the program name), and
+// returns its exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	var cmd func(*command) error
+	switch args[0] {
+	case "file":
+		cmd = blameFile
+	case "repo":
+		cmd = blameRepo
+	case "authorship":
+		cmd = authorship
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "go-blame: unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+
+	c := newCommand(args[0], stdout, stderr)
+	if err := c.flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return exitUsage
+	}
+	if err := cmd(c); err != nil {
+		if err == errUsage {
+			c.flags.Usage()
+			return exitUsage
+		}
+		fmt.Fprintf(stderr, "go-blame %s: %s\n", args[0], err)
+		for _, e := range exitCodes {
+			if errors.Is(err, e.err) {
+				return e.code
+			}
+		}
+		return exitFailure
+	}
+	return 0
+}
+
+// errUsage is returned by commands whose arguments are bad.
+var errUsage = errors.New("bad usage")
+
+// errFilesFailed is returned by commands that wrote their results even
+// though some files couldn't be blamed.
+var errFilesFailed = errors.New("some files could not be blamed")
+
+// command holds the flags that all commands share, and where they write
+// their output.
+type command struct {
+	flags          *flag.FlagSet
+	stdout, stderr io.Writer
+
+	repo, rev, backend, format string
+	backendName                string // of the backend that setUp chose
+	ignore                     stringsFlag
+	lines                      string
+	verbose                    bool
+	opt                        blame.BlameOptions
+	ignoreRevs                 stringsFlag
+}
+
+func newCommand(name string, stdout, stderr io.Writer) *command {
+	c := &command{flags: flag.NewFlagSet("go-blame "+name, flag.ContinueOnError), stdout: stdout, stderr: stderr}
+	fs := c.flags
+	fs.SetOutput(stderr)
+	fs.StringVar(&c.repo, "repo", ".", "repository `path`")
+	fs.StringVar(&c.rev, "rev", "", "revision to blame (default HEAD for git, tip for hg)")
+	fs.StringVar(&c.backend, "backend", "", "backend `name` (default: detected from the repository)")
+	fs.StringVar(&c.format, "format", "text", "output `format`: text, json or csv")
+	fs.BoolVar(&c.verbose, "v", false, "log progress and warnings to stderr")
+	fs.BoolVar(&c.opt.NoIgnoreWhitespace, "no-ignore-whitespace", false, "attribute whitespace changes to the commits that made them")
+	fs.BoolVar(&c.opt.HgIgnoreWhitespace, "hg-ignore-whitespace", false, "make hg ignore whitespace changes, as git does by default")
+	fs.BoolVar(&c.opt.DetectMoves, "M", false, "detect lines moved within a file")
+	fs.IntVar(&c.opt.DetectCopies, "C", 0, "detect lines copied from other files, at `level` 1 to 3")
+	fs.Var(&c.ignoreRevs, "ignore-rev", "ignore a `commit` when attributing lines (repeatable)")
+	fs.StringVar(&c.opt.IgnoreRevsFile, "ignore-revs-file", "", "ignore the commits listed in a `file`")
+	fs.BoolVar(&c.opt.ReadIgnoreRevsFile, "read-ignore-revs-file", false, "ignore the commits listed in the revision's .git-blame-ignore-revs")
+	if name == "file" {
+		fs.StringVar(&c.lines, "lines", "", "only blame lines `start:end` (numbered from 1, inclusive)")
+	} else {
+		fs.Var(&c.ignore, "ignore", "skip files that match a .gitignore-style `pattern` (repeatable)")
+		fs.BoolVar(&c.opt.SkipGenerated, "skip-generated", false, "skip files marked linguist-generated")
+		fs.BoolVar(&c.opt.SkipVendored, "skip-vendored", false, "skip files marked linguist-vendored")
+		fs.IntVar(&c.opt.MaxFailedFiles, "max-failed-files", 0, "carry on past up to `n` files that can't be blamed (-1 for any number)")
+	}
+	return c
+}
+
+// stringsFlag is a flag that may be given more than once.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string     { return strings.Join(*f, ",") }
+func (f *stringsFlag) Set(s string) error { *f = append(*f, s); return nil }
+
+// setUp checks the common flags and returns the backend to use.
+func (c *command) setUp() (blame.Backend, error) {
+	switch c.format {
+	case "text", "json", "csv":
+	default:
+		fmt.Fprintf(c.stderr, "go-blame: unknown format %q\n", c.format)
+		return nil, errUsage
+	}
+	if c.verbose {
+		blame.Log = blame.NewStdLogger(log.New(c.stderr, "", 0))
+	}
+	c.opt.IgnoreRevs = c.ignoreRevs
+
+	var b blame.Backend
+	if c.backend != "" {
+		var err error
+		if b, err = blame.LookupBackend(c.backend); err != nil {
+			return nil, err
+		}
+		c.backendName = c.backend
+	} else {
+		c.backendName, b = blame.DetectBackend(c.repo)
+	}
+	if c.rev == "" {
+		c.rev = "HEAD"
+		if c.backendName == "hg" {
+			c.rev = "tip"
+		}
+	}
+	return b, nil
+}
+
+func blameFile(c *command) error {
+	if c.flags.NArg() != 1 {
+		return errUsage
+	}
+	b, err := c.setUp()
+	if err != nil {
+		return err
+	}
+
+	file := c.flags.Arg(0)
+	var hunks []blame.Hunk
+	var commits map[string]blame.Commit
+	if c.lines != "" {
+		start, end, err := parseLines(c.lines)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "go-blame: %s\n", err)
+			return errUsage
+		}
+		rb, ok := b.(blame.RangeBackend)
+		if !ok {
+			return fmt.Errorf("backend can't blame line ranges")
+		}
+		hunks, commits, err = rb.BlameFileRange(context.Background(), c.repo, file, c.rev, start, end, &c.opt)
+		if err != nil {
+			return err
+		}
+	} else {
+		hunks, commits, err = b.BlameFile(context.Background(), c.repo, file, c.rev, &c.opt)
+		if err != nil {
+			return err
+		}
+	}
+	return c.writeHunks(map[string][]blame.Hunk{file: hunks}, commits, false)
+}
+
+// parseLines parses a "start:end" line range, numbered from 1 and
+// inclusive, and returns it numbered from 0 and exclusive of end.
+func parseLines(s string) (start, end int, err error) {
+	i := strings.Index(s, ":")
+	if i == -1 {
+		return 0, 0, fmt.Errorf("bad line range %q, want start:end", s)
+	}
+	start, err1 := strconv.Atoi(s[:i])
+	end, err2 := strconv.Atoi(s[i+1:])
+	if err1 != nil || err2 != nil || start < 1 || end < start {
+		return 0, 0, fmt.Errorf("bad line range %q, want start:end", s)
+	}
+	return start - 1, end, nil
+}
+
+func blameRepo(c *command) error {
+	if c.flags.NArg() != 0 {
+		return errUsage
+	}
+	b, err := c.setUp()
+	if err != nil {
+		return err
+	}
+	hunks, commits, err := b.BlameRepository(context.Background(), c.repo, c.rev, c.ignore, &c.opt)
+	failed, err := c.failedFiles(err)
+	if err != nil {
+		return err
+	}
+	if err := c.writeHunks(hunks, commits, true); err != nil {
+		return err
+	}
+	return failed
+}
+
+func authorship(c *command) error {
+	b, err := c.setUp()
+	if err != nil {
+		return err
+	}
+	paths := c.flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	hunks, commits, err := b.BlameRepository(context.Background(), c.repo, c.rev, c.ignore, &c.opt)
+	failed, err := c.failedFiles(err)
+	if err != nil {
+		return err
+	}
+	for file, fileHunks := range hunks {
+		hunks[file] = blame.NormalizeHunks(c.backendName, fileHunks)
+	}
+	summaries := blame.RepositoryAuthorship(hunks, commits)
+	selected := make(map[string]*blame.Authorship, len(paths))
+	for _, p := range paths {
+		p = strings.TrimSuffix(p, "/")
+		s, ok := summaries[p]
+		if !ok {
+			return fmt.Errorf("%w: no blamed files in %s", blame.ErrFileNotFound, p)
+		}
+		selected[p] = s
+	}
+	if err := c.writeAuthorship(paths, selected); err != nil {
+		return err
+	}
+	return failed
+}
+
+// writeAuthorship writes the authorship summaries of paths, in the
+// command's output format.
+func (c *command) writeAuthorship(paths []string, selected map[string]*blame.Authorship) error {
+	switch c.format {
+	case "json":
+		return c.writeJSON(selected)
+	case "csv":
+		w := csv.NewWriter(c.stdout)
+		w.Write([]string{"path", "author", "email", "lines", "line_percent", "chars", "char_percent"})
+		for _, p := range paths {
+			for _, a := range selected[strings.TrimSuffix(p, "/")].Authors {
+				w.Write([]string{p, a.Author.Name, a.Author.Email, strconv.Itoa(a.Lines), formatPercent(a.LinePercent), strconv.Itoa(a.Chars), formatPercent(a.CharPercent)})
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+	tw := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	for i, p := range paths {
+		s := selected[strings.TrimSuffix(p, "/")]
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "%s: %d lines, %d chars\n", p, s.Lines, s.Chars)
+		for _, a := range s.Authors {
+			fmt.Fprintf(tw, "  %s <%s>\t%d lines\t%s%%\t%d chars\t%s%%\n", a.Author.Name, a.Author.Email, a.Lines, formatPercent(a.LinePercent), a.Chars, formatPercent(a.CharPercent))
+		}
+	}
+	return tw.Flush()
+}
+
+// failedFiles returns errFilesFailed, after listing the failed files on
+// stderr, if err says that some files couldn't be blamed but the others'
+// results were returned. Otherwise, it returns err.
+func (c *command) failedFiles(err error) (failed, _ error) {
+	var fileErrs *blame.FileErrors
+	if !errors.As(err, &fileErrs) || fileErrs.Aborted {
+		return nil, err
+	}
+	for _, f := range fileErrs.Files {
+		fmt.Fprintf(c.stderr, "go-blame: %s\n", f)
+	}
+	return errFilesFailed, nil
+}
+
+// writeHunks writes the hunks of files, in the command's output format.
+// If withFile is set, the text and CSV formats say which file each hunk is
+// in. The text and CSV formats show the hunks as NormalizeHunks returns
+// them, so that their line ranges mean the same for all backends; JSON
+// has them as the backend returned them.
+func (c *command) writeHunks(hunks map[string][]blame.Hunk, commits map[string]blame.Commit, withFile bool) error {
+	files := make([]string, 0, len(hunks))
+	for f := range hunks {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	switch c.format {
+	case "json":
+		if !withFile {
+			return c.writeJSON(struct {
+				Hunks   []blame.Hunk
+				Commits map[string]blame.Commit
+			}{hunks[files[0]], commits})
+		}
+		return c.writeJSON(struct {
+			Files   map[string][]blame.Hunk
+			Commits map[string]blame.Commit
+		}{hunks, commits})
+
+	case "csv":
+		w := csv.NewWriter(c.stdout)
+		header := []string{"commit", "line_start", "line_end", "char_start", "char_end", "author", "email", "date", "summary"}
+		if withFile {
+			header = append([]string{"file"}, header...)
+		}
+		w.Write(header)
+		for _, f := range files {
+			for _, h := range blame.NormalizeHunks(c.backendName, hunks[f]) {
+				cm := commits[h.CommitID]
+				record := []string{h.CommitID, strconv.Itoa(h.LineStart + 1), strconv.Itoa(h.LineEnd), strconv.Itoa(h.CharStart), strconv.Itoa(h.CharEnd), cm.Author.Name, cm.Author.Email, formatDate(cm), cm.Summary}
+				if withFile {
+					record = append([]string{f}, record...)
+				}
+				w.Write(record)
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	tw := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	for _, f := range files {
+		for _, h := range blame.NormalizeHunks(c.backendName, hunks[f]) {
+			cm := commits[h.CommitID]
+			if withFile {
+				fmt.Fprintf(tw, "%s\t", f)
+			}
+			fmt.Fprintf(tw, "%d-%d\t%.12s\t%s\t%s\t%s\n", h.LineStart+1, h.LineEnd, h.CommitID, cm.Author.Name, formatDate(cm), cm.Summary)
+		}
+	}
+	return tw.Flush()
+}
+
+func (c *command) writeJSON(v interface{}) error {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func formatDate(c blame.Commit) string {
+	if c.AuthorDate.IsZero() {
+		return ""
+	}
+	return c.AuthorDate.Format("2006-01-02")
+}
+
+func formatPercent(p float64) string {
+	return strconv.FormatFloat(p, 'f', 1, 64)
+}
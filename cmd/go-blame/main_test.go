@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-blame/blame"
+)
+
+// testRepo creates a git repository with one commit.
+func testRepo(t *testing.T) string {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"a.txt": "a\nb\n", "d/c.go": "package c\n", "bin": "\x00"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{{"init", "-q"}, {"add", "-A"}, {"commit", "-q", "-m", "Add files"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com", "GIT_AUTHOR_DATE=2014-01-02T00:00:00Z",
+			"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com", "GIT_COMMITTER_DATE=2014-01-02T00:00:00Z")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s: %s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := testRepo(t)
+	tests := []struct {
+		args     []string
+		code     int
+		contains []string
+	}{
+		{args: []string{"file", "-repo", dir, "a.txt"}, contains: []string{"1-2", "Jane Doe", "2014-01-02", "Add files"}},
+		{args: []string{"file", "-repo", dir, "-lines", "2:2", "-format", "csv", "a.txt"}, contains: []string{"commit,line_start,", ",2,2,2,4,Jane Doe,jane@example.com,2014-01-02,Add files"}},
+		{args: []string{"file", "-repo", dir, "-format", "json", "a.txt"}, contains: []string{`"Hunks": [`, `"Summary": "Add files"`}},
+		{args: []string{"repo", "-repo", dir, "-ignore", "*.go"}, contains: []string{"a.txt  1-2"}},
+		{args: []string{"repo", "-repo", dir, "-format", "csv"}, contains: []string{"file,commit,", "d/c.go,"}},
+		{args: []string{"authorship", "-repo", dir, ".", "d"}, contains: []string{".: 3 lines, 14 chars", "d: 1 lines", "Jane Doe <jane@example.com>  3 lines  100.0%"}},
+		{args: []string{"authorship", "-repo", dir, "-format", "json"}, contains: []string{`".": {`}},
+
+		{args: []string{}, code: 2},
+		{args: []string{"unknown"}, code: 2},
+		{args: []string{"file", "-repo", dir}, code: 2},
+		{args: []string{"file", "-repo", dir, "-format", "xml", "a.txt"}, code: 2},
+		{args: []string{"file", "-repo", filepath.Join(dir, "nonexistent"), "a.txt"}, code: 3},
+		{args: []string{"file", "-repo", dir, "-rev", "nonexistent", "a.txt"}, code: 4},
+		{args: []string{"file", "-repo", dir, "nonexistent"}, code: 5},
+		{args: []string{"file", "-repo", dir, "bin"}, code: 6},
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(test.args, &stdout, &stderr)
+		if code != test.code {
+			t.Errorf("%v: got exit status %d, want %d (stderr: %s)", test.args, code, test.code, stderr.String())
+			continue
+		}
+		for _, s := range test.contains {
+			if !strings.Contains(stdout.String(), s) {
+				t.Errorf("%v: output doesn't contain %q:\n%s", test.args, s, stdout.String())
+			}
+		}
+	}
+
+	var stdout bytes.Buffer
+	if code := run([]string{"repo", "-repo", dir, "-format", "json"}, &stdout, ioutil.Discard); code != 0 {
+		t.Fatalf("got exit status %d", code)
+	}
+	var result struct {
+		Files   map[string]json.RawMessage
+		Commits map[string]json.RawMessage
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 2 || len(result.Commits) != 1 {
+		t.Errorf("got %d files and %d commits, want 2 and 1", len(result.Files), len(result.Commits))
+	}
+}
+
+func TestRun_maxFailedFiles(t *testing.T) {
+	dir := testRepo(t)
+	// Break d/c.go by removing its blob.
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD:d/c.go").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := strings.TrimSpace(string(out))
+	if err := os.Remove(filepath.Join(dir, ".git", "objects", id[:2], id[2:])); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"repo", "-repo", dir}, &stdout, &stderr); code == 0 || stdout.Len() != 0 {
+		t.Errorf("got exit status %d and output %q, want failure and none", code, stdout.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"repo", "-repo", dir, "-max-failed-files", "1"}, &stdout, &stderr); code != 1 {
+		t.Errorf("got exit status %d, want 1 (stderr: %s)", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "a.txt  1-2") || strings.Contains(stdout.String(), "d/c.go") {
+		t.Errorf("got output %q, want only a.txt", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "go-blame: d/c.go: ") {
+		t.Errorf("got stderr %q, want d/c.go listed", stderr.String())
+	}
+}
+
+func TestWriteHunks_hg(t *testing.T) {
+	// The hg backend's LineEnd is the index of the hunk's last line.
+	hunks := map[string][]blame.Hunk{"f": {
+		{CommitID: "a", LineStart: 0, LineEnd: 0, CharStart: 0, CharEnd: 2},
+		{CommitID: "b", LineStart: 1, LineEnd: 2, CharStart: 3, CharEnd: 7},
+	}}
+	commits := map[string]blame.Commit{"a": {ID: "a"}, "b": {ID: "b"}}
+	for format, want := range map[string][]string{
+		"text": {"1-1  a", "2-3  b"},
+		"csv":  {"a,1,1,0,2,", "b,2,3,2,6,"},
+	} {
+		var stdout bytes.Buffer
+		c := &command{stdout: &stdout, format: format, backendName: "hg"}
+		if err := c.writeHunks(hunks, commits, false); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range want {
+			if !strings.Contains(stdout.String(), s) {
+				t.Errorf("%s: output doesn't contain %q:\n%s", format, s, stdout.String())
+			}
+		}
+	}
+}